@@ -0,0 +1,291 @@
+package umpire
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/labstack/gommon/log"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const BUNDLE_MANIFEST = "manifest.json"
+
+// BundleManifest is the first entry of an image bundle. It lists each image
+// archive in the bundle together with its SHA-256 checksum.
+type BundleManifest struct {
+	Created time.Time      `json:"created"`
+	Images  []*BundleImage `json:"images"`
+}
+
+// BundleImage is one image archive of a bundle. Id is the image id, which
+// Import checks the archive against; Digest is the registry digest the
+// image had where it was exported, which `docker load` does not restore:
+// Import records it as a digestTag instead.
+type BundleImage struct {
+	Image     string   `json:"image"`
+	Id        string   `json:"id"`
+	Digest    string   `json:"digest"`
+	Languages []string `json:"languages"`
+	File      string   `json:"file"`
+	Size      int64    `json:"size"`
+	Sha256    string   `json:"sha256"`
+}
+
+// saveImage writes the `docker save` archive of image to a temporary file and
+// returns the file with its checksum. The caller removes the file.
+func (m *ImageManager) saveImage(ctx context.Context, image string) (*os.File, string, int64, error) {
+	r, err := m.Client.ImageSave(ctx, []string{image})
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer r.Close()
+	f, err := ioutil.TempFile("", "umpire_image_")
+	if err != nil {
+		return nil, "", 0, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if err == nil {
+		_, err = f.Seek(0, 0)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, "", 0, err
+	}
+	return f, hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// Export writes a bundle holding exactly the images the language
+// configuration needs. Every image must be present on the docker host.
+func (m *ImageManager) Export(ctx context.Context, w io.Writer) (*BundleManifest, error) {
+	manifest := &BundleManifest{Created: time.Now().UTC()}
+	files := []*os.File{}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	for i, spec := range configuredImages() {
+		status := m.inspect(ctx, spec)
+		if status.Error != "" {
+			return nil, fmt.Errorf("Cannot export %s: %s", spec.Image, status.Error)
+		}
+		log.Infof("Saving image %s", spec.Image)
+		f, sum, size, err := m.saveImage(ctx, spec.Image)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		manifest.Images = append(manifest.Images, &BundleImage{
+			Image:     spec.Image,
+			Id:        status.Id,
+			Digest:    status.Digest,
+			Languages: spec.Languages,
+			File:      fmt.Sprintf("images/%d.tar", i),
+			Size:      size,
+			Sha256:    sum,
+		})
+	}
+
+	tw := tar.NewWriter(w)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: BUNDLE_MANIFEST, Mode: 0644, Size: int64(len(data)), ModTime: manifest.Created}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+	for i, image := range manifest.Images {
+		if err := tw.WriteHeader(&tar.Header{Name: image.File, Mode: 0644, Size: image.Size, ModTime: manifest.Created}); err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(tw, files[i]); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, tw.Close()
+}
+
+// Import verifies every image archive in a bundle against the manifest
+// checksums and image ids and loads it into the docker host. When an
+// archive fails, the images loaded before it that were not on the host
+// already are removed again.
+func (m *ImageManager) Import(ctx context.Context, r io.Reader) (manifest *BundleManifest, err error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Name != BUNDLE_MANIFEST {
+		return nil, fmt.Errorf("Not an image bundle: first entry is %s, expected %s", hdr.Name, BUNDLE_MANIFEST)
+	}
+	manifest = &BundleManifest{}
+	if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+		return nil, err
+	}
+	loaded := []string{}
+	defer func() {
+		if err != nil {
+			m.removeImages(ctx, loaded)
+		}
+	}()
+	expected := map[string]*BundleImage{}
+	for _, image := range manifest.Images {
+		expected[image.File] = image
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		image, ok := expected[hdr.Name]
+		if !ok {
+			return nil, fmt.Errorf("Bundle entry %s is not listed in the manifest", hdr.Name)
+		}
+		delete(expected, hdr.Name)
+		added, err := m.loadImage(ctx, tr, image)
+		if added {
+			loaded = append(loaded, image.Id)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(expected) > 0 {
+		missing := []string{}
+		for _, image := range expected {
+			missing = append(missing, image.Image)
+		}
+		return nil, fmt.Errorf("Bundle is missing archives for: %s", strings.Join(missing, ", "))
+	}
+	return manifest, nil
+}
+
+// removeImages removes images loaded by an import that failed.
+func (m *ImageManager) removeImages(ctx context.Context, ids []string) {
+	for _, id := range ids {
+		log.Warnf("Removing image %s loaded by the failed import", id)
+		if _, err := m.Client.ImageRemove(ctx, id, types.ImageRemoveOptions{Force: true, PruneChildren: true}); err != nil {
+			log.Warnf("Failed to remove image %s: %v", id, err)
+		}
+	}
+}
+
+// loadImage checks the archive of image and loads it. added reports
+// whether the image was not on the host before, even when loading failed
+// after docker started on it.
+func (m *ImageManager) loadImage(ctx context.Context, r io.Reader, image *BundleImage) (added bool, err error) {
+	f, err := ioutil.TempFile("", "umpire_image_")
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		return false, err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != image.Sha256 {
+		return false, fmt.Errorf("Checksum mismatch for %s: got %s, manifest says %s", image.Image, sum, image.Sha256)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return false, err
+	}
+	id, err := archiveImageId(f)
+	if err != nil {
+		return false, fmt.Errorf("Archive of %s: %v", image.Image, err)
+	}
+	if id != image.Id {
+		return false, fmt.Errorf("Image id mismatch for %s: archive holds %s, manifest says %s", image.Image, id, image.Id)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return false, err
+	}
+	_, _, err = m.Client.ImageInspectWithRaw(ctx, image.Id)
+	added = err != nil
+	log.Infof("Loading image %s", image.Image)
+	resp, err := m.Client.ImageLoad(ctx, f, true)
+	if err != nil {
+		return added, err
+	}
+	defer resp.Body.Close()
+	if resp.JSON {
+		err = readProgress(resp.Body)
+	} else {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+	}
+	if err != nil {
+		return added, err
+	}
+	inspect, _, err := m.Client.ImageInspectWithRaw(ctx, image.Image)
+	if err != nil {
+		return added, err
+	}
+	if inspect.ID != image.Id {
+		return added, fmt.Errorf("Image %s was loaded as %s, manifest says %s", image.Image, inspect.ID, image.Id)
+	}
+	if image.Digest != "" && image.Digest != image.Id {
+		// Remember the registry digest `docker load` drops, so languages
+		// pinned by digest accept the image.
+		return added, m.Client.ImageTag(ctx, image.Id, digestTag(image.Image, image.Digest))
+	}
+	return added, nil
+}
+
+// archiveImageId returns the id of the single image in a `docker save`
+// archive: the digest of its configuration, computed from the archive.
+func archiveImageId(r io.Reader) (string, error) {
+	var entries []struct {
+		Config string
+	}
+	sums := map[string]string{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if hdr.Name == "manifest.json" {
+			if err := json.NewDecoder(tr).Decode(&entries); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if strings.HasSuffix(hdr.Name, ".json") {
+			h := sha256.New()
+			if _, err := io.Copy(h, tr); err != nil {
+				return "", err
+			}
+			sums[hdr.Name] = "sha256:" + hex.EncodeToString(h.Sum(nil))
+		}
+	}
+	if len(entries) != 1 {
+		return "", fmt.Errorf("expected one image, found %d", len(entries))
+	}
+	id, ok := sums[entries[0].Config]
+	if !ok {
+		return "", fmt.Errorf("configuration %s is missing", entries[0].Config)
+	}
+	return id, nil
+}
@@ -0,0 +1,93 @@
+package umpire
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func makeBundle(t *testing.T, manifest *BundleManifest, files map[string]string) *bytes.Buffer {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw.WriteHeader(&tar.Header{Name: BUNDLE_MANIFEST, Mode: 0644, Size: int64(len(data))})
+	tw.Write(data)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	return &b
+}
+
+func TestImportRejectsBadChecksum(t *testing.T) {
+	manifest := &BundleManifest{Images: []*BundleImage{
+		&BundleImage{Image: "phluent/clang", File: "images/0.tar", Sha256: "0000"},
+	}}
+	b := makeBundle(t, manifest, map[string]string{"images/0.tar": "not really an image"})
+	_, err := (&ImageManager{}).Import(context.Background(), b)
+	if err == nil || !strings.Contains(err.Error(), "Checksum mismatch") {
+		t.Errorf("Import: got %v, expected checksum mismatch", err)
+	}
+}
+
+func TestImportRejectsUnlistedEntry(t *testing.T) {
+	b := makeBundle(t, &BundleManifest{}, map[string]string{"images/0.tar": "extra"})
+	_, err := (&ImageManager{}).Import(context.Background(), b)
+	if err == nil || !strings.Contains(err.Error(), "not listed") {
+		t.Errorf("Import: got %v, expected unlisted entry error", err)
+	}
+}
+
+func TestImportRejectsMissingArchive(t *testing.T) {
+	manifest := &BundleManifest{Images: []*BundleImage{
+		&BundleImage{Image: "phluent/clang", File: "images/0.tar"},
+	}}
+	_, err := (&ImageManager{}).Import(context.Background(), makeBundle(t, manifest, nil))
+	if err == nil || !strings.Contains(err.Error(), "phluent/clang") {
+		t.Errorf("Import: got %v, expected missing archive error", err)
+	}
+}
+
+// saveArchive builds a minimal `docker save` archive around config.
+func saveArchive(t *testing.T, config string) string {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for _, entry := range []struct{ name, content string }{
+		{"manifest.json", `[{"Config":"abc.json","RepoTags":["phluent/clang:latest"]}]`},
+		{"abc.json", config},
+	} {
+		tw.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content))})
+		tw.Write([]byte(entry.content))
+	}
+	tw.Close()
+	return b.String()
+}
+
+func TestArchiveImageId(t *testing.T) {
+	sum := sha256.Sum256([]byte(`{"os":"linux"}`))
+	id, err := archiveImageId(strings.NewReader(saveArchive(t, `{"os":"linux"}`)))
+	if expected := "sha256:" + hex.EncodeToString(sum[:]); err != nil || id != expected {
+		t.Errorf("archiveImageId: got %q, %v, expected %q", id, err, expected)
+	}
+}
+
+func TestImportRejectsImageIdMismatch(t *testing.T) {
+	archive := saveArchive(t, `{"os":"linux"}`)
+	sum := sha256.Sum256([]byte(archive))
+	manifest := &BundleManifest{Images: []*BundleImage{
+		&BundleImage{Image: "phluent/clang", Id: "sha256:0000", File: "images/0.tar", Sha256: hex.EncodeToString(sum[:])},
+	}}
+	_, err := (&ImageManager{}).Import(context.Background(), makeBundle(t, manifest, map[string]string{"images/0.tar": archive}))
+	if err == nil || !strings.Contains(err.Error(), "Image id mismatch") {
+		t.Errorf("Import: got %v, expected image id mismatch", err)
+	}
+}
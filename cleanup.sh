@@ -1,3 +1,3 @@
 # Clean up scripts
-docker stop $(docker ps -a -q)
-docker rm $(docker ps -a -q)
\ No newline at end of file
+# Removes only containers created by umpire, see `umpire gc --help`.
+umpire gc --all
@@ -0,0 +1,188 @@
+// Command umpire-runner is the entrypoint of the judge images. It reads one
+// payload as JSON from stdin, the way umpire sends it, writes its files to a
+// scratch directory, compiles them if the language needs it and runs the
+// program on the payload's stdin.
+//
+// With -stream=true the program's stdout and stderr are the runner's own, so
+// umpire can compare them line by line as they come. With -stream=false they
+// are collected and written to stdout as one JSON object:
+// {"stdout": "...", "stderr": "...", "error": "..."}.
+//
+// Compiler flags come from -cxxflags, which language variants set through
+// their cmd, e.g. "cmd": ["-cxxflags=-std=c++17 -O2"].
+//
+// umpire gives every container a mark in UMPIRE_COMPILED_MARK. When it is
+// set the runner reports how long compiling took: with -stream=true as a
+// line "<mark> <seconds>" on stderr before the program runs, otherwise as
+// "compile_seconds" in the JSON object. The compiler and the program do not
+// see the mark.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// COMPILED_MARK_ENV is umpire's variable of the same name.
+const COMPILED_MARK_ENV = "UMPIRE_COMPILED_MARK"
+
+var (
+	stream   = flag.Bool("stream", false, "pass the program's output through instead of returning it as JSON")
+	cxxflags = flag.String("cxxflags", "", "flags for the C++ compiler, e.g. \"-std=c++17 -O2\"")
+)
+
+// file and payload are the parts of umpire's Payload the runner needs.
+type file struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+type payload struct {
+	Language string  `json:"language"`
+	Files    []*file `json:"files"`
+	Stdin    string  `json:"stdin"`
+}
+
+// result is written with -stream=false.
+type result struct {
+	Stdout         string  `json:"stdout"`
+	Stderr         string  `json:"stderr"`
+	Error          string  `json:"error"`
+	CompileSeconds float64 `json:"compile_seconds,omitempty"`
+}
+
+// language builds the commands for a program whose files are in dir.
+// compile is nil for languages that are not compiled.
+type language struct {
+	compile func(r *runner, dir string, names []string) *exec.Cmd
+	run     func(dir string, names []string) *exec.Cmd
+}
+
+var languages = map[string]*language{
+	"cpp": {
+		compile: func(r *runner, dir string, names []string) *exec.Cmd {
+			args := append([]string{}, r.cxxflags...)
+			args = append(args, "-o", "main")
+			for _, name := range names {
+				if strings.HasSuffix(name, ".cpp") || strings.HasSuffix(name, ".cc") {
+					args = append(args, name)
+				}
+			}
+			return command(dir, "clang++", args...)
+		},
+		run: func(dir string, names []string) *exec.Cmd {
+			return command(dir, filepath.Join(dir, "main"))
+		},
+	},
+}
+
+func command(dir, name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = programEnv(os.Environ())
+	return cmd
+}
+
+// programEnv is env without the mark, which is meant for the runner alone.
+func programEnv(env []string) []string {
+	out := []string{}
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, COMPILED_MARK_ENV+"=") {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// runner compiles and runs one payload, writing what the compiler and the
+// program print to stdout and stderr. compiled, if set, is told how long
+// compiling took before the program runs.
+type runner struct {
+	cxxflags       []string
+	stdout, stderr io.Writer
+	compiled       func(d time.Duration)
+}
+
+func (r *runner) run(p *payload) error {
+	lang, ok := languages[p.Language]
+	if !ok {
+		return fmt.Errorf("language %q is not supported by this image", p.Language)
+	}
+	if len(p.Files) == 0 {
+		return fmt.Errorf("no files given")
+	}
+	dir, err := ioutil.TempDir("", "umpire")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	names := []string{}
+	for _, f := range p.Files {
+		// Names are checked by umpire; Base keeps them in dir regardless.
+		name := filepath.Base(f.Name)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(f.Content), 0644); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	if lang.compile != nil {
+		cmd := lang.compile(r, dir, names)
+		cmd.Stdout, cmd.Stderr = r.stderr, r.stderr
+		start := time.Now()
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("compile error: %v", err)
+		}
+		if r.compiled != nil {
+			r.compiled(time.Since(start))
+		}
+	}
+	cmd := lang.run(dir, names)
+	cmd.Stdin = strings.NewReader(p.Stdin)
+	cmd.Stdout, cmd.Stderr = r.stdout, r.stderr
+	return cmd.Run()
+}
+
+func main() {
+	flag.Parse()
+	p := &payload{}
+	err := json.NewDecoder(os.Stdin).Decode(p)
+	if *stream {
+		r := &runner{cxxflags: strings.Fields(*cxxflags), stdout: os.Stdout, stderr: os.Stderr}
+		if mark := os.Getenv(COMPILED_MARK_ENV); mark != "" {
+			r.compiled = func(d time.Duration) {
+				fmt.Fprintf(os.Stderr, "%s %f\n", mark, d.Seconds())
+			}
+		}
+		if err == nil {
+			err = r.run(p)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "umpire-runner: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	var stdout, stderr bytes.Buffer
+	var compile time.Duration
+	r := &runner{cxxflags: strings.Fields(*cxxflags), stdout: &stdout, stderr: &stderr}
+	if os.Getenv(COMPILED_MARK_ENV) != "" {
+		r.compiled = func(d time.Duration) { compile = d }
+	}
+	if err == nil {
+		err = r.run(p)
+	}
+	res := &result{Stdout: stdout.String(), Stderr: stderr.String(), CompileSeconds: compile.Seconds()}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	json.NewEncoder(os.Stdout).Encode(res)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCompiler puts a clang++ on PATH that records its arguments in
+// args.txt and builds a main that echoes its stdin.
+func fakeCompiler(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "runner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := `#!/bin/sh
+echo "$@" > "` + filepath.Join(dir, "args.txt") + `"
+out=""
+prev=""
+for arg in "$@"; do
+	if [ "$prev" = "-o" ]; then out="$arg"; fi
+	prev="$arg"
+done
+printf '#!/bin/sh\ncat\n' > "$out"
+chmod +x "$out"
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "clang++"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	return dir, func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRunnerPassesCompilerFlags(t *testing.T) {
+	dir, cleanup := fakeCompiler(t)
+	defer cleanup()
+	var stdout, stderr bytes.Buffer
+	r := &runner{cxxflags: strings.Fields("-std=c++17 -O2"), stdout: &stdout, stderr: &stderr}
+	p := &payload{Language: "cpp", Files: []*file{{Name: "main.cpp", Content: "int main() {}"}}, Stdin: "3 4\n"}
+	if err := r.run(p); err != nil {
+		t.Fatalf("run: %v (stderr %q)", err, stderr.String())
+	}
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(args)); got != "-std=c++17 -O2 -o main main.cpp" {
+		t.Errorf("clang++ got %q", got)
+	}
+	if stdout.String() != "3 4\n" {
+		t.Errorf("program printed %q, expected its stdin", stdout.String())
+	}
+}
+
+func TestRunnerRejectsUnknownLanguage(t *testing.T) {
+	r := &runner{stdout: ioutil.Discard, stderr: ioutil.Discard}
+	if err := r.run(&payload{Language: "cobol", Files: []*file{{Name: "main.cob"}}}); err == nil {
+		t.Errorf("expected an error for an unsupported language")
+	}
+}
+
+func TestRunnerReportsCompileTime(t *testing.T) {
+	_, cleanup := fakeCompiler(t)
+	defer cleanup()
+	var stdout bytes.Buffer
+	reported := false
+	r := &runner{stdout: &stdout, stderr: ioutil.Discard, compiled: func(d time.Duration) {
+		if stdout.Len() != 0 {
+			t.Errorf("compile time reported after the program ran")
+		}
+		reported = true
+	}}
+	p := &payload{Language: "cpp", Files: []*file{{Name: "main.cpp"}}, Stdin: "x\n"}
+	if err := r.run(p); err != nil {
+		t.Fatal(err)
+	}
+	if !reported {
+		t.Errorf("compile time not reported")
+	}
+}
+
+func TestProgramEnvDropsMark(t *testing.T) {
+	env := programEnv([]string{"PATH=/bin", COMPILED_MARK_ENV + "=abc", "HOME=/home/judge"})
+	if strings.Join(env, " ") != "PATH=/bin HOME=/home/judge" {
+		t.Errorf("got %v", env)
+	}
+}
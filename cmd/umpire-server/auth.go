@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	API_KEY_HEADER = "X-API-Key"
+	ANONYMOUS      = "anon"
+	CALLER_KEY     = "caller"
+	ROLES_KEY      = "roles"
+)
+
+// Roles, from least to most privileged. Each role can do everything the
+// roles before it can.
+const (
+	RoleSubmitter     = "submitter"
+	RoleProblemSetter = "problem-setter"
+	RoleAdmin         = "admin"
+)
+
+var roleRank = map[string]int{
+	RoleSubmitter:     1,
+	RoleProblemSetter: 2,
+	RoleAdmin:         3,
+}
+
+// APIKey lets the holder of Key call the API as Uid. A key without roles
+// is a submitter key.
+type APIKey struct {
+	Uid   string   `json:"uid"`
+	Key   string   `json:"key"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// tokenClaims are the claims read from bearer tokens; "roles" is optional
+// and means submitter when missing.
+type tokenClaims struct {
+	Roles []string `json:"roles,omitempty"`
+	jwt.StandardClaims
+}
+
+// DEFAULT_TOKEN_LIFETIME bounds how far in the future tokens may expire
+// when the -auth file does not say.
+const DEFAULT_TOKEN_LIFETIME = 24 * time.Hour
+
+// AuthConfig is the content of the -auth file. Callers authenticate with
+// one of the API keys, or with an HS256 token signed with JWTSecret whose
+// "sub" claim is their uid and "roles" claim their roles. Tokens must
+// carry an "exp" claim at most MaxTokenLifetime after they were issued.
+type AuthConfig struct {
+	APIKeys          []*APIKey `json:"api_keys"`
+	JWTSecret        string    `json:"jwt_secret"`
+	MaxTokenLifetime Duration  `json:"max_token_lifetime,omitempty"`
+}
+
+func LoadAuthConfig(filename string) (*AuthConfig, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := &AuthConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	for i, key := range config.APIKeys {
+		if key.Uid == "" || key.Key == "" {
+			return nil, fmt.Errorf("api_keys[%d]: uid and key are required", i)
+		}
+		if err := checkRoles(key.Roles); err != nil {
+			return nil, fmt.Errorf("api_keys[%d]: %v", i, err)
+		}
+	}
+	return config, nil
+}
+
+func (a *AuthConfig) maxTokenLifetime() time.Duration {
+	if a.MaxTokenLifetime.Duration > 0 {
+		return a.MaxTokenLifetime.Duration
+	}
+	return DEFAULT_TOKEN_LIFETIME
+}
+
+func checkRoles(roles []string) error {
+	for _, role := range roles {
+		if _, ok := roleRank[role]; !ok {
+			return fmt.Errorf("unknown role %q", role)
+		}
+	}
+	return nil
+}
+
+func (a *AuthConfig) keyOwner(key string) (*APIKey, bool) {
+	var owner *APIKey
+	for _, k := range a.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+			owner = k
+		}
+	}
+	return owner, owner != nil
+}
+
+func (a *AuthConfig) tokenOwner(raw string) (string, []string, error) {
+	if a.JWTSecret == "" {
+		return "", nil, fmt.Errorf("bearer tokens are not accepted")
+	}
+	claims := &tokenClaims{}
+	token, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return []byte(a.JWTSecret), nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if !token.Valid || claims.Subject == "" {
+		return "", nil, fmt.Errorf("token has no subject")
+	}
+	if claims.ExpiresAt == 0 {
+		return "", nil, fmt.Errorf("token has no expiry")
+	}
+	// Without iat, the lifetime left is what counts.
+	issued := time.Now().Unix()
+	if claims.IssuedAt != 0 && claims.IssuedAt < issued {
+		issued = claims.IssuedAt
+	}
+	if lifetime := time.Duration(claims.ExpiresAt-issued) * time.Second; lifetime > a.maxTokenLifetime() {
+		return "", nil, fmt.Errorf("token lives %v, at most %v is allowed", lifetime, a.maxTokenLifetime())
+	}
+	if err := checkRoles(claims.Roles); err != nil {
+		return "", nil, err
+	}
+	return claims.Subject, claims.Roles, nil
+}
+
+// authenticate records the caller's uid and roles in the request context,
+// rejecting requests without valid credentials. Without an AuthConfig every
+// request is let through as ANONYMOUS with anonymousRoles.
+func (us *UmpireServer) authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if publicPaths[routePath(c)] {
+			return next(c)
+		}
+		if us.auth == nil {
+			c.Set(CALLER_KEY, ANONYMOUS)
+			c.Set(ROLES_KEY, us.anonymousRoles())
+			return next(c)
+		}
+		if key := c.Request().Header.Get(API_KEY_HEADER); key != "" {
+			owner, ok := us.auth.keyOwner(key)
+			if !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid API key")
+			}
+			c.Set(CALLER_KEY, owner.Uid)
+			c.Set(ROLES_KEY, owner.Roles)
+			return next(c)
+		}
+		if header := c.Request().Header.Get(echo.HeaderAuthorization); strings.HasPrefix(header, "Bearer ") {
+			uid, roles, err := us.auth.tokenOwner(strings.TrimPrefix(header, "Bearer "))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, fmt.Sprintf("invalid token: %v", err))
+			}
+			c.Set(CALLER_KEY, uid)
+			c.Set(ROLES_KEY, roles)
+			return next(c)
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, "missing credentials")
+	}
+}
+
+// anonymousRoles are the roles of callers when there is no AuthConfig:
+// submitter, unless -insecureopen hands out everything.
+func (us *UmpireServer) anonymousRoles() []string {
+	if us.open {
+		return []string{RoleAdmin}
+	}
+	return []string{RoleSubmitter}
+}
+
+// caller returns the uid authenticate recorded for the request.
+func caller(c echo.Context) string {
+	if uid, ok := c.Get(CALLER_KEY).(string); ok {
+		return uid
+	}
+	return ANONYMOUS
+}
+
+// hasRole reports whether the caller holds role or a more privileged one.
+func hasRole(c echo.Context, role string) bool {
+	roles, _ := c.Get(ROLES_KEY).([]string)
+	return holdsRole(roles, role)
+}
+
+// holdsRole reports whether roles include role or a more privileged one;
+// no roles at all means submitter.
+func holdsRole(roles []string, role string) bool {
+	if len(roles) == 0 {
+		roles = []string{RoleSubmitter}
+	}
+	for _, r := range roles {
+		if roleRank[r] >= roleRank[role] {
+			return true
+		}
+	}
+	return false
+}
+
+// requireRole rejects callers that do not hold role.
+func requireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !hasRole(c, role) {
+				return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("%s role required", role))
+			}
+			return next(c)
+		}
+	}
+}
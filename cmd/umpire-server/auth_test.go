@@ -0,0 +1,150 @@
+package main
+
+import (
+	"github.com/golang-jwt/jwt"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/jobs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedToken signs a token for subject; a zero expires leaves out exp.
+func signedToken(t *testing.T, secret, subject string, expires time.Time) string {
+	claims := &jwt.StandardClaims{Subject: subject}
+	if !expires.IsZero() {
+		claims.ExpiresAt = expires.Unix()
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	s, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAuthenticate(t *testing.T) {
+	store := jobs.NewMemoryStore()
+	store.Put(&jobs.Job{Id: "j1", Uid: "alice", State: jobs.Done, Result: &umpire.Response{Status: umpire.Pass}})
+	server := NewUmpireServer(&umpire.Agent{}, store, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.auth = &AuthConfig{
+		APIKeys:   []*APIKey{{Uid: "alice", Key: "alice-key"}, {Uid: "bob", Key: "bob-key"}},
+		JWTSecret: "jwt-secret",
+	}
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		code   int
+	}{
+		{"no credentials", "", "", http.StatusUnauthorized},
+		{"unknown key", API_KEY_HEADER, "nope", http.StatusUnauthorized},
+		{"owner key", API_KEY_HEADER, "alice-key", http.StatusOK},
+		{"other caller", API_KEY_HEADER, "bob-key", http.StatusNotFound},
+		{"owner token", "Authorization", "Bearer " + signedToken(t, "jwt-secret", "alice", time.Now().Add(time.Hour)), http.StatusOK},
+		{"expired token", "Authorization", "Bearer " + signedToken(t, "jwt-secret", "alice", time.Now().Add(-time.Hour)), http.StatusUnauthorized},
+		{"wrong secret", "Authorization", "Bearer " + signedToken(t, "guess", "alice", time.Now().Add(time.Hour)), http.StatusUnauthorized},
+		{"token without expiry", "Authorization", "Bearer " + signedToken(t, "jwt-secret", "alice", time.Time{}), http.StatusUnauthorized},
+		{"token living too long", "Authorization", "Bearer " + signedToken(t, "jwt-secret", "alice", time.Now().Add(DEFAULT_TOKEN_LIFETIME+time.Hour)), http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "/submissions/j1", nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		rw := httptest.NewRecorder()
+		server.e.ServeHTTP(rw, req)
+		if rw.Code != test.code {
+			t.Errorf("%s: StatusCode: expected %d, got %d", test.name, test.code, rw.Code)
+		}
+	}
+}
+
+func TestLoadAuthConfigRequiresUid(t *testing.T) {
+	f, err := ioutil.TempFile("", "umpire_auth_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	f.WriteString(`{"api_keys": [{"key": "k"}]}`)
+	if _, err := LoadAuthConfig(f.Name()); err == nil {
+		t.Errorf("expected an error for a key without uid")
+	}
+}
+
+func TestAnonymousCallersAreSubmitters(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	tests := []struct {
+		method, path string
+		code         int
+	}{
+		// Submitters get past authorization; the empty body is then rejected.
+		{"POST", "/judge", http.StatusBadRequest},
+		{"POST", "/validate", http.StatusForbidden},
+		{"PUT", "/problems/sum", http.StatusForbidden},
+		{"DELETE", "/problems/sum", http.StatusForbidden},
+		{"POST", "/problems/sum/testcases", http.StatusForbidden},
+		{"POST", "/problems/sum/rejudge", http.StatusForbidden},
+		{"POST", "/admin/reload", http.StatusForbidden},
+		{"GET", "/debug/status", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.path, strings.NewReader(`{`))
+		req.Header.Set("Content-Type", "application/json")
+		rw := httptest.NewRecorder()
+		server.e.ServeHTTP(rw, req)
+		if rw.Code != test.code {
+			t.Errorf("%s %s: StatusCode: expected %d, got %d", test.method, test.path, test.code, rw.Code)
+		}
+	}
+	server.open = true
+	rw := httptest.NewRecorder()
+	server.e.ServeHTTP(rw, jsonPostRequest(t, "/validate", []byte(`{`)))
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("/validate with -insecureopen: StatusCode: expected %d, got %d", http.StatusBadRequest, rw.Code)
+	}
+}
+
+func TestValidateRequiresProblemSetter(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.auth = &AuthConfig{
+		APIKeys: []*APIKey{
+			{Uid: "sam", Key: "submitter-key"},
+			{Uid: "pat", Key: "setter-key", Roles: []string{RoleProblemSetter}},
+		},
+		JWTSecret: "jwt-secret",
+	}
+	adminToken := jwt.NewWithClaims(jwt.SigningMethodHS256, &tokenClaims{Roles: []string{RoleAdmin}, StandardClaims: jwt.StandardClaims{Subject: "ada", ExpiresAt: time.Now().Add(time.Hour).Unix()}})
+	signed, err := adminToken.SignedString([]byte("jwt-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		code   int
+	}{
+		{"submitter", API_KEY_HEADER, "submitter-key", http.StatusForbidden},
+		// Problem setters get past authorization; the empty body is then rejected.
+		{"problem setter", API_KEY_HEADER, "setter-key", http.StatusBadRequest},
+		{"admin token", "Authorization", "Bearer " + signed, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		req := jsonPostRequest(t, "/validate", []byte(`{`))
+		req.Header.Set(test.header, test.value)
+		rw := httptest.NewRecorder()
+		server.e.ServeHTTP(rw, req)
+		if rw.Code != test.code {
+			t.Errorf("%s: StatusCode: expected %d, got %d", test.name, test.code, rw.Code)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/jobs"
+	"net/http"
+	"time"
+)
+
+// MAX_BATCH bounds how many judgements one batch may hold.
+const MAX_BATCH = 1000
+
+// BATCH_BODY_LIMIT bounds the size of a POST /batches body.
+const BATCH_BODY_LIMIT = "32M"
+
+// batchRequest is the body of POST /batches: either payloads, or one
+// payload to judge against each of problems.
+type batchRequest struct {
+	Payloads []*umpire.Payload `json:"payloads,omitempty"`
+	Payload  *umpire.Payload   `json:"payload,omitempty"`
+	Problems []string          `json:"problems,omitempty"`
+}
+
+// payloads expands the request into one payload per judgement.
+func (r *batchRequest) payloads() ([]*umpire.Payload, error) {
+	if (len(r.Payloads) > 0) == (r.Payload != nil) {
+		return nil, fmt.Errorf("give either payloads or payload with problems")
+	}
+	if r.Payload == nil {
+		return r.Payloads, nil
+	}
+	if len(r.Problems) == 0 {
+		return nil, fmt.Errorf("payload needs problems to be judged against")
+	}
+	payloads := []*umpire.Payload{}
+	for _, id := range r.Problems {
+		payload := *r.Payload
+		payload.Problem = &umpire.Problem{Id: id}
+		payloads = append(payloads, &payload)
+	}
+	return payloads, nil
+}
+
+// field names where in the request the invalid part of judgement i is.
+func (r *batchRequest) field(i int, verr *umpire.ValidationError) string {
+	prefix := fmt.Sprintf("payloads[%d]", i)
+	if r.Payload != nil {
+		if verr.Code == umpire.ErrCodeUnknownProblem {
+			return fmt.Sprintf("problems[%d]", i)
+		}
+		prefix = "payload"
+	}
+	if verr.Field == "" {
+		return prefix
+	}
+	return prefix + "." + verr.Field
+}
+
+// batchRef answers POST /batches.
+type batchRef struct {
+	Id    string `json:"id"`
+	Total int    `json:"total"`
+}
+
+// batchStatus sums up the jobs of a batch.
+type batchStatus struct {
+	Id        string    `json:"id"`
+	Uid       string    `json:"uid"`
+	Created   time.Time `json:"created"`
+	Total     int       `json:"total"`
+	Queued    int       `json:"queued"`
+	Running   int       `json:"running"`
+	Done      int       `json:"done"`
+	Cancelled int       `json:"cancelled"`
+	Passed    int       `json:"passed"`
+	Failed    int       `json:"failed"`
+	Complete  bool      `json:"complete"`
+}
+
+// batchResult is one line of GET /batches/:id/results. Index is the
+// position of the judgement in the batch request. In a rejudge, Rejudges
+// is the submission judged again and Previous the verdict it had before.
+type batchResult struct {
+	Index        int              `json:"index"`
+	SubmissionId string           `json:"submission_id"`
+	ProblemId    string           `json:"problem_id"`
+	State        jobs.State       `json:"state"`
+	Result       *umpire.Response `json:"result,omitempty"`
+	Rejudges     string           `json:"rejudges,omitempty"`
+	Previous     umpire.Decision  `json:"previous,omitempty"`
+}
+
+// submitBatch validates every judgement of the batch, rejecting the whole
+// batch if one is invalid, and queues them together. They share the
+// caller's rate limits and quota with single judgements: the request counts
+// once against the /batches rate, and every job is charged to the caller's
+// quota as it runs.
+func (us *UmpireServer) submitBatch(c echo.Context) error {
+	req := &batchRequest{}
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	payloads, err := req.payloads()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if len(payloads) > MAX_BATCH {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("a batch holds at most %d judgements", MAX_BATCH))
+	}
+	for i, payload := range payloads {
+		if payload == nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("payloads[%d] is empty", i))
+		}
+		if err := us.localAgent.ValidatePayload(payload, true); err != nil {
+			if verr, ok := err.(*umpire.ValidationError); ok {
+				verr.Field = req.field(i, verr)
+			}
+			return invalidRequest(c, err)
+		}
+	}
+	batch, err := us.jobs.SubmitBatch(caller(c), payloads)
+	if err == jobs.ErrQueueFull || err == jobs.ErrQueueClosed {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	c.Logger().Infof("batch %s: %d judgements", batch.Id, len(batch.Jobs))
+	for _, id := range batch.Jobs {
+		us.events.Publish(&umpire.Event{SubmissionId: id, Type: umpire.EventQueued, Time: batch.Created})
+	}
+	return c.JSON(http.StatusAccepted, &batchRef{batch.Id, len(batch.Jobs)})
+}
+
+// callerBatch looks up the batch named by the :id parameter and its jobs.
+// Batches of someone else are reported as not found, except to admins.
+func (us *UmpireServer) callerBatch(c echo.Context) (*jobs.Batch, []*jobs.Job, error) {
+	batch, err := us.jobs.Batch(c.Param("id"))
+	if err == jobs.ErrBatchNotFound || err == nil && batch.Uid != caller(c) && !hasRole(c, RoleAdmin) {
+		return nil, nil, echo.NewHTTPError(http.StatusNotFound, jobs.ErrBatchNotFound.Error())
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	all := []*jobs.Job{}
+	for _, id := range batch.Jobs {
+		job, err := us.jobs.Get(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		all = append(all, job)
+	}
+	return batch, all, nil
+}
+
+func summarizeBatch(batch *jobs.Batch, all []*jobs.Job) *batchStatus {
+	s := &batchStatus{Id: batch.Id, Uid: batch.Uid, Created: batch.Created, Total: len(all)}
+	for _, job := range all {
+		switch job.State {
+		case jobs.Queued:
+			s.Queued++
+		case jobs.Running:
+			s.Running++
+		case jobs.Done:
+			s.Done++
+		case jobs.Cancelled:
+			s.Cancelled++
+		}
+		if job.Result != nil && job.Result.Status == umpire.Pass {
+			s.Passed++
+		} else if job.Result != nil {
+			s.Failed++
+		}
+	}
+	s.Complete = s.Done+s.Cancelled == s.Total
+	return s
+}
+
+func (us *UmpireServer) getBatch(c echo.Context) error {
+	batch, all, err := us.callerBatch(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, summarizeBatch(batch, all))
+}
+
+// batchResults streams the results of a complete batch as JSON lines, in
+// the order of the batch request. An incomplete batch gets 409 with its
+// status.
+func (us *UmpireServer) batchResults(c echo.Context) error {
+	batch, all, err := us.callerBatch(c)
+	if err != nil {
+		return err
+	}
+	if status := summarizeBatch(batch, all); !status.Complete {
+		return c.JSON(http.StatusConflict, status)
+	}
+	c.Response().Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "batch-"+batch.Id+".jsonl"))
+	c.Response().WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(c.Response())
+	for i, job := range all {
+		line := &batchResult{Index: i, SubmissionId: job.Id, State: job.State, Result: job.Result, Rejudges: job.Rejudges}
+		if job.Rejudges != "" {
+			line.Previous = us.previousVerdict(job)
+		}
+		if job.Payload != nil && job.Payload.Problem != nil {
+			line.ProblemId = job.Payload.Problem.Id
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cancelBatch cancels the jobs of a batch that have not finished yet.
+func (us *UmpireServer) cancelBatch(c echo.Context) error {
+	batch, all, err := us.callerBatch(c)
+	if err != nil {
+		return err
+	}
+	for _, job := range all {
+		if job.Ended() {
+			continue
+		}
+		cancelled, err := us.jobs.Cancel(job.Id)
+		if err != nil {
+			return err
+		}
+		if cancelled.State == jobs.Cancelled {
+			us.events.expire(job.Id)
+		}
+	}
+	_, all, err = us.callerBatch(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, summarizeBatch(batch, all))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/jobs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSubmitBatchRejectsInvalidJudgement(t *testing.T) {
+	agent := &umpire.Agent{Problems: umpire.NewProblemStore(map[string]*umpire.JudgeData{"sum": {}})}
+	server := NewUmpireServer(agent, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	tests := []struct {
+		body  string
+		code  int
+		field string
+	}{
+		{`{}`, http.StatusBadRequest, ""},
+		{`{"payload":{"language":"cpp","files":[{"name":"main.cpp","content":""}]}}`, http.StatusBadRequest, ""},
+		{`{"payload":{"language":"cpp","files":[{"name":"main.cpp","content":""}]},"problems":["sum","nope"]}`, http.StatusNotFound, "problems[1]"},
+		{`{"payloads":[{"language":"cpp","problem":{"id":"sum"},"files":[{"name":"main.cpp","content":""}]},{"language":"cobol","problem":{"id":"sum"},"files":[{"name":"main.cob","content":""}]}]}`, http.StatusUnprocessableEntity, "payloads[1].language"},
+	}
+	for _, test := range tests {
+		rw := httptest.NewRecorder()
+		server.e.ServeHTTP(rw, jsonPostRequest(t, "/batches", []byte(test.body)))
+		if rw.Code != test.code {
+			t.Errorf("%s: StatusCode: expected %d, got %d", test.body, test.code, rw.Code)
+			continue
+		}
+		verr := &umpire.ValidationError{}
+		if test.field != "" && (json.Unmarshal(rw.Body.Bytes(), verr) != nil || verr.Field != test.field) {
+			t.Errorf("%s: expected field %q, got %s", test.body, test.field, rw.Body.String())
+		}
+	}
+	if n := server.jobs.Pending() + server.jobs.Background(); n != 0 {
+		t.Errorf("expected nothing queued, got %d jobs", n)
+	}
+}
+
+func TestBatchResults(t *testing.T) {
+	store := jobs.NewMemoryStore()
+	store.PutBatch(&jobs.Batch{Id: "b1", Uid: "alice", Jobs: []string{"j1", "j2"}})
+	store.Put(&jobs.Job{Id: "j1", Uid: "alice", Batch: "b1", State: jobs.Done, Payload: &umpire.Payload{Problem: &umpire.Problem{Id: "sum"}}, Result: &umpire.Response{Status: umpire.Pass}})
+	store.Put(&jobs.Job{Id: "j2", Uid: "alice", Batch: "b1", State: jobs.Cancelled, Payload: &umpire.Payload{}})
+	store.PutBatch(&jobs.Batch{Id: "b2", Uid: "alice", Jobs: []string{"j3"}})
+	store.Put(&jobs.Job{Id: "j3", Uid: "alice", Batch: "b2", State: jobs.Done, Payload: &umpire.Payload{}})
+	server := NewUmpireServer(&umpire.Agent{}, store, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.auth = &AuthConfig{APIKeys: []*APIKey{{Uid: "alice", Key: "a"}, {Uid: "bob", Key: "b"}}}
+	get := func(path, key string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set(API_KEY_HEADER, key)
+		rw := httptest.NewRecorder()
+		server.e.ServeHTTP(rw, req)
+		return rw
+	}
+
+	if rw := get("/batches/b1/results", "b"); rw.Code != http.StatusNotFound {
+		t.Errorf("other caller: StatusCode: expected %d, got %d", http.StatusNotFound, rw.Code)
+	}
+	rw := get("/batches/b1/results", "a")
+	if rw.Code != http.StatusOK {
+		t.Fatalf("StatusCode: expected %d, got %d", http.StatusOK, rw.Code)
+	}
+	lines := []*batchResult{}
+	scanner := bufio.NewScanner(strings.NewReader(rw.Body.String()))
+	for scanner.Scan() {
+		line := &batchResult{}
+		if err := json.Unmarshal(scanner.Bytes(), line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 || lines[0].SubmissionId != "j1" || lines[0].ProblemId != "sum" || lines[0].Result == nil || lines[1].Index != 1 || lines[1].State != jobs.Cancelled {
+		t.Errorf("unexpected results %s", rw.Body.String())
+	}
+
+	status := &batchStatus{}
+	rw = get("/batches/b1", "a")
+	if err := json.Unmarshal(rw.Body.Bytes(), status); err != nil || !status.Complete || status.Passed != 1 || status.Cancelled != 1 {
+		t.Errorf("unexpected status %s", rw.Body.String())
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/maddyonline/umpire"
+	"github.com/spf13/viper"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ENV_PREFIX prefixes the environment variable of every flag, e.g.
+// UMPIRE_LISTEN for -listen.
+const ENV_PREFIX = "UMPIRE"
+
+var (
+	configFile   = flag.String("config", "", "settings file (yaml, json or toml) keyed by flag name (default is umpire-server.* in . or $HOME)")
+	listen       = flag.String("listen", ":1323", "address the API listens on")
+	grpcListen   = flag.String("grpclisten", "", "address the gRPC API listens on, e.g. :50051; empty to not serve it")
+	tlsCert      = flag.String("tlscert", "", "TLS certificate file; serves HTTPS and gRPC over TLS together with -tlskey")
+	tlsKey       = flag.String("tlskey", "", "TLS private key file")
+	refreshEvery = flag.Duration("refreshinterval", 120*time.Second, "how often problems are reloaded from their sources")
+	judgeTimeout = flag.Duration("judgetimeout", umpire.JudgeTimeout, "how long a judge container may run before it is stopped")
+	readTimeout  = flag.Duration("readtimeout", 0, "maximum time to read a request, body included (0 is no limit)")
+	writeTimeout = flag.Duration("writetimeout", 0, "maximum time to write a response (0 is no limit; keep it 0 or long when using /events)")
+)
+
+// loadConfig parses args into fs and fills every flag not given on the
+// command line from its environment variable, then from the settings file.
+// Flags keep their defaults when set nowhere.
+func loadConfig(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	v := viper.New()
+	if name := fs.Lookup("config").Value.String(); name != "" {
+		v.SetConfigFile(name)
+		if err := v.ReadInConfig(); err != nil {
+			return fmt.Errorf("reading %s: %v", name, err)
+		}
+	} else {
+		v.SetConfigName("umpire-server")
+		v.AddConfigPath(".")
+		v.AddConfigPath("$HOME")
+		if err := v.ReadInConfig(); err != nil {
+			if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+				return err
+			}
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || given[f.Name] || f.Name == "config" {
+			return
+		}
+		v.BindEnv(f.Name, ENV_PREFIX+"_"+strings.ToUpper(f.Name))
+		if !v.IsSet(f.Name) {
+			return
+		}
+		if e := f.Value.Set(settingString(v.Get(f.Name))); e != nil {
+			err = fmt.Errorf("%s: %v", f.Name, e)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if (flagValue(fs, "tlscert") == "") != (flagValue(fs, "tlskey") == "") {
+		return fmt.Errorf("tlscert and tlskey must be given together")
+	}
+	return nil
+}
+
+// flagValue is the value of fs's flag name, empty when there is none.
+func flagValue(fs *flag.FlagSet, name string) string {
+	if f := fs.Lookup(name); f != nil {
+		return f.Value.String()
+	}
+	return ""
+}
+
+// settingString turns a value read from a settings file into flag syntax;
+// lists become comma separated.
+func settingString(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// expandHome replaces a leading ~ with the home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	if u, err := user.Current(); err == nil {
+		return filepath.Join(u.HomeDir, path[1:])
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, path[1:])
+	}
+	return path
+}
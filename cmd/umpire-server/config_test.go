@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "umpire-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	settings := filepath.Join(dir, "settings.yaml")
+	content := "listen: \":9000\"\nrefreshinterval: 5m\nworkers: 8\ncorsorigins: [https://a.com, https://b.com]\n"
+	if err := ioutil.WriteFile(settings, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("UMPIRE_WORKERS", "2")
+	defer os.Unsetenv("UMPIRE_WORKERS")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("config", "", "")
+	listen := fs.String("listen", ":1323", "")
+	refresh := fs.Duration("refreshinterval", time.Minute, "")
+	workers := fs.Int("workers", 4, "")
+	origins := fs.String("corsorigins", "*", "")
+	grace := fs.Duration("grace", 30*time.Second, "")
+	fs.String("tlscert", "", "")
+	fs.String("tlskey", "", "")
+
+	if err := loadConfig(fs, []string{"-config", settings, "-listen", ":7000"}); err != nil {
+		t.Fatal(err)
+	}
+	if *listen != ":7000" {
+		t.Errorf("listen: flag should win, got %s", *listen)
+	}
+	if *workers != 2 {
+		t.Errorf("workers: environment should win over the file, got %d", *workers)
+	}
+	if *refresh != 5*time.Minute {
+		t.Errorf("refreshinterval: expected 5m from the file, got %v", *refresh)
+	}
+	if *origins != "https://a.com,https://b.com" {
+		t.Errorf("corsorigins: expected a joined list, got %s", *origins)
+	}
+	if *grace != 30*time.Second {
+		t.Errorf("grace: expected the default, got %v", *grace)
+	}
+}
+
+func TestLoadConfigNeedsCertAndKey(t *testing.T) {
+	newFlags := func() *flag.FlagSet {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.String("config", "", "")
+		fs.String("tlscert", "", "")
+		fs.String("tlskey", "", "")
+		return fs
+	}
+	if err := loadConfig(newFlags(), []string{"-config", "", "-tlscert", "cert.pem"}); err == nil {
+		t.Errorf("expected an error for a certificate without a key")
+	}
+	if err := loadConfig(newFlags(), []string{"-config", "", "-tlscert", "cert.pem", "-tlskey", "key.pem"}); err != nil {
+		t.Errorf("certificate and key given together: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/umpire"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// How long the events of a finished submission stay available to late
+// subscribers.
+const EVENT_HISTORY_TTL = 5 * time.Minute
+
+// eventBroker fans judging events out to the subscribers of each
+// submission. It keeps the events of queued submissions, from their
+// EventQueued on, so that a subscriber that connects late still sees
+// everything from the start; events of anything else, such as /run, are
+// only passed on.
+type eventBroker struct {
+	mu      sync.Mutex
+	history map[string][]*umpire.Event
+	subs    map[string]map[chan *umpire.Event]bool
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{
+		history: map[string][]*umpire.Event{},
+		subs:    map[string]map[chan *umpire.Event]bool{},
+	}
+}
+
+func (b *eventBroker) Publish(ev *umpire.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := ev.SubmissionId
+	if _, ok := b.history[id]; ok || ev.Type == umpire.EventQueued {
+		b.history[id] = append(b.history[id], ev)
+	}
+	for ch := range b.subs[id] {
+		select {
+		case ch <- ev:
+		default:
+			log.Warnf("Dropping %s event for slow subscriber of %s", ev.Type, id)
+		}
+	}
+	if ev.Type == umpire.EventResult {
+		b.expire(id)
+	}
+}
+
+// expire drops the history of id after EVENT_HISTORY_TTL. It is called
+// once no more events will follow: on the result, or when a queued job is
+// cancelled before it ran.
+func (b *eventBroker) expire(id string) {
+	time.AfterFunc(EVENT_HISTORY_TTL, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.history, id)
+	})
+}
+
+// Subscribe returns the events published so far for id and a channel
+// carrying the ones that follow. The caller must call cancel when done.
+func (b *eventBroker) Subscribe(id string) ([]*umpire.Event, <-chan *umpire.Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan *umpire.Event, 64)
+	if b.subs[id] == nil {
+		b.subs[id] = map[chan *umpire.Event]bool{}
+	}
+	b.subs[id][ch] = true
+	history := append([]*umpire.Event{}, b.history[id]...)
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[id], ch)
+		if len(b.subs[id]) == 0 {
+			delete(b.subs, id)
+		}
+	}
+	return history, ch, cancel
+}
+
+func writeEvent(c echo.Context, ev *umpire.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.Response(), "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+		return err
+	}
+	c.Response().Flush()
+	return nil
+}
+
+// submissionEvents streams a submission's progress as Server-Sent Events
+// until its result is known, the client goes away or the server shuts down.
+func (us *UmpireServer) submissionEvents(c echo.Context) error {
+	id := c.Param("id")
+	history, events, cancel := us.events.Subscribe(id)
+	defer cancel()
+	job, err := us.callerJob(c)
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	c.Response().WriteHeader(http.StatusOK)
+	if len(history) == 0 && job.Ended() {
+		return writeEvent(c, &umpire.Event{SubmissionId: id, Type: umpire.EventResult, Result: job.Result, Time: job.Finished})
+	}
+	for _, ev := range history {
+		if err := writeEvent(c, ev); err != nil || ev.Type == umpire.EventResult {
+			return err
+		}
+	}
+	for {
+		select {
+		case ev := <-events:
+			if err := writeEvent(c, ev); err != nil || ev.Type == umpire.EventResult {
+				return err
+			}
+		case <-c.Request().Context().Done():
+			return nil
+		case <-us.drain:
+			return nil
+		case <-us.ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/jobs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventBrokerReplaysHistory(t *testing.T) {
+	b := newEventBroker()
+	b.Publish(&umpire.Event{SubmissionId: "a", Type: umpire.EventQueued})
+	b.Publish(&umpire.Event{SubmissionId: "b", Type: umpire.EventQueued})
+	history, events, cancel := b.Subscribe("a")
+	defer cancel()
+	if len(history) != 1 || history[0].Type != umpire.EventQueued {
+		t.Fatalf("unexpected history: %v", history)
+	}
+	b.Publish(&umpire.Event{SubmissionId: "a", Type: umpire.EventTestcaseStarted, Testcase: 1})
+	if ev := <-events; ev.Type != umpire.EventTestcaseStarted || ev.Testcase != 1 {
+		t.Errorf("unexpected event: %#v", ev)
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("received event of another submission: %#v", ev)
+	default:
+	}
+}
+
+func TestSubmissionEventsForFinishedJob(t *testing.T) {
+	store := jobs.NewMemoryStore()
+	store.Put(&jobs.Job{Id: "done1", Uid: ANONYMOUS, State: jobs.Done, Result: &umpire.Response{Status: umpire.Pass}})
+	server := NewUmpireServer(&umpire.Agent{}, store, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	req, _ := http.NewRequest("GET", "/submissions/done1/events", nil)
+	rw := httptest.NewRecorder()
+	server.e.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("StatusCode: expected %d, got %d", http.StatusOK, rw.Code)
+	}
+	if !strings.HasPrefix(rw.Body.String(), "event: result\ndata: ") || !strings.Contains(rw.Body.String(), `"status":"pass"`) {
+		t.Errorf("unexpected body: %q", rw.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/submissions/missing/events", nil)
+	rw = httptest.NewRecorder()
+	server.e.ServeHTTP(rw, req)
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("StatusCode: expected %d, got %d", http.StatusNotFound, rw.Code)
+	}
+}
+
+func TestEventBrokerOnlyKeepsQueuedSubmissions(t *testing.T) {
+	b := newEventBroker()
+	b.Publish(&umpire.Event{SubmissionId: "run", Type: umpire.EventTestcaseStarted})
+	b.Publish(&umpire.Event{SubmissionId: "run", Type: umpire.EventResult})
+	b.Publish(&umpire.Event{SubmissionId: "job", Type: umpire.EventQueued})
+	b.Publish(&umpire.Event{SubmissionId: "job", Type: umpire.EventCompiling})
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.history["run"]; ok || len(b.history["job"]) != 2 {
+		t.Errorf("unexpected history %v", b.history)
+	}
+}
+
+func TestSubmissionEventsEndWhenDraining(t *testing.T) {
+	store := jobs.NewMemoryStore()
+	store.Put(&jobs.Job{Id: "queued1", Uid: ANONYMOUS, State: jobs.Queued, Payload: &umpire.Payload{}})
+	server := NewUmpireServer(&umpire.Agent{}, store, 0)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	done := make(chan struct{})
+	go func() {
+		req, _ := http.NewRequest("GET", "/submissions/queued1/events", nil)
+		server.e.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	close(server.drain)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("event stream still open after shutdown started")
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/jobs"
+	"github.com/maddyonline/umpire/pkg/umpirepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"math"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// JOB_POLL is how often a waiting Judge or JudgeProgress call checks the job
+// itself, in case its result event was missed, e.g. because it was cancelled.
+const JOB_POLL = 2 * time.Second
+
+// grpcPaths maps every RPC to the HTTP route it mirrors, so that -limits
+// applies to both APIs alike.
+var grpcPaths = map[string]string{
+	umpirepb.Umpire_Judge_FullMethodName:         "/judge",
+	umpirepb.Umpire_JudgeProgress_FullMethodName: "/judge",
+	umpirepb.Umpire_Run_FullMethodName:           "/run",
+	umpirepb.Umpire_Execute_FullMethodName:       "/execute",
+	umpirepb.Umpire_Validate_FullMethodName:      "/validate",
+}
+
+// grpcCaller is the authenticated caller of an RPC, kept in its context.
+type grpcCaller struct {
+	uid   string
+	roles []string
+}
+
+type grpcCallerKey struct{}
+
+func callerOf(ctx context.Context) *grpcCaller {
+	if c, ok := ctx.Value(grpcCallerKey{}).(*grpcCaller); ok {
+		return c
+	}
+	return &grpcCaller{uid: ANONYMOUS}
+}
+
+// NewGRPCServer serves the umpirepb.Umpire service with the same agent,
+// queue, credentials and limits as the HTTP API.
+func (us *UmpireServer) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.UnaryInterceptor(us.unaryInterceptor),
+		grpc.StreamInterceptor(us.streamInterceptor),
+	)
+	s := grpc.NewServer(opts...)
+	umpirepb.RegisterUmpireServer(s, &grpcService{us: us})
+	us.grpc = s
+	return s
+}
+
+// grpcServerOptions serves TLS when certFile is given, like -tlscert does
+// for HTTP.
+func grpcServerOptions(certFile, keyFile string) ([]grpc.ServerOption, error) {
+	if certFile == "" {
+		return nil, nil
+	}
+	creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return []grpc.ServerOption{grpc.Creds(creds)}, nil
+}
+
+// stopGRPC lets running RPCs finish until deadline, then cuts them off.
+func stopGRPC(s *grpc.Server, deadline time.Time) {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(deadline.Sub(time.Now())):
+		log.Warnf("Shutdown: grpc server: RPCs still running, stopping them")
+		s.Stop()
+	}
+}
+
+// grpcAuthenticate finds the caller from the x-api-key or authorization
+// metadata, just like authenticate does from HTTP headers.
+func (us *UmpireServer) grpcAuthenticate(ctx context.Context) (*grpcCaller, error) {
+	if us.auth == nil {
+		return &grpcCaller{uid: ANONYMOUS, roles: us.anonymousRoles()}, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get(strings.ToLower(API_KEY_HEADER)); len(keys) > 0 && keys[0] != "" {
+		owner, ok := us.auth.keyOwner(keys[0])
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "invalid API key")
+		}
+		return &grpcCaller{uid: owner.Uid, roles: owner.Roles}, nil
+	}
+	if headers := md.Get("authorization"); len(headers) > 0 && strings.HasPrefix(headers[0], "Bearer ") {
+		uid, roles, err := us.auth.tokenOwner(strings.TrimPrefix(headers[0], "Bearer "))
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+		}
+		return &grpcCaller{uid: uid, roles: roles}, nil
+	}
+	return nil, status.Error(codes.Unauthenticated, "missing credentials")
+}
+
+func exhausted(wait time.Duration, message string) error {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return status.Errorf(codes.ResourceExhausted, "%s, retry in %ds", message, seconds)
+}
+
+// admit applies to an RPC what the HTTP middleware applies to a request:
+// authentication, roles, rate limits, the execution quota and shutdown
+// tracking. The returned function must be called when the RPC ends.
+func (us *UmpireServer) admit(ctx context.Context, method string) (context.Context, func(), error) {
+	c, err := us.grpcAuthenticate(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if method == umpirepb.Umpire_Validate_FullMethodName && !holdsRole(c.roles, RoleProblemSetter) {
+		return nil, nil, status.Errorf(codes.PermissionDenied, "%s role required", RoleProblemSetter)
+	}
+	path := grpcPaths[method]
+	charged := path != "/judge"
+	if us.limits != nil {
+		now := time.Now()
+		ip := ""
+		if p, ok := peer.FromContext(ctx); ok {
+			ip, _, _ = net.SplitHostPort(p.Addr.String())
+		}
+		if ok, wait := us.limits.allow("ip|"+ip+"|"+path, rateFor(us.limits.Config.IP, path), now); !ok {
+			return nil, nil, exhausted(wait, "rate limit exceeded for this address")
+		}
+		rate := rateFor(us.limits.roleLimits(topRole(c.roles)).Endpoints, path)
+		if ok, wait := us.limits.allow("uid|"+c.uid+"|"+path, rate, now); !ok {
+			return nil, nil, exhausted(wait, "rate limit exceeded")
+		}
+		if ok, wait := us.limits.quotaLeft(c.uid, topRole(c.roles), now); !ok {
+			return nil, nil, exhausted(wait, "execution quota exhausted")
+		}
+	}
+	if atomic.LoadInt32(&us.draining) != 0 {
+		return nil, nil, status.Error(codes.Unavailable, "server is shutting down")
+	}
+	us.inflight.Add(1)
+	usage := &umpire.ContainerUsage{}
+	done := func() {
+		if us.limits != nil && charged {
+			us.limits.charge(c.uid, usage.Total())
+		}
+		us.inflight.Done()
+	}
+	ctx = umpire.WithContainerUsage(ctx, usage)
+	return context.WithValue(ctx, grpcCallerKey{}, c), done, nil
+}
+
+func (us *UmpireServer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, done, err := us.admit(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return handler(ctx, req)
+}
+
+// contextStream is a stream carrying the context admit returned.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func (us *UmpireServer) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, done, err := us.admit(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return handler(srv, &contextStream{ss, ctx})
+}
+
+// grpcError turns a validation error into a status with the code closest
+// to the HTTP status invalidRequest would answer with.
+func grpcError(err error) error {
+	verr, ok := err.(*umpire.ValidationError)
+	if !ok {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	code := codes.InvalidArgument
+	switch verr.Code {
+	case umpire.ErrCodeUnknownProblem:
+		code = codes.NotFound
+	case umpire.ErrCodeSourceTooLarge, umpire.ErrCodeStdinTooLarge, umpire.ErrCodeOutputTooLarge:
+		code = codes.ResourceExhausted
+	}
+	if verr.Field != "" {
+		return status.Errorf(code, "%s: %s: %s", verr.Code, verr.Field, verr.Message)
+	}
+	return status.Errorf(code, "%s: %s", verr.Code, verr.Message)
+}
+
+// grpcService implements umpirepb.UmpireServer on top of an UmpireServer.
+type grpcService struct {
+	umpirepb.UnimplementedUmpireServer
+	us *UmpireServer
+}
+
+// judge queues in as a judge job and passes its events to send until the
+// result. The job keeps running when the caller goes away, as a /judge
+// submission would, and stays queued across a restart.
+func (s *grpcService) judge(ctx context.Context, in *umpirepb.Payload, send func(*umpire.Event) error) error {
+	us := s.us
+	payload := umpirepb.ToPayload(in)
+	if payload == nil {
+		return status.Error(codes.InvalidArgument, "payload required")
+	}
+	if err := us.localAgent.ValidatePayload(payload, true); err != nil {
+		return grpcError(err)
+	}
+	log.Infof("grpc judge: %#v", payload)
+	job, err := us.jobs.Submit(callerOf(ctx).uid, payload, nil)
+	if err == jobs.ErrQueueFull || err == jobs.ErrQueueClosed {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	history, events, cancel := us.events.Subscribe(job.Id)
+	defer cancel()
+	us.events.Publish(&umpire.Event{SubmissionId: job.Id, Type: umpire.EventQueued, Time: job.Created})
+	for _, ev := range history {
+		if err := send(ev); err != nil || ev.Type == umpire.EventResult {
+			return err
+		}
+	}
+	poll := time.NewTicker(JOB_POLL)
+	defer poll.Stop()
+	for {
+		select {
+		case ev := <-events:
+			if err := send(ev); err != nil || ev.Type == umpire.EventResult {
+				return err
+			}
+		case <-poll.C:
+			if job, err := us.jobs.Get(job.Id); err == nil && job.Ended() {
+				if job.State == jobs.Cancelled {
+					return status.Errorf(codes.Aborted, "submission %s was cancelled", job.Id)
+				}
+				return send(&umpire.Event{SubmissionId: job.Id, Type: umpire.EventResult, Result: job.Result, Time: job.Finished})
+			}
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-us.ctx.Done():
+			return status.Errorf(codes.Unavailable, "server is shutting down, submission %s is judged after restart", job.Id)
+		}
+	}
+}
+
+func (s *grpcService) Judge(ctx context.Context, in *umpirepb.Payload) (*umpirepb.Response, error) {
+	var out *umpire.Response
+	err := s.judge(ctx, in, func(ev *umpire.Event) error {
+		if ev.Type == umpire.EventResult {
+			out = ev.Result
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		return nil, status.Error(codes.Aborted, "judgement ended without a result")
+	}
+	return umpirepb.FromResponse(out), nil
+}
+
+func (s *grpcService) JudgeProgress(in *umpirepb.Payload, stream umpirepb.Umpire_JudgeProgressServer) error {
+	return s.judge(stream.Context(), in, func(ev *umpire.Event) error {
+		return stream.Send(umpirepb.FromEvent(ev))
+	})
+}
+
+// payload converts and validates the payload of Run and Execute.
+func (s *grpcService) payload(in *umpirepb.Payload, needProblem bool) (*umpire.Payload, error) {
+	payload := umpirepb.ToPayload(in)
+	if payload == nil {
+		return nil, status.Error(codes.InvalidArgument, "payload required")
+	}
+	if err := s.us.localAgent.ValidatePayload(payload, needProblem); err != nil {
+		return nil, grpcError(err)
+	}
+	if payload.SubmissionId == "" {
+		payload.SubmissionId = umpire.RandStringRunes(16)
+	}
+	return payload, nil
+}
+
+// serverContext is ctx, also cancelled when shutdown gives up waiting.
+func (s *grpcService) serverContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-s.us.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+func (s *grpcService) Run(ctx context.Context, in *umpirepb.Payload) (*umpirepb.Response, error) {
+	payload, err := s.payload(in, true)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("grpc run: %#v", payload)
+	ctx, cancel := s.serverContext(ctx)
+	defer cancel()
+	return umpirepb.FromResponse(umpire.RunContext(ctx, s.us.localAgent, payload)), nil
+}
+
+func (s *grpcService) Execute(ctx context.Context, in *umpirepb.Payload) (*umpirepb.Response, error) {
+	payload, err := s.payload(in, false)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("grpc execute: %#v", payload)
+	ctx, cancel := s.serverContext(ctx)
+	defer cancel()
+	return umpirepb.FromResponse(umpire.ExecuteContext(ctx, s.us.localAgent, payload)), nil
+}
+
+func (s *grpcService) Validate(ctx context.Context, in *umpirepb.JudgeData) (*umpirepb.Response, error) {
+	jd := umpirepb.ToJudgeData(in)
+	if jd == nil {
+		return nil, status.Error(codes.InvalidArgument, "judge data required")
+	}
+	if err := s.us.localAgent.ValidateJudgeData(jd); err != nil {
+		return nil, grpcError(err)
+	}
+	ctx, cancel := s.serverContext(ctx)
+	defer cancel()
+	err, out := umpire.ValidateContext(ctx, s.us.localAgent, jd)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return umpirepb.FromResponse(out), nil
+}
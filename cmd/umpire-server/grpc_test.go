@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/umpirepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestGRPCChecksCallerAndPayload(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.auth = &AuthConfig{APIKeys: []*APIKey{
+		{Uid: "alice", Key: "alice-key"},
+		{Uid: "setter", Key: "setter-key", Roles: []string{RoleProblemSetter}},
+	}}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server.NewGRPCServer()
+	go s.Serve(lis)
+	defer s.Stop()
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := umpirepb.NewUmpireClient(conn)
+
+	as := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+	}
+	payload := &umpirepb.Payload{Language: "cobol", Files: []*umpirepb.File{{Name: "main.cob", Content: "x"}}}
+	tests := []struct {
+		name string
+		call func() error
+		code codes.Code
+	}{
+		{"no credentials", func() error {
+			_, err := client.Execute(context.Background(), payload)
+			return err
+		}, codes.Unauthenticated},
+		{"unknown key", func() error {
+			_, err := client.Execute(as("nope"), payload)
+			return err
+		}, codes.Unauthenticated},
+		{"unknown language", func() error {
+			_, err := client.Execute(as("alice-key"), payload)
+			return err
+		}, codes.InvalidArgument},
+		{"unknown problem", func() error {
+			_, err := client.Judge(as("alice-key"), &umpirepb.Payload{Language: "cpp", ProblemId: "nope", Files: []*umpirepb.File{{Name: "main.cpp", Content: "x"}}})
+			return err
+		}, codes.NotFound},
+		{"validate as submitter", func() error {
+			_, err := client.Validate(as("alice-key"), &umpirepb.JudgeData{})
+			return err
+		}, codes.PermissionDenied},
+		{"validate as problem setter", func() error {
+			_, err := client.Validate(as("setter-key"), &umpirepb.JudgeData{})
+			return err
+		}, codes.InvalidArgument},
+		{"progress without credentials", func() error {
+			stream, err := client.JudgeProgress(context.Background(), payload)
+			if err != nil {
+				return err
+			}
+			_, err = stream.Recv()
+			return err
+		}, codes.Unauthenticated},
+	}
+	for _, test := range tests {
+		if code := status.Code(test.call()); code != test.code {
+			t.Errorf("%s: expected %v, got %v", test.name, test.code, code)
+		}
+	}
+}
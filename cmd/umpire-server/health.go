@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/dockerutils"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// publicPaths are served without authentication or rate limits so that
+// load balancers, orchestrators and Prometheus can probe them.
+var publicPaths = map[string]bool{
+	"/healthz":      true,
+	"/readyz":       true,
+	"/metrics":      true,
+	"/openapi.json": true,
+}
+
+const READY_TIMEOUT = 5 * time.Second
+
+// IMAGES_CHECK_TTL is how long readyz reuses the outcome of the image check,
+// which inspects every configured image.
+const IMAGES_CHECK_TTL = 30 * time.Second
+
+var started = time.Now().UTC()
+
+// refreshStatus records the outcome of the last updateJudgeData.
+type refreshStatus struct {
+	mu       sync.RWMutex
+	time     time.Time
+	problems int
+	errors   []string
+}
+
+var lastRefresh = &refreshStatus{}
+
+func (r *refreshStatus) set(problems int, errors []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.time = time.Now().UTC()
+	r.problems = problems
+	r.errors = errors
+}
+
+func (r *refreshStatus) get() (time.Time, int, []string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.time, r.problems, r.errors
+}
+
+type check struct {
+	Name  string `json:"name"`
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// cachedCheck keeps the last outcome of a check that is too costly to run
+// on every probe.
+type cachedCheck struct {
+	mu   sync.Mutex
+	time time.Time
+	last *check
+}
+
+// get returns the last outcome if it is younger than ttl, otherwise runs
+// the check. Concurrent probes wait for one run instead of starting their own.
+func (cc *cachedCheck) get(ttl time.Duration, run func() *check) *check {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.last == nil || time.Since(cc.time) >= ttl {
+		cc.last = run()
+		cc.time = time.Now()
+	}
+	return cc.last
+}
+
+func (us *UmpireServer) healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyz reports whether this server can judge right now: docker answers,
+// every language image is present and problems are loaded.
+func (us *UmpireServer) readyz(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), READY_TIMEOUT)
+	defer cancel()
+	images := us.imagesCheck.get(IMAGES_CHECK_TTL, func() *check { return us.checkImages(ctx) })
+	checks := []*check{us.checkDocker(ctx), images, us.checkProblems()}
+	if atomic.LoadInt32(&us.draining) != 0 {
+		checks = append(checks, &check{Name: "serving", Error: "shutting down"})
+	}
+	ready := true
+	for _, ch := range checks {
+		ready = ready && ch.Ok
+	}
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, map[string]interface{}{"ready": ready, "checks": checks})
+}
+
+func (us *UmpireServer) checkDocker(ctx context.Context) *check {
+	ch := &check{Name: "docker"}
+	cli := us.localAgent.Client
+	if cli == nil {
+		ch.Error = "no docker client"
+		return ch
+	}
+	if machine := dockerutils.Machine(cli); machine != nil {
+		ch.Name = fmt.Sprintf("docker (%s)", machine.Name)
+	}
+	if _, err := cli.Ping(ctx); err != nil {
+		ch.Error = err.Error()
+		return ch
+	}
+	ch.Ok = true
+	return ch
+}
+
+func (us *UmpireServer) checkImages(ctx context.Context) *check {
+	ch := &check{Name: "images"}
+	if us.localAgent.Client == nil {
+		ch.Error = "no docker client"
+		return ch
+	}
+	missing := []string{}
+	for _, status := range umpire.NewImageManager(us.localAgent.Client, "").List(ctx) {
+		if !status.Present || status.Error != "" {
+			missing = append(missing, status.Image)
+		}
+	}
+	if len(missing) > 0 {
+		ch.Error = fmt.Sprintf("images not usable: %v", missing)
+		return ch
+	}
+	ch.Ok = true
+	return ch
+}
+
+func (us *UmpireServer) checkProblems() *check {
+	ch := &check{Name: "problems"}
+	if us.localAgent.Problems.Snapshot().Len() == 0 {
+		ch.Error = "no problems loaded"
+		return ch
+	}
+	ch.Ok = true
+	return ch
+}
+
+func (us *UmpireServer) debugStatus(c echo.Context) error {
+	refreshed, loaded, errors := lastRefresh.get()
+	snap := us.localAgent.Problems.Snapshot()
+	status := map[string]interface{}{
+		"started":          started,
+		"owner":            umpire.Owner,
+		"draining":         atomic.LoadInt32(&us.draining) != 0,
+		"problems":         snap.Len(),
+		"problems_version": snap.Version,
+		"last_refresh":     refreshed,
+		"refresh_problems": loaded,
+		"refresh_errors":   errors,
+		"problem_errors":   sources.errors(),
+	}
+	if cli := us.localAgent.Client; cli != nil {
+		ctx, cancel := context.WithTimeout(c.Request().Context(), READY_TIMEOUT)
+		defer cancel()
+		containers, err := umpire.RunningContainers(ctx, cli, umpire.Owner)
+		if err != nil {
+			status["containers_error"] = err.Error()
+		} else {
+			status["containers"] = len(containers)
+		}
+		if machine := dockerutils.Machine(cli); machine != nil {
+			status["docker_machine"] = machine.Name
+		}
+	}
+	return c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"github.com/maddyonline/umpire"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthAndReadiness(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	// Probes must work without credentials even when auth is on.
+	server.auth = &AuthConfig{APIKeys: []*APIKey{{Uid: "alice", Key: "k"}}}
+
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	rw := httptest.NewRecorder()
+	server.e.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Errorf("/healthz: StatusCode: expected %d, got %d", http.StatusOK, rw.Code)
+	}
+
+	req, _ = http.NewRequest("GET", "/readyz", nil)
+	rw = httptest.NewRecorder()
+	server.e.ServeHTTP(rw, req)
+	if rw.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz: StatusCode: expected %d, got %d", http.StatusServiceUnavailable, rw.Code)
+	}
+	for _, want := range []string{`"ready":false`, `no docker client`, `no problems loaded`} {
+		if !strings.Contains(rw.Body.String(), want) {
+			t.Errorf("/readyz: body %s does not contain %s", rw.Body.String(), want)
+		}
+	}
+
+	req, _ = http.NewRequest("GET", "/debug/status", nil)
+	rw = httptest.NewRecorder()
+	server.e.ServeHTTP(rw, req)
+	if rw.Code != http.StatusUnauthorized {
+		t.Errorf("/debug/status: StatusCode: expected %d, got %d", http.StatusUnauthorized, rw.Code)
+	}
+}
+
+func TestDebugStatusReportsRefresh(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{Problems: umpire.NewProblemStore(map[string]*umpire.JudgeData{"p": &umpire.JudgeData{}})}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.open = true
+	lastRefresh.set(1, []string{"serverdb: connection refused"})
+	req, _ := http.NewRequest("GET", "/debug/status", nil)
+	rw := httptest.NewRecorder()
+	server.e.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("StatusCode: expected %d, got %d", http.StatusOK, rw.Code)
+	}
+	for _, want := range []string{`"problems":1`, `"refresh_errors":["serverdb: connection refused"]`} {
+		if !strings.Contains(rw.Body.String(), want) {
+			t.Errorf("body %s does not contain %s", rw.Body.String(), want)
+		}
+	}
+}
+
+func TestMetricsArePublic(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.auth = &AuthConfig{APIKeys: []*APIKey{{Uid: "alice", Key: "k"}}}
+	countRefresh("problemsdir", nil)
+
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	rw := httptest.NewRecorder()
+	server.e.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("StatusCode: expected %d, got %d", http.StatusOK, rw.Code)
+	}
+	want := `umpire_problem_refreshes_total{result="ok",source="problemsdir"}`
+	if !strings.Contains(rw.Body.String(), want) {
+		t.Errorf("body does not contain %s", want)
+	}
+}
+
+func TestCachedCheckReusesRecentOutcome(t *testing.T) {
+	cc := &cachedCheck{}
+	runs := 0
+	run := func() *check {
+		runs++
+		return &check{Name: "images", Ok: true}
+	}
+	cc.get(time.Minute, run)
+	cc.get(time.Minute, run)
+	if runs != 1 {
+		t.Errorf("expected one run within the ttl, got %d", runs)
+	}
+	cc.get(0, run)
+	if runs != 2 {
+		t.Errorf("expected an expired outcome to be refreshed, got %d runs", runs)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/ratelimit"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ANY_ENDPOINT in an endpoint map applies to routes not listed explicitly.
+const ANY_ENDPOINT = "*"
+
+// Duration is a time.Duration written as a string such as "90s" in JSON.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Rate allows Requests requests per Window.
+type Rate struct {
+	Requests int64    `json:"requests"`
+	Window   Duration `json:"window"`
+}
+
+// RoleLimits are the limits of every caller holding a role. Endpoints are
+// keyed by route path without API_VERSION, e.g. "/execute".
+// ContainerSeconds is how long the caller's judge containers may run per
+// quota window; zero is unlimited.
+type RoleLimits struct {
+	Endpoints        map[string]*Rate `json:"endpoints"`
+	ContainerSeconds int64            `json:"container_seconds"`
+}
+
+// LimitsConfig is the content of the -limits file. IP limits apply to every
+// client address whoever the caller is; role limits apply per caller.
+// The client address is the connection's peer unless that peer is in one of
+// the TrustedProxies CIDRs, in which case X-Forwarded-For or X-Real-IP is
+// believed instead.
+type LimitsConfig struct {
+	IP             map[string]*Rate       `json:"ip"`
+	Roles          map[string]*RoleLimits `json:"roles"`
+	QuotaWindow    Duration               `json:"quota_window"`
+	TrustedProxies []string               `json:"trusted_proxies"`
+
+	proxies []*net.IPNet
+}
+
+func LoadLimitsConfig(filename string) (*LimitsConfig, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := &LimitsConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	if err := checkRates(config.IP); err != nil {
+		return nil, fmt.Errorf("ip: %v", err)
+	}
+	for _, cidr := range config.TrustedProxies {
+		_, proxy, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("trusted_proxies: %v", err)
+		}
+		config.proxies = append(config.proxies, proxy)
+	}
+	for role, limits := range config.Roles {
+		if _, ok := roleRank[role]; !ok {
+			return nil, fmt.Errorf("unknown role %q", role)
+		}
+		if err := checkRates(limits.Endpoints); err != nil {
+			return nil, fmt.Errorf("roles.%s: %v", role, err)
+		}
+		if limits.ContainerSeconds > 0 && config.QuotaWindow.Duration <= 0 {
+			return nil, fmt.Errorf("roles.%s: container_seconds needs a quota_window", role)
+		}
+	}
+	return config, nil
+}
+
+func checkRates(rates map[string]*Rate) error {
+	for path, rate := range rates {
+		if rate.Requests > 0 && rate.Window.Duration <= 0 {
+			return fmt.Errorf("%s: window must be positive", path)
+		}
+	}
+	return nil
+}
+
+func rateFor(rates map[string]*Rate, path string) *Rate {
+	if rate, ok := rates[path]; ok {
+		return rate
+	}
+	return rates[ANY_ENDPOINT]
+}
+
+// Limiter enforces a LimitsConfig with counters kept in Store.
+type Limiter struct {
+	Config *LimitsConfig
+	Store  ratelimit.Store
+}
+
+func NewLimiter(config *LimitsConfig, store ratelimit.Store) *Limiter {
+	if store == nil {
+		store = ratelimit.NewMemoryStore()
+	}
+	return &Limiter{Config: config, Store: store}
+}
+
+// allow counts one request against rate and returns how long to wait when
+// the rate is exceeded.
+func (l *Limiter) allow(key string, rate *Rate, now time.Time) (bool, time.Duration) {
+	if rate == nil || rate.Requests <= 0 {
+		return true, 0
+	}
+	key = fmt.Sprintf("%s|%v", key, rate.Window.Duration)
+	count, reset, err := l.Store.Add(key, 1, rate.Window.Duration, now)
+	if err != nil {
+		log.Warnf("Rate limit store: %v", err)
+		return true, 0
+	}
+	return count <= rate.Requests, reset.Sub(now)
+}
+
+func (l *Limiter) roleLimits(role string) *RoleLimits {
+	if limits, ok := l.Config.Roles[role]; ok {
+		return limits
+	}
+	return &RoleLimits{}
+}
+
+func quotaKey(uid string) string {
+	return "quota|" + uid
+}
+
+// quotaLeft reports whether uid, holding role, has container time left in
+// the current quota window, and when the window ends.
+func (l *Limiter) quotaLeft(uid, role string, now time.Time) (bool, time.Duration) {
+	limit := l.roleLimits(role).ContainerSeconds
+	if limit <= 0 {
+		return true, 0
+	}
+	used, reset, err := l.Store.Get(quotaKey(uid), l.Config.QuotaWindow.Duration, now)
+	if err != nil {
+		log.Warnf("Rate limit store: %v", err)
+		return true, 0
+	}
+	return used < limit, reset.Sub(now)
+}
+
+// clientIP is the address IP limits apply to. Forwarding headers are only
+// believed from a trusted proxy, as anyone else could pick a fresh address
+// for every request.
+func (l *Limiter) clientIP(c echo.Context) string {
+	host, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+	if err != nil {
+		host = c.Request().RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		for _, proxy := range l.Config.proxies {
+			if proxy.Contains(ip) {
+				return c.RealIP()
+			}
+		}
+	}
+	return host
+}
+
+// charge adds the container time of a finished execution to uid's quota.
+func (l *Limiter) charge(uid string, elapsed time.Duration) {
+	if l.Config.QuotaWindow.Duration <= 0 {
+		return
+	}
+	seconds := int64(math.Ceil(elapsed.Seconds()))
+	if _, _, err := l.Store.Add(quotaKey(uid), seconds, l.Config.QuotaWindow.Duration, time.Now()); err != nil {
+		log.Warnf("Rate limit store: %v", err)
+	}
+}
+
+func tooManyRequests(c echo.Context, wait time.Duration, message string) error {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Response().Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	return echo.NewHTTPError(http.StatusTooManyRequests, message)
+}
+
+// callerRole is the most privileged role of the caller.
+func callerRole(c echo.Context) string {
+	roles, _ := c.Get(ROLES_KEY).([]string)
+	return topRole(roles)
+}
+
+// topRole is the most privileged of roles, submitter when there are none.
+func topRole(roles []string) string {
+	best := RoleSubmitter
+	for _, role := range roles {
+		if roleRank[role] > roleRank[best] {
+			best = role
+		}
+	}
+	return best
+}
+
+// limit applies the per-IP and per-caller request rates. It must run after
+// authenticate.
+func (us *UmpireServer) limit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if us.limits == nil || publicPaths[routePath(c)] {
+			return next(c)
+		}
+		now := time.Now()
+		path := routePath(c)
+		if ok, wait := us.limits.allow("ip|"+us.limits.clientIP(c)+"|"+path, rateFor(us.limits.Config.IP, path), now); !ok {
+			return tooManyRequests(c, wait, "rate limit exceeded for this address")
+		}
+		rate := rateFor(us.limits.roleLimits(callerRole(c)).Endpoints, path)
+		if ok, wait := us.limits.allow("uid|"+caller(c)+"|"+path, rate, now); !ok {
+			return tooManyRequests(c, wait, "rate limit exceeded")
+		}
+		return next(c)
+	}
+}
+
+// USAGE_KEY holds the *umpire.ContainerUsage of requests charged by quota.
+const USAGE_KEY = "usage"
+
+// quota turns callers away once their container time for the quota window
+// is used up. With charge set, the time the request's containers ran is
+// added to the caller's usage; queued judgements are charged when their job
+// runs.
+func (us *UmpireServer) quota(charge bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if us.limits == nil {
+				return next(c)
+			}
+			if ok, wait := us.limits.quotaLeft(caller(c), callerRole(c), time.Now()); !ok {
+				return tooManyRequests(c, wait, "execution quota exhausted")
+			}
+			if !charge {
+				return next(c)
+			}
+			usage := &umpire.ContainerUsage{}
+			c.Set(USAGE_KEY, usage)
+			defer func() {
+				us.limits.charge(caller(c), usage.Total())
+			}()
+			return next(c)
+		}
+	}
+}
+
+// execContext is the context to run the request's containers with: the
+// server's, so they are only cancelled by shutdown, metered for quota.
+func (us *UmpireServer) execContext(c echo.Context) context.Context {
+	if usage, ok := c.Get(USAGE_KEY).(*umpire.ContainerUsage); ok {
+		return umpire.WithContainerUsage(us.ctx, usage)
+	}
+	return us.ctx
+}
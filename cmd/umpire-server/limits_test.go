@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/maddyonline/umpire"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitReturns429(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.limits = NewLimiter(&LimitsConfig{
+		Roles: map[string]*RoleLimits{
+			RoleSubmitter: {Endpoints: map[string]*Rate{ANY_ENDPOINT: {Requests: 2, Window: Duration{time.Hour}}}},
+		},
+	}, nil)
+	codes := []int{}
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "/submissions/missing", nil)
+		rw := httptest.NewRecorder()
+		server.e.ServeHTTP(rw, req)
+		codes = append(codes, rw.Code)
+		if rw.Code == http.StatusTooManyRequests && rw.Header().Get("Retry-After") == "" {
+			t.Errorf("429 without Retry-After")
+		}
+	}
+	if codes[0] != http.StatusNotFound || codes[1] != http.StatusNotFound || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("unexpected status codes %v", codes)
+	}
+}
+
+func TestQuotaExhausted(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.limits = NewLimiter(&LimitsConfig{
+		Roles:       map[string]*RoleLimits{RoleSubmitter: {ContainerSeconds: 60}},
+		QuotaWindow: Duration{time.Hour},
+	}, nil)
+	server.limits.charge(ANONYMOUS, 61*time.Second)
+	rw := httptest.NewRecorder()
+	server.e.ServeHTTP(rw, jsonPostRequest(t, "/judge", []byte(`{}`)))
+	if rw.Code != http.StatusTooManyRequests {
+		t.Errorf("StatusCode: expected %d, got %d", http.StatusTooManyRequests, rw.Code)
+	}
+	if rw.Header().Get("Retry-After") == "" {
+		t.Errorf("429 without Retry-After")
+	}
+}
+
+func TestIPLimitTrustsForwardingOnlyFromProxies(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.limits = NewLimiter(&LimitsConfig{
+		IP:      map[string]*Rate{ANY_ENDPOINT: {Requests: 1, Window: Duration{time.Hour}}},
+		proxies: []*net.IPNet{{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)}},
+	}, nil)
+	get := func(remote, forwarded string) int {
+		req, _ := http.NewRequest("GET", "/submissions/missing", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", forwarded)
+		rw := httptest.NewRecorder()
+		server.e.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	// A client that is not a proxy cannot dodge the limit by rotating the header.
+	if get("192.0.2.1:1000", "198.51.100.1") != http.StatusNotFound || get("192.0.2.1:1001", "198.51.100.2") != http.StatusTooManyRequests {
+		t.Errorf("X-Forwarded-For from an untrusted peer was believed")
+	}
+	// Behind a trusted proxy every forwarded client gets its own budget.
+	if get("10.0.0.5:1000", "198.51.100.3") != http.StatusNotFound || get("10.0.0.5:1001", "198.51.100.4") != http.StatusNotFound {
+		t.Errorf("X-Forwarded-For from a trusted proxy was ignored")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var problemRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "umpire",
+	Name:      "problem_refreshes_total",
+	Help:      "Problem source reads by updateJudgeData, by source and result.",
+}, []string{"source", "result"})
+
+func init() {
+	prometheus.MustRegister(problemRefreshes)
+}
+
+func countRefresh(source string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	problemRefreshes.WithLabelValues(source, result).Inc()
+}
+
+// registerServerMetrics exposes gauges read from the running server. It is
+// called once, from main.
+func registerServerMetrics(us *UmpireServer) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "umpire",
+			Name:      "queue_depth",
+			Help:      "Single judge jobs waiting for a worker.",
+		}, func() float64 { return float64(us.jobs.Pending()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "umpire",
+			Name:      "background_queue_depth",
+			Help:      "Batch jobs, rejudges included, waiting for a worker to be free of single jobs.",
+		}, func() float64 { return float64(us.jobs.Background()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "umpire",
+			Name:      "problems_loaded",
+			Help:      "Problems available for judging.",
+		}, func() float64 { return float64(us.localAgent.Problems.Snapshot().Len()) }),
+	)
+}
@@ -29,7 +29,7 @@ int main() {
 }`
 
 var payloadExample = &umpire.Payload{
-	Problem:  &umpire.Problem{"maddyonline/problems/problem-1"},
+	Problem:  &umpire.Problem{Id: "maddyonline/problems/problem-1"},
 	Language: "cpp",
 	Files: []*umpire.InMemoryFile{
 		&umpire.InMemoryFile{
@@ -74,6 +74,7 @@ func exampleDockerJudgeMulti() error {
 	}
 	var wg sync.WaitGroup
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	errors := make(chan error)
 	for i := 0; i < 30; i++ {
 		wg.Add(1)
@@ -125,7 +126,7 @@ func exampleRunAndJudge() error {
 		log.Fatalf("%v", err)
 		return err
 	}
-	u := &umpire.Agent{cli, problemsDir, nil}
+	u := &umpire.Agent{Client: cli, ProblemsDir: problemsDir}
 	err = u.RunAndJudge(context.Background(), payloadExample, os.Stdout, ioutil.Discard)
 	log.Printf("In main, got: %v", err)
 	return nil
@@ -142,7 +143,7 @@ func exampleJudgeAll() error {
 		log.Fatalf("%v", err)
 		return err
 	}
-	u := &umpire.Agent{cli, problemsDir, nil}
+	u := &umpire.Agent{Client: cli, ProblemsDir: problemsDir}
 	err = u.JudgeAll(context.Background(), payloadExample, ioutil.Discard, ioutil.Discard)
 	log.Printf("In main, got: %v", err)
 	return err
@@ -158,7 +159,7 @@ func run() error {
 		log.Fatalf("%v", err)
 		return err
 	}
-	u := &umpire.Agent{cli, problemsDir, nil}
+	u := &umpire.Agent{Client: cli, ProblemsDir: problemsDir}
 	out := umpire.RunDefault(u, payloadExample)
 	fmt.Printf("out=%v\n", out)
 	return nil
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/jobs"
+	"github.com/maddyonline/umpire/pkg/submissions"
+	"github.com/maddyonline/umpire/pkg/webhooks"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// apiOperation describes one route of the API for the OpenAPI document.
+// Request and Response are values of the Go types bound from and written
+// to the body, so the document follows the types as they change.
+type apiOperation struct {
+	Method  string
+	Path    string // in echo syntax, without API_VERSION
+	Summary string
+	// Role is the least role needed beyond submitter, if any.
+	Role     string
+	Query    map[string]string // query parameters and their descriptions
+	Request  interface{}
+	Upload   []string // content types of a body of files, instead of a JSON Request
+	Status   int
+	Response interface{}
+	// ContentType of the response when it is not JSON.
+	ContentType string
+	// Validates is set for operations that reject invalid payloads with a
+	// ValidationError.
+	Validates bool
+}
+
+// object stands for the free-form JSON objects of the operational routes.
+type object map[string]interface{}
+
+// apiOperations must list every route registered with api; the contract
+// tests check they do.
+var apiOperations = []*apiOperation{
+	{Method: "POST", Path: "/judge", Summary: "Queue a submission for judging", Request: judgeRequest{}, Status: http.StatusAccepted, Response: submissionRef{}, Validates: true},
+	{Method: "POST", Path: "/run", Summary: "Run a submission and the problem's reference solution on stdin and compare their output", Request: umpire.Payload{}, Status: http.StatusOK, Response: umpire.Response{}, Validates: true},
+	{Method: "POST", Path: "/validate", Summary: "Check that a problem's solution passes its testcases", Role: RoleProblemSetter, Request: umpire.JudgeData{}, Status: http.StatusOK, Response: umpire.Response{}, Validates: true},
+	{Method: "POST", Path: "/execute", Summary: "Run code on the given stdin", Request: umpire.Payload{}, Status: http.StatusOK, Response: umpire.Response{}, Validates: true},
+	{Method: "POST", Path: "/batches", Summary: "Queue many judgements at once", Request: batchRequest{}, Status: http.StatusAccepted, Response: batchRef{}, Validates: true},
+	{Method: "GET", Path: "/batches/:id", Summary: "Progress of a batch", Status: http.StatusOK, Response: batchStatus{}},
+	{Method: "GET", Path: "/batches/:id/results", Summary: "Results of a complete batch, one JSON object per line", Status: http.StatusOK, Response: batchResult{}, ContentType: "application/x-ndjson"},
+	{Method: "DELETE", Path: "/batches/:id", Summary: "Cancel the judgements of a batch that have not finished", Status: http.StatusOK, Response: batchStatus{}},
+	{Method: "GET", Path: "/submissions", Summary: "Judged submissions, newest first", Query: map[string]string{"uid": "only this user's, admins only", "problem": "only this problem's", "status": "pass or fail: only those whose latest verdict this is", "since": "only those submitted at or after this RFC 3339 time", "until": "only those submitted before this RFC 3339 time", "limit": "at most this many, 50 by default"}, Status: http.StatusOK, Response: []*submissions.Submission{}},
+	{Method: "GET", Path: "/submissions/:id", Summary: "State and result of a queued submission", Status: http.StatusOK, Response: jobs.Job{}},
+	{Method: "DELETE", Path: "/submissions/:id", Summary: "Cancel a queued submission", Status: http.StatusOK, Response: submissionRef{}},
+	{Method: "GET", Path: "/submissions/:id/events", Summary: "Judging progress as Server-Sent Events", Status: http.StatusOK, Response: umpire.Event{}, ContentType: "text/event-stream"},
+	{Method: "GET", Path: "/submissions/:id/deliveries", Summary: "Attempts to deliver the result to the callback and serverdb", Status: http.StatusOK, Response: []*webhooks.Delivery{}},
+	{Method: "GET", Path: "/debug/status", Summary: "Problems, containers and the last problem refresh", Role: RoleAdmin, Status: http.StatusOK, Response: object{}},
+	{Method: "POST", Path: "/admin/reload", Summary: "Read every problem source again", Role: RoleAdmin, Status: http.StatusOK, Response: object{}},
+	{Method: "GET", Path: "/problems", Summary: "Loaded problems", Status: http.StatusOK, Response: []*problemSummary{}},
+	{Method: "GET", Path: "/problems/:id", Summary: "A problem, reference solution included", Role: RoleProblemSetter, Status: http.StatusOK, Response: umpire.JudgeData{}},
+	{Method: "PUT", Path: "/problems/:id", Summary: "Publish a problem", Role: RoleProblemSetter, Request: umpire.JudgeData{}, Status: http.StatusOK, Response: problemSummary{}, Validates: true},
+	{Method: "DELETE", Path: "/problems/:id", Summary: "Delete a published problem", Role: RoleProblemSetter, Status: http.StatusNoContent},
+	{Method: "POST", Path: "/problems/:id/testcases", Summary: "Upload testcases as a zip archive or multipart files", Role: RoleProblemSetter, Query: map[string]string{"replace": "true to replace the testcases instead of adding to them"}, Upload: []string{"multipart/form-data", "application/zip"}, Status: http.StatusOK, Response: problemSummary{}, Validates: true},
+	{Method: "POST", Path: "/problems/:id/rejudge", Summary: "Judge a problem's stored submissions again, in the background", Role: RoleProblemSetter, Request: rejudgeRequest{}, Status: http.StatusAccepted, Response: rejudgeRef{}},
+}
+
+// errorMessage is the body of errors other than validation errors.
+type errorMessage struct {
+	Message string `json:"message"`
+}
+
+// enums lists the values of the string types that have a fixed set.
+var enums = map[reflect.Type][]string{
+	reflect.TypeOf(umpire.Decision("")):  {string(umpire.Pass), string(umpire.Fail)},
+	reflect.TypeOf(umpire.EventType("")): {string(umpire.EventQueued), string(umpire.EventCompiling), string(umpire.EventTestcaseStarted), string(umpire.EventTestcaseFinished), string(umpire.EventResult)},
+	reflect.TypeOf(jobs.State("")):       {string(jobs.Queued), string(jobs.Running), string(jobs.Done), string(jobs.Cancelled)},
+	reflect.TypeOf(umpire.DiffOp("")):    {string(umpire.DiffEqual), string(umpire.DiffChanged), string(umpire.DiffExtra), string(umpire.DiffMissing)},
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaSet collects the named schemas referenced by the document.
+type schemaSet struct {
+	schemas map[string]interface{}
+	types   map[string]reflect.Type
+}
+
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// of returns the JSON schema of values of t as encoding/json writes them.
+// Named structs are added to the set and referenced.
+func (s *schemaSet) of(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case enums[t] != nil:
+		return map[string]interface{}{"type": "string", "enum": enums[t]}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.of(t.Elem())
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name := schemaName(t)
+		if other, ok := s.types[name]; ok && other != t {
+			panic(fmt.Sprintf("openapi: %v and %v are both called %s", other, t, name))
+		}
+		if _, ok := s.types[name]; !ok {
+			s.types[name] = t
+			s.schemas[name] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+// object is the schema of a struct: its JSON fields, those of embedded
+// structs included, with the ones always written listed as required.
+func (s *schemaSet) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if f.Anonymous && parts[0] == "" && ft.Kind() == reflect.Struct {
+				add(ft)
+				continue
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+			name := parts[0]
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = s.of(f.Type)
+			omitempty := false
+			for _, opt := range parts[1:] {
+				omitempty = omitempty || opt == "omitempty"
+			}
+			if !omitempty {
+				required = append(required, name)
+			}
+		}
+	}
+	add(t)
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// openAPIPath turns an echo route into an OpenAPI path template.
+func openAPIPath(path string) (string, []string) {
+	params := []string{}
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			params = append(params, part[1:])
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return API_VERSION + strings.Join(parts, "/"), params
+}
+
+// operationId names an operation after its route, e.g. getSubmissionsIdEvents
+// for GET /submissions/:id/events.
+func operationId(method, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.Split(path, "/") {
+		part = strings.TrimPrefix(part, ":")
+		if part != "" {
+			id += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return id
+}
+
+func content(contentType string, schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{contentType: map[string]interface{}{"schema": schema}}
+}
+
+// binary is the schema of a file.
+var binary = map[string]interface{}{"type": "string", "format": "binary"}
+
+// uploadContent describes a body of files in each of contentTypes: the file
+// itself, or for forms any number of file fields.
+func uploadContent(contentTypes []string) map[string]interface{} {
+	uploads := map[string]interface{}{}
+	for _, contentType := range contentTypes {
+		schema := binary
+		if contentType == "multipart/form-data" {
+			schema = map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "array", "items": binary}}
+		}
+		uploads[contentType] = map[string]interface{}{"schema": schema}
+	}
+	return uploads
+}
+
+// openAPIDocument describes the versioned API.
+func openAPIDocument() map[string]interface{} {
+	s := &schemaSet{schemas: map[string]interface{}{}, types: map[string]reflect.Type{}}
+	errorSchema := s.of(reflect.TypeOf(errorMessage{}))
+	validationSchema := s.of(reflect.TypeOf(umpire.ValidationError{}))
+	paths := map[string]interface{}{}
+	for _, op := range apiOperations {
+		path, params := openAPIPath(op.Path)
+		operation := map[string]interface{}{
+			"summary":     op.Summary,
+			"operationId": operationId(op.Method, op.Path),
+		}
+		if op.Role != "" {
+			operation["description"] = fmt.Sprintf("Needs the %s role.", op.Role)
+		}
+		parameters := []interface{}{}
+		for _, name := range params {
+			parameters = append(parameters, map[string]interface{}{"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}})
+		}
+		query := []string{}
+		for name := range op.Query {
+			query = append(query, name)
+		}
+		sort.Strings(query)
+		for _, name := range query {
+			parameters = append(parameters, map[string]interface{}{"name": name, "in": "query", "description": op.Query[name], "schema": map[string]interface{}{"type": "string"}})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+		if op.Request != nil {
+			operation["requestBody"] = map[string]interface{}{"required": true, "content": content("application/json", s.of(reflect.TypeOf(op.Request)))}
+		}
+		if len(op.Upload) > 0 {
+			operation["requestBody"] = map[string]interface{}{"required": true, "content": uploadContent(op.Upload)}
+		}
+		success := map[string]interface{}{"description": http.StatusText(op.Status)}
+		if op.Response != nil {
+			contentType := op.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			success["content"] = content(contentType, s.of(reflect.TypeOf(op.Response)))
+		}
+		responses := map[string]interface{}{
+			fmt.Sprint(op.Status): success,
+			"default":             map[string]interface{}{"description": "Error", "content": content("application/json", errorSchema)},
+		}
+		if op.Validates {
+			responses["4XX"] = map[string]interface{}{
+				"description": "Invalid request",
+				"content":     content("application/json", map[string]interface{}{"oneOf": []interface{}{validationSchema, errorSchema}}),
+			}
+		}
+		operation["responses"] = responses
+		methods, ok := paths[path].(map[string]interface{})
+		if !ok {
+			methods = map[string]interface{}{}
+			paths[path] = methods
+		}
+		methods[strings.ToLower(op.Method)] = operation
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "umpire",
+			"version": strings.TrimPrefix(API_VERSION, "/"),
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": s.schemas,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": API_KEY_HEADER},
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"apiKey": []string{}},
+			map[string]interface{}{"bearer": []string{}},
+		},
+	}
+}
+
+// openAPIJSON is openAPIDocument as served, built once.
+var openAPIJSON = func() []byte {
+	data, err := json.MarshalIndent(openAPIDocument(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return append(data, '\n')
+}()
+
+func (us *UmpireServer) openAPI(c echo.Context) error {
+	return c.JSONBlob(http.StatusOK, openAPIJSON)
+}
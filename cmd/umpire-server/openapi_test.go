@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"github.com/maddyonline/umpire"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// OPENAPI_FILE is the published copy of the OpenAPI document.
+const OPENAPI_FILE = "../../api/openapi.json"
+
+var update = flag.Bool("update", false, "rewrite "+OPENAPI_FILE+" from the Go types")
+
+// TestOpenAPIMatchesPublished fails when the API types drift from the
+// published document. Review the difference, then run
+// go test -run TestOpenAPIMatchesPublished -update to publish the change.
+func TestOpenAPIMatchesPublished(t *testing.T) {
+	if *update {
+		if err := ioutil.WriteFile(OPENAPI_FILE, openAPIJSON, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	published, err := ioutil.ReadFile(OPENAPI_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(published, openAPIJSON) {
+		t.Errorf("the API no longer matches %s; if the change is intended, run go test -run TestOpenAPIMatchesPublished -update", OPENAPI_FILE)
+	}
+}
+
+// TestOpenAPICoversRoutes fails when a versioned route is missing from the
+// document or the document lists a route that does not exist.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	routes := []string{}
+	for _, r := range server.e.Routes() {
+		if strings.HasPrefix(r.Path, API_VERSION+"/") {
+			routes = append(routes, r.Method+" "+strings.TrimPrefix(r.Path, API_VERSION))
+		}
+	}
+	documented := []string{}
+	for _, op := range apiOperations {
+		documented = append(documented, op.Method+" "+op.Path)
+	}
+	sort.Strings(routes)
+	sort.Strings(documented)
+	if strings.Join(routes, "\n") != strings.Join(documented, "\n") {
+		t.Errorf("routes:\n%s\ndocumented:\n%s", strings.Join(routes, "\n"), strings.Join(documented, "\n"))
+	}
+}
+
+func TestOpenAPIResponseSchema(t *testing.T) {
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(openAPIJSON, &doc); err != nil {
+		t.Fatal(err)
+	}
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	response := schemas["Response"].(map[string]interface{})
+	for _, name := range []string{"status", "details", "stdout", "stderr", "problem_version"} {
+		if _, ok := response["properties"].(map[string]interface{})[name]; !ok {
+			t.Errorf("Response has no %s property", name)
+		}
+	}
+	for _, name := range response["required"].([]interface{}) {
+		if name == "stdout" || name == "stderr" {
+			t.Errorf("%s should be optional", name)
+		}
+	}
+}
+
+func TestOpenAPITestcaseUpload(t *testing.T) {
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(openAPIJSON, &doc); err != nil {
+		t.Fatal(err)
+	}
+	upload := doc["paths"].(map[string]interface{})[API_VERSION+"/problems/{id}/testcases"].(map[string]interface{})["post"].(map[string]interface{})
+	body, ok := upload["requestBody"].(map[string]interface{})
+	if !ok {
+		t.Fatal("POST /problems/:id/testcases has no requestBody")
+	}
+	for _, contentType := range []string{"multipart/form-data", "application/zip"} {
+		if _, ok := body["content"].(map[string]interface{})[contentType]; !ok {
+			t.Errorf("requestBody has no %s content", contentType)
+		}
+	}
+}
+
+func TestVersionedRoutesAndAliases(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.auth = &AuthConfig{APIKeys: []*APIKey{{Uid: "alice", Key: "a"}}}
+	for _, path := range []string{"/v1/problems", "/problems"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set(API_KEY_HEADER, "a")
+		rw := httptest.NewRecorder()
+		server.e.ServeHTTP(rw, req)
+		if rw.Code != http.StatusOK {
+			t.Errorf("%s: StatusCode: expected %d, got %d", path, http.StatusOK, rw.Code)
+		}
+	}
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	rw := httptest.NewRecorder()
+	server.e.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK || !bytes.Equal(rw.Body.Bytes(), openAPIJSON) {
+		t.Errorf("/openapi.json: StatusCode %d, expected the document without credentials", rw.Code)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/problems"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MAX_UPLOAD bounds testcase uploads, zipped or not.
+const MAX_UPLOAD = 64 << 20
+
+type problemSummary struct {
+	Id        string `json:"id"`
+	Language  string `json:"language,omitempty"`
+	Testcases int    `json:"testcases"`
+	// Published is set for problems stored through the API, as opposed to
+	// those read from -problemsdir, the cache file or -serverdb.
+	Published bool `json:"published"`
+}
+
+type problemSummaries []*problemSummary
+
+func (a problemSummaries) Len() int           { return len(a) }
+func (a problemSummaries) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a problemSummaries) Less(i, j int) bool { return a[i].Id < a[j].Id }
+
+func summarize(id string, jd *umpire.JudgeData, published bool) *problemSummary {
+	summary := &problemSummary{Id: id, Testcases: len(jd.IO), Published: published}
+	if jd.Solution != nil {
+		summary.Language = jd.Solution.Language
+	}
+	return summary
+}
+
+// publish stores jd as id, or deletes id when jd is nil, and makes the
+// change visible to judgements straight away, without waiting for the next
+// refresh.
+func (us *UmpireServer) publish(id string, jd *umpire.JudgeData) error {
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	return us.publishLocked(id, jd)
+}
+
+// publishLocked is publish for callers already holding publishMu.
+func (us *UmpireServer) publishLocked(id string, jd *umpire.JudgeData) error {
+	if jd == nil {
+		if err := us.problems.Delete(id); err != nil {
+			return err
+		}
+		us.localAgent.Problems.Delete(id)
+		return nil
+	}
+	if err := us.problems.Put(id, jd); err != nil {
+		return err
+	}
+	us.localAgent.Problems.Put(id, jd)
+	return nil
+}
+
+func (us *UmpireServer) listProblems(c echo.Context) error {
+	published, err := us.problems.List()
+	if err != nil {
+		return err
+	}
+	summaries := problemSummaries{}
+	for id, jd := range us.localAgent.Problems.Snapshot().Problems() {
+		_, ok := published[id]
+		summaries = append(summaries, summarize(id, jd, ok))
+	}
+	sort.Sort(summaries)
+	return c.JSON(http.StatusOK, summaries)
+}
+
+func (us *UmpireServer) getProblem(c echo.Context) error {
+	jd := us.localAgent.Problems.Snapshot().Get(c.Param("id"))
+	if jd == nil {
+		return echo.NewHTTPError(http.StatusNotFound, problems.ErrNotFound.Error())
+	}
+	return c.JSON(http.StatusOK, jd)
+}
+
+func (us *UmpireServer) putProblem(c echo.Context) error {
+	id := c.Param("id")
+	if verr := umpire.CheckProblemId("id", id); verr != nil {
+		return invalidRequest(c, verr)
+	}
+	jd := &umpire.JudgeData{}
+	if err := c.Bind(jd); err != nil {
+		return err
+	}
+	if err := us.localAgent.ValidateJudgeData(jd); err != nil {
+		return invalidRequest(c, err)
+	}
+	if err := us.publish(id, jd); err != nil {
+		return err
+	}
+	c.Logger().Infof("Problem %s published by %s", id, caller(c))
+	return c.JSON(http.StatusOK, summarize(id, jd, true))
+}
+
+func (us *UmpireServer) deleteProblem(c echo.Context) error {
+	id := c.Param("id")
+	err := us.publish(id, nil)
+	if err == problems.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound, "Problem was not published through the API")
+	}
+	if err != nil {
+		return err
+	}
+	c.Logger().Infof("Problem %s deleted by %s", id, caller(c))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// uploadTestcases adds testcases to a published problem, or replaces its
+// testcases with ?replace=true. The body is either a zip archive or a
+// multipart form whose files, zip archives included, are the testcases.
+// Testcases are paired by name as in problem directories: "input1.txt" goes
+// with "output1.txt". Together the files may expand to MAX_UPLOAD bytes.
+func (us *UmpireServer) uploadTestcases(c echo.Context) error {
+	id := c.Param("id")
+	up := &upload{files: map[string]string{}, left: MAX_UPLOAD}
+	var err error
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), "application/zip") {
+		err = up.readZip(c.Request().Body)
+	} else {
+		err = up.readMultipart(c)
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	testcases, err := pairTestcases(up.files)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	// Held from reading the problem until publishing it, so concurrent
+	// uploads cannot drop each other's testcases.
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	jd, err := us.problems.Get(id)
+	if err == problems.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound, "Problem was not published through the API")
+	}
+	if err != nil {
+		return err
+	}
+	if c.QueryParam("replace") == "true" {
+		jd.IO = testcases
+	} else {
+		jd.IO = append(jd.IO, testcases...)
+	}
+	if err := us.localAgent.ValidateJudgeData(jd); err != nil {
+		return invalidRequest(c, err)
+	}
+	if err := us.publishLocked(id, jd); err != nil {
+		return err
+	}
+	c.Logger().Infof("Problem %s: %d testcases uploaded by %s", id, len(testcases), caller(c))
+	return c.JSON(http.StatusOK, summarize(id, jd, true))
+}
+
+// upload collects the files of a testcase upload by base name. left is how
+// many more bytes they may add up to, archives counted once expanded.
+type upload struct {
+	files map[string]string
+	left  int64
+}
+
+func (up *upload) add(name string, r io.Reader) error {
+	data, err := ioutil.ReadAll(io.LimitReader(r, up.left+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > up.left {
+		return fmt.Errorf("Upload expands to more than %d bytes", MAX_UPLOAD)
+	}
+	up.left -= int64(len(data))
+	name = path.Base(name)
+	if _, ok := up.files[name]; ok {
+		return fmt.Errorf("%s given twice", name)
+	}
+	up.files[name] = string(data)
+	return nil
+}
+
+func (up *upload) readMultipart(c echo.Context) error {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return err
+	}
+	for _, headers := range form.File {
+		for _, header := range headers {
+			if err := up.readPart(header); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (up *upload) readPart(header *multipart.FileHeader) error {
+	f, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.HasSuffix(header.Filename, ".zip") {
+		return up.readZip(f)
+	}
+	return up.add(header.Filename, f)
+}
+
+func (up *upload) readZip(r io.Reader) error {
+	data, err := ioutil.ReadAll(io.LimitReader(r, MAX_UPLOAD))
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = up.add(f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var testcaseNumberPattern = regexp.MustCompile(`[0-9]+`)
+
+// testcaseNames orders testcase files by their number, so "input10.txt"
+// comes after "input9.txt".
+type testcaseNames []string
+
+func testcaseNumber(name string) int {
+	digits := testcaseNumberPattern.FindAllString(name, -1)
+	if len(digits) == 0 {
+		return -1
+	}
+	n, err := strconv.Atoi(digits[len(digits)-1])
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func (a testcaseNames) Len() int      { return len(a) }
+func (a testcaseNames) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a testcaseNames) Less(i, j int) bool {
+	if ni, nj := testcaseNumber(a[i]), testcaseNumber(a[j]); ni != nj {
+		return ni < nj
+	}
+	return a[i] < a[j]
+}
+
+// pairTestcases matches every input file with its output file.
+func pairTestcases(files map[string]string) ([]*umpire.InputOutput, error) {
+	inputs := testcaseNames{}
+	paired := map[string]bool{}
+	for name := range files {
+		if strings.Contains(name, "input") {
+			inputs = append(inputs, name)
+		}
+	}
+	sort.Sort(inputs)
+	io := []*umpire.InputOutput{}
+	for _, input := range inputs {
+		output := strings.Replace(input, "input", "output", 1)
+		expected, ok := files[output]
+		if !ok {
+			return nil, fmt.Errorf("No %s for %s", output, input)
+		}
+		paired[input], paired[output] = true, true
+		io = append(io, &umpire.InputOutput{Input: files[input], Output: expected})
+	}
+	for name := range files {
+		if !paired[name] {
+			return nil, fmt.Errorf("%s is neither an input nor the output of one", name)
+		}
+	}
+	if len(io) == 0 {
+		return nil, fmt.Errorf("No testcases found")
+	}
+	return io, nil
+}
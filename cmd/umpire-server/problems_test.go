@@ -0,0 +1,165 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/maddyonline/umpire"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const sumProblem = `{"solution": {"language": "cpp", "files": [{"name": "main.cpp", "content": "int main() {}"}]}}`
+
+func zipped(t *testing.T, files map[string]string) []byte {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestProblemLifecycle(t *testing.T) {
+	agent := &umpire.Agent{}
+	server := NewUmpireServer(agent, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.open = true
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		server.e.ServeHTTP(rw, req)
+		return rw
+	}
+
+	req, _ := http.NewRequest("PUT", "/problems/sum", strings.NewReader(sumProblem))
+	req.Header.Set("Content-Type", "application/json")
+	if rw := serve(req); rw.Code != http.StatusOK {
+		t.Fatalf("PUT: StatusCode: expected %d, got %d: %s", http.StatusOK, rw.Code, rw.Body.String())
+	}
+	if agent.Problems.Snapshot().Get("sum") == nil {
+		t.Fatalf("published problem is not visible to the agent")
+	}
+
+	req, _ = http.NewRequest("POST", "/problems/sum/testcases", bytes.NewReader(zipped(t, map[string]string{
+		"tests/input1.txt": "1 2\n", "tests/output1.txt": "3\n",
+	})))
+	req.Header.Set("Content-Type", "application/zip")
+	if rw := serve(req); rw.Code != http.StatusOK {
+		t.Fatalf("zip upload: StatusCode: expected %d, got %d: %s", http.StatusOK, rw.Code, rw.Body.String())
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, content := range map[string]string{"input2.txt": "2 2\n", "output2.txt": "4\n"} {
+		w, _ := mw.CreateFormFile("testcase", name)
+		w.Write([]byte(content))
+	}
+	mw.Close()
+	req, _ = http.NewRequest("POST", "/problems/sum/testcases", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if rw := serve(req); rw.Code != http.StatusOK {
+		t.Fatalf("multipart upload: StatusCode: expected %d, got %d: %s", http.StatusOK, rw.Code, rw.Body.String())
+	}
+	if io := agent.Problems.Snapshot().Get("sum").IO; len(io) != 2 || io[0].Output != "3\n" || io[1].Output != "4\n" {
+		t.Errorf("unexpected testcases %+v", io)
+	}
+
+	req, _ = http.NewRequest("GET", "/problems", nil)
+	if rw := serve(req); rw.Code != http.StatusOK || !strings.Contains(rw.Body.String(), `"testcases":2,"published":true`) {
+		t.Errorf("GET /problems: %d %s", rw.Code, rw.Body.String())
+	}
+
+	req, _ = http.NewRequest("DELETE", "/problems/sum", nil)
+	if rw := serve(req); rw.Code != http.StatusNoContent {
+		t.Errorf("DELETE: StatusCode: expected %d, got %d", http.StatusNoContent, rw.Code)
+	}
+	if agent.Problems.Snapshot().Get("sum") != nil {
+		t.Errorf("deleted problem is still visible to the agent")
+	}
+}
+
+func TestPutProblemRejectsBadId(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.open = true
+	req, _ := http.NewRequest("PUT", "/problems/..", strings.NewReader(sumProblem))
+	req.Header.Set("Content-Type", "application/json")
+	rw := httptest.NewRecorder()
+	server.e.ServeHTTP(rw, req)
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("StatusCode: expected %d, got %d", http.StatusBadRequest, rw.Code)
+	}
+}
+
+func TestPairTestcases(t *testing.T) {
+	if _, err := pairTestcases(map[string]string{"input1.txt": "1"}); err == nil {
+		t.Errorf("expected an error for an input without output")
+	}
+	if _, err := pairTestcases(map[string]string{"input1.txt": "1", "output1.txt": "1", "notes.md": ""}); err == nil {
+		t.Errorf("expected an error for a stray file")
+	}
+}
+
+func TestPairTestcasesOrdersByNumber(t *testing.T) {
+	files := map[string]string{}
+	for _, n := range []string{"1", "2", "9", "10", "11"} {
+		files["input"+n+".txt"], files["output"+n+".txt"] = n, n
+	}
+	io, err := pairTestcases(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, tc := range io {
+		got = append(got, tc.Input)
+	}
+	if strings.Join(got, ",") != "1,2,9,10,11" {
+		t.Errorf("unexpected testcase order %v", got)
+	}
+}
+
+func TestUploadRejectsDuplicatesAndSharesBudget(t *testing.T) {
+	up := &upload{files: map[string]string{}, left: MAX_UPLOAD}
+	archive := zipped(t, map[string]string{"a/input1.txt": "1", "b/input1.txt": "2"})
+	if err := up.readZip(bytes.NewReader(archive)); err == nil || !strings.Contains(err.Error(), "given twice") {
+		t.Errorf("expected duplicate base names to be refused, got %v", err)
+	}
+	up = &upload{files: map[string]string{}, left: 10}
+	if err := up.add("input1.txt", strings.NewReader("123456")); err != nil {
+		t.Fatal(err)
+	}
+	if err := up.readZip(bytes.NewReader(zipped(t, map[string]string{"output1.txt": "123456"}))); err == nil {
+		t.Errorf("expected the second part to exceed the budget left by the first")
+	}
+}
+
+func TestValidationDoesNotPublish(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	before := server.localAgent.Problems.Snapshot()
+	for _, body := range []string{`{}`, `{"solution": {"language": "cobol", "files": [{"name": "main.cob"}]}}`} {
+		req, _ := http.NewRequest("PUT", "/problems/sum", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rw := httptest.NewRecorder()
+		server.e.ServeHTTP(rw, req)
+		if rw.Code < 400 || rw.Code >= 500 {
+			t.Errorf("%s: expected a 4xx, got %d", body, rw.Code)
+		}
+	}
+	if after := server.localAgent.Problems.Snapshot(); after != before {
+		t.Errorf("invalid problem published a new snapshot: version %d -> %d", before.Version, after.Version)
+	}
+	if _, err := server.problems.Get("sum"); err == nil {
+		t.Errorf("invalid problem was stored")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/jobs"
+	"github.com/maddyonline/umpire/pkg/problems"
+	"github.com/maddyonline/umpire/pkg/submissions"
+	"net/http"
+	"time"
+)
+
+// rejudgeRequest is the body of POST /problems/:id/rejudge. Without
+// fields it selects every stored submission of the problem; status keeps
+// those whose latest verdict it is, and since and until bound when they
+// were submitted, until excluded.
+type rejudgeRequest struct {
+	Status umpire.Decision `json:"status,omitempty"`
+	Since  time.Time       `json:"since,omitempty"`
+	Until  time.Time       `json:"until,omitempty"`
+}
+
+// rejudgeRef answers POST /problems/:id/rejudge. The rejudge is a batch:
+// its progress and results are under /batches/<batch>. Skipped counts
+// matching submissions that are no longer valid, for example because
+// their language was removed.
+type rejudgeRef struct {
+	Batch   string `json:"batch"`
+	Total   int    `json:"total"`
+	Skipped int    `json:"skipped"`
+}
+
+// rejudgeProblem judges the matching stored submissions of a problem again
+// against its current testcases. The jobs run in the background, only
+// when no other job waits, and every new verdict is recorded with the
+// submission next to its original result.
+func (us *UmpireServer) rejudgeProblem(c echo.Context) error {
+	id := c.Param("id")
+	if us.localAgent.Problems.Snapshot().Get(id) == nil {
+		return echo.NewHTTPError(http.StatusNotFound, problems.ErrNotFound.Error())
+	}
+	req := &rejudgeRequest{}
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if req.Status != "" && req.Status != umpire.Pass && req.Status != umpire.Fail {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("status must be %s or %s", umpire.Pass, umpire.Fail))
+	}
+	if !req.Until.IsZero() && !req.Until.After(req.Since) {
+		return echo.NewHTTPError(http.StatusBadRequest, "until must be after since")
+	}
+	subs, err := us.submissions.Find(&submissions.Query{
+		ProblemId: id,
+		Status:    req.Status,
+		Since:     req.Since,
+		Until:     req.Until,
+		Limit:     MAX_BATCH + 1,
+	})
+	if err != nil {
+		return err
+	}
+	if len(subs) > MAX_BATCH {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("more than %d submissions match, narrow the time range", MAX_BATCH))
+	}
+	ref := &rejudgeRef{}
+	payloads := []*umpire.Payload{}
+	for _, sub := range subs {
+		if sub.Payload == nil {
+			ref.Skipped++
+			continue
+		}
+		payload := *sub.Payload
+		payload.Problem = &umpire.Problem{Id: id}
+		if err := us.localAgent.ValidatePayload(&payload, true); err != nil {
+			log.Warnf("Not rejudging submission %s: %v", sub.Id, err)
+			ref.Skipped++
+			continue
+		}
+		payload.SubmissionId = sub.Id
+		payloads = append(payloads, &payload)
+	}
+	batch, err := us.jobs.SubmitRejudge(caller(c), payloads)
+	if err == jobs.ErrQueueFull || err == jobs.ErrQueueClosed {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	c.Logger().Infof("rejudge %s of problem %s by %s: %d submissions", batch.Id, id, caller(c), len(batch.Jobs))
+	for _, id := range batch.Jobs {
+		us.events.Publish(&umpire.Event{SubmissionId: id, Type: umpire.EventQueued, Time: batch.Created})
+	}
+	ref.Batch, ref.Total = batch.Id, len(batch.Jobs)
+	return c.JSON(http.StatusAccepted, ref)
+}
+
+// recordRejudge adds the result of a rejudge job to the submission it
+// judged again. Only the submission store keeps rejudges; the other sinks
+// saw the submission once, when it was first judged.
+func (us *UmpireServer) recordRejudge(job *jobs.Job, out *umpire.Response) {
+	us.rejudgeMu.Lock()
+	defer us.rejudgeMu.Unlock()
+	sub, err := us.submissions.Get(job.Rejudges)
+	if err != nil {
+		log.Errorf("Failed to record rejudge of submission %s: %v", job.Rejudges, err)
+		return
+	}
+	r := &submissions.Rejudge{
+		Batch:          job.Batch,
+		Judged:         time.Now().UTC(),
+		ProblemVersion: out.ProblemVersion,
+		Previous:       sub.Verdict(),
+		Status:         out.Status,
+		Details:        out.Details,
+	}
+	sub.Rejudges = append(sub.Rejudges, r)
+	if err := us.submissions.Record(sub); err != nil {
+		log.Errorf("Failed to record rejudge of submission %s: %v", job.Rejudges, err)
+		return
+	}
+	if r.Status != r.Previous {
+		log.Infof("Rejudge %s: submission %s went from %s to %s", job.Batch, sub.Id, r.Previous, r.Status)
+	}
+}
+
+// previousVerdict is the verdict the rejudge job replaced, once recorded.
+func (us *UmpireServer) previousVerdict(job *jobs.Job) umpire.Decision {
+	sub, err := us.submissions.Get(job.Rejudges)
+	if err != nil {
+		return ""
+	}
+	for _, r := range sub.Rejudges {
+		if r.Batch == job.Batch {
+			return r.Previous
+		}
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/submissions"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRejudgeProblem(t *testing.T) {
+	agent := &umpire.Agent{Problems: umpire.NewProblemStore(map[string]*umpire.JudgeData{"sum": {}})}
+	server := NewUmpireServer(agent, nil, 0)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.auth = &AuthConfig{APIKeys: []*APIKey{{Uid: "alice", Key: "a"}, {Uid: "setter", Key: "s", Roles: []string{RoleProblemSetter}}}}
+	start := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+	payload := func(language string) *umpire.Payload {
+		return &umpire.Payload{Language: language, Problem: &umpire.Problem{Id: "sum"}, Files: []*umpire.InMemoryFile{{Name: "main.cpp", Content: "int main() {}"}}}
+	}
+	for i, sub := range []*submissions.Submission{
+		{Id: "s1", Uid: "alice", ProblemId: "sum", Payload: payload("cpp"), Result: &umpire.Response{Status: umpire.Pass}},
+		{Id: "s2", Uid: "alice", ProblemId: "sum", Payload: payload("cpp"), Result: &umpire.Response{Status: umpire.Fail}},
+		{Id: "s3", Uid: "alice", ProblemId: "sum", Payload: payload("cobol"), Result: &umpire.Response{Status: umpire.Pass}},
+		{Id: "s4", Uid: "alice", ProblemId: "sum", Payload: payload("cpp"), Result: &umpire.Response{Status: umpire.Pass}},
+		{Id: "s5", Uid: "alice", ProblemId: "max", Payload: payload("cpp"), Result: &umpire.Response{Status: umpire.Pass}},
+	} {
+		sub.Submitted = start.Add(time.Duration(i) * time.Hour)
+		sub.Judged = sub.Submitted
+		server.submissions.Record(sub)
+	}
+	post := func(path, key, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(API_KEY_HEADER, key)
+		rw := httptest.NewRecorder()
+		server.e.ServeHTTP(rw, req)
+		return rw
+	}
+
+	if rw := post("/v1/problems/sum/rejudge", "a", `{}`); rw.Code != http.StatusForbidden {
+		t.Errorf("submitter: StatusCode: expected %d, got %d", http.StatusForbidden, rw.Code)
+	}
+	if rw := post("/v1/problems/nope/rejudge", "s", `{}`); rw.Code != http.StatusNotFound {
+		t.Errorf("unknown problem: StatusCode: expected %d, got %d", http.StatusNotFound, rw.Code)
+	}
+	if rw := post("/v1/problems/sum/rejudge", "s", `{"status":"maybe"}`); rw.Code != http.StatusBadRequest {
+		t.Errorf("bad status: StatusCode: expected %d, got %d", http.StatusBadRequest, rw.Code)
+	}
+	// s1 and s3 pass and were submitted before 03:00; s3's language is gone.
+	rw := post("/v1/problems/sum/rejudge", "s", `{"status":"pass","until":"2017-03-01T03:00:00Z"}`)
+	if rw.Code != http.StatusAccepted {
+		t.Fatalf("StatusCode: expected %d, got %d: %s", http.StatusAccepted, rw.Code, rw.Body.String())
+	}
+	ref := &rejudgeRef{}
+	if err := json.Unmarshal(rw.Body.Bytes(), ref); err != nil || ref.Total != 1 || ref.Skipped != 1 {
+		t.Fatalf("unexpected answer %s", rw.Body.String())
+	}
+	if n, m := server.jobs.Pending(), server.jobs.Background(); n != 0 || m != 1 {
+		t.Errorf("expected one rejudge in the background, got %d pending and %d in the background", n, m)
+	}
+	batch, err := server.jobs.Batch(ref.Batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := server.jobs.Get(batch.Jobs[0])
+	if err != nil || job.Rejudges != "s1" || job.Uid != "setter" {
+		t.Fatalf("unexpected job %+v, %v", job, err)
+	}
+
+	server.recordRejudge(job, &umpire.Response{Status: umpire.Fail, Details: "Mismatch Error", ProblemVersion: 2})
+	sub, _ := server.submissions.Get("s1")
+	if sub.Result.Status != umpire.Pass || len(sub.Rejudges) != 1 || sub.Verdict() != umpire.Fail {
+		t.Errorf("unexpected submission %+v", sub)
+	}
+	if r := sub.Rejudges[0]; r.Batch != ref.Batch || r.Previous != umpire.Pass || r.ProblemVersion != 2 {
+		t.Errorf("unexpected rejudge %+v", r)
+	}
+	if previous := server.previousVerdict(job); previous != umpire.Pass {
+		t.Errorf("previousVerdict: expected %s, got %q", umpire.Pass, previous)
+	}
+}
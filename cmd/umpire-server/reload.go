@@ -0,0 +1,250 @@
+package main
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/problems"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RELOAD_DELAY is how long the watcher waits after the last change to a
+// problem before reloading it, so that a problem being copied in is read
+// once, complete.
+const RELOAD_DELAY = 500 * time.Millisecond
+
+// problemSources keeps what each problem source provided when it was last
+// read, so that one source, or one problem of -problemsdir, can be reloaded
+// without reading the others. A source that fails to load keeps what it
+// provided before.
+type problemSources struct {
+	mu       sync.Mutex
+	dir      map[string]*umpire.JudgeData
+	cache    map[string]*umpire.JudgeData
+	serverdb map[string]*umpire.JudgeData
+	// failed holds the error of every problem of -problemsdir that could
+	// not be loaded.
+	failed map[string]string
+}
+
+var sources = newProblemSources()
+
+func newProblemSources() *problemSources {
+	return &problemSources{failed: map[string]string{}}
+}
+
+func (s *problemSources) set(source *map[string]*umpire.JudgeData, data map[string]*umpire.JudgeData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*source = data
+}
+
+// setDir replaces the problems of -problemsdir. Problems that failed keep
+// their previous version, if any.
+func (s *problemSources) setDir(data map[string]*umpire.JudgeData, failed map[string]error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = map[string]string{}
+	for id, err := range failed {
+		log.Warnf("Problem %s: %v", id, err)
+		s.failed[id] = err.Error()
+		if jd, ok := s.dir[id]; ok {
+			data[id] = jd
+		}
+	}
+	s.dir = data
+}
+
+// setProblem records the outcome of reloading one problem of -problemsdir.
+// jd is nil when the problem is gone.
+func (s *problemSources) setProblem(id string, jd *umpire.JudgeData, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		log.Warnf("Problem %s: %v", id, err)
+		s.failed[id] = err.Error()
+		return
+	}
+	delete(s.failed, id)
+	dir := map[string]*umpire.JudgeData{}
+	for k, v := range s.dir {
+		dir[k] = v
+	}
+	if jd == nil {
+		delete(dir, id)
+	} else {
+		dir[id] = jd
+	}
+	s.dir = dir
+}
+
+// merged combines the sources; later ones win: -problemsdir, the cache file,
+// then -serverdb.
+func (s *problemSources) merged() map[string]*umpire.JudgeData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := map[string]*umpire.JudgeData{}
+	for _, source := range []map[string]*umpire.JudgeData{s.dir, s.cache, s.serverdb} {
+		for k, v := range source {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+func (s *problemSources) errors() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := map[string]string{}
+	for k, v := range s.failed {
+		out[k] = v
+	}
+	return out
+}
+
+// installProblems makes the merged sources, with the problems published
+// through the API on top, the agent's problems. It returns how many there
+// are and the error reading the published ones, which are then left out.
+func installProblems(agent *umpire.Agent, published problems.Store) (int, error) {
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	m := sources.merged()
+	var err error
+	if published != nil {
+		var data map[string]*umpire.JudgeData
+		data, err = published.List()
+		countRefresh("problemsdb", err)
+		if err == nil {
+			log.Infof("number of problems published through the API=%d", len(data))
+			for k, v := range data {
+				m[k] = v
+			}
+		} else {
+			log.Warnf("err=%v in reading published problems", err)
+		}
+	}
+	version := agent.Problems.Replace(m)
+	log.Infof("Installed %d problems as version %d", len(m), version)
+	return len(m), err
+}
+
+// problemOf returns the id of the problem of dir that path belongs to, or
+// "" for paths outside any problem.
+func problemOf(dir, path string) string {
+	if _, err := os.Stat(filepath.Join(dir, umpire.SOLUTION_DIR)); err == nil {
+		return filepath.Base(dir)
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	id := strings.Split(rel, string(filepath.Separator))[0]
+	if strings.HasPrefix(id, ".") {
+		return ""
+	}
+	return id
+}
+
+// reloadProblems reads the problems ids of dir again and installs the
+// result.
+func reloadProblems(agent *umpire.Agent, dir string, ids []string, published problems.Store) {
+	dirs, err := umpire.ProblemDirs(dir)
+	if err != nil {
+		log.Warnf("Reloading problems %v: %v", ids, err)
+		return
+	}
+	for _, id := range ids {
+		problemDir, ok := dirs[id]
+		if !ok {
+			sources.setProblem(id, nil, nil)
+			continue
+		}
+		jd, err := umpire.ReadProblem(problemDir)
+		sources.setProblem(id, jd, err)
+	}
+	log.Infof("Reloaded problems %v", ids)
+	installProblems(agent, published)
+}
+
+// watchDirs adds dir and every directory below it to w; fsnotify does not
+// watch subdirectories by itself.
+func watchDirs(w *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return w.Add(path)
+	})
+}
+
+// watchProblems reloads the problems of dir whose files change, RELOAD_DELAY
+// after the last change. Closing the returned watcher stops it.
+func watchProblems(agent *umpire.Agent, dir string, published problems.Store) (*fsnotify.Watcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watchDirs(w, dir); err != nil {
+		w.Close()
+		return nil, err
+	}
+	go func() {
+		dirty := map[string]bool{}
+		var reload <-chan time.Time
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if ev.Op&fsnotify.Create != 0 {
+					if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+						watchDirs(w, ev.Name)
+					}
+				}
+				if id := problemOf(dir, ev.Name); id != "" {
+					dirty[id] = true
+					reload = time.After(RELOAD_DELAY)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				log.Warnf("Watching %s: %v", dir, err)
+			case <-reload:
+				ids := []string{}
+				for id := range dirty {
+					ids = append(ids, id)
+				}
+				dirty = map[string]bool{}
+				reload = nil
+				reloadProblems(agent, dir, ids, published)
+			}
+		}
+	}()
+	log.Infof("Watching %s for problem changes", dir)
+	return w, nil
+}
+
+// adminReload reads every problem source again straight away and reports
+// the outcome, per-problem errors included.
+func (us *UmpireServer) adminReload(c echo.Context) error {
+	updateJudgeData(us.localAgent, cachefile, problemsdir, serverdb, us.problems)
+	refreshed, loaded, errors := lastRefresh.get()
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"time":             refreshed,
+		"problems":         loaded,
+		"problems_version": us.localAgent.Problems.Snapshot().Version,
+		"errors":           errors,
+		"problem_errors":   sources.errors(),
+	})
+}
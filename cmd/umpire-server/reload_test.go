@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/maddyonline/umpire"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeProblem(t *testing.T, dir, id string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, id, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+var sumFiles = map[string]string{
+	"solution/cpp/main.cpp": "int main() {}",
+	"testcases/input1.txt":  "1 2\n",
+	"testcases/output1.txt": "3\n",
+}
+
+func testcaseOutput(agent *umpire.Agent, id string) string {
+	jd := agent.Problems.Snapshot().Get(id)
+	if jd == nil || len(jd.IO) == 0 {
+		return ""
+	}
+	return jd.IO[0].Output
+}
+
+func TestWatchReloadsChangedProblem(t *testing.T) {
+	defer func() { sources = newProblemSources() }()
+	dir, err := ioutil.TempDir("", "umpire_problems_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeProblem(t, dir, "sum", sumFiles)
+	// A problem without testcases fails to load; its error is kept.
+	writeProblem(t, dir, "broken", map[string]string{"solution/cpp/main.cpp": ""})
+
+	agent := &umpire.Agent{Problems: umpire.NewProblemStore(nil)}
+	updateJudgeData(agent, nil, &dir, nil, nil)
+	if testcaseOutput(agent, "sum") != "3\n" {
+		t.Fatalf("sum not loaded")
+	}
+	if errs := sources.errors(); errs["broken"] == "" || len(errs) != 1 {
+		t.Errorf("expected an error for broken only, got %v", errs)
+	}
+
+	watcher, err := watchProblems(agent, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	writeProblem(t, dir, "sum", map[string]string{"testcases/output1.txt": "4\n"})
+	writeProblem(t, dir, "broken", map[string]string{"testcases/input1.txt": "", "testcases/output1.txt": ""})
+	deadline := time.Now().Add(5 * time.Second)
+	for testcaseOutput(agent, "sum") != "4\n" || agent.Problems.Snapshot().Get("broken") == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("changes were not reloaded, errors: %v", sources.errors())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if errs := sources.errors(); len(errs) != 0 {
+		t.Errorf("expected no errors once fixed, got %v", errs)
+	}
+}
+
+func TestAdminReload(t *testing.T) {
+	defer func() { sources = newProblemSources() }()
+	dir, err := ioutil.TempDir("", "umpire_problems_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saved := *problemsdir
+	*problemsdir = dir
+	defer func() { *problemsdir = saved }()
+
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.open = true
+	writeProblem(t, dir, "sum", sumFiles)
+	req, _ := http.NewRequest("POST", "/admin/reload", nil)
+	rw := httptest.NewRecorder()
+	server.e.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK || !strings.Contains(rw.Body.String(), `"problems":1`) {
+		t.Errorf("unexpected response %d %s", rw.Code, rw.Body.String())
+	}
+	if testcaseOutput(server.localAgent, "sum") != "3\n" {
+		t.Errorf("sum not loaded by the reload")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -10,55 +11,230 @@ import (
 	"github.com/labstack/gommon/log"
 	"github.com/maddyonline/umpire"
 	"github.com/maddyonline/umpire/pkg/dockerutils"
+	"github.com/maddyonline/umpire/pkg/jobs"
+	"github.com/maddyonline/umpire/pkg/problems"
+	"github.com/maddyonline/umpire/pkg/submissions"
+	"github.com/maddyonline/umpire/pkg/webhooks"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
-const REFRESH_INTERVAL = 120 * time.Second
-
-var judgeDataSource []map[string]*umpire.JudgeData
-var currentSrc int
+// publishMu orders the final step of a refresh, reading published problems
+// and installing the new set, with problems published through the API, so a
+// refresh never installs a set missing a problem published while it ran.
+var publishMu sync.Mutex
 
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
 var (
-	cachefile   = flag.String("cachefile", "~/.umpire.cache.json", "cache file for problems")
+	cachefile   = flag.String("cachefile", "~/.umpire.cache.json", "cache file for problems; empty to not use one")
 	problemsdir = flag.String("problemsdir", "", "directory containing problems")
+	watch       = flag.Bool("watch", true, "reload problems of -problemsdir as their files change instead of every -refreshinterval")
 	serverdb    = flag.String("serverdb", "", "server to get problems list (e.g. http://localhost:3033)")
+	languages   = flag.String("languages", "", "JSON file describing language images and variants")
+	registry    = flag.String("registry", "", "registry to pull missing judge images from")
+	pullImages  = flag.Bool("pullimages", false, "pull missing judge images at startup")
+	reapEvery   = flag.Duration("reapinterval", 5*time.Minute, "how often to remove leaked judge containers")
+	reapMaxAge  = flag.Duration("reapmaxage", 10*time.Minute, "age after which a judge container is considered leaked")
+	runtime     = flag.String("runtime", "", "container runtime for judge containers, e.g. runsc (default is the docker default)")
+	seccomp     = flag.String("seccomp", "setup/seccomp.json", "seccomp profile for judge containers; \"unconfined\" or \"\" for docker's own")
+	apparmor    = flag.String("apparmor", "", "AppArmor profile for judge containers")
+	jobsdb      = flag.String("jobsdb", "umpire.jobs.db", "file storing queued and finished judge jobs")
+	retention   = flag.Duration("jobretention", 7*24*time.Hour, "how long finished judge jobs are kept in -jobsdb; 0 keeps them forever")
+	problemsdb  = flag.String("problemsdb", "umpire.problems.db", "file storing problems published through the API")
+	subsdb      = flag.String("submissionsdb", "umpire.submissions.db", "file storing judged submissions")
+	hooksdb     = flag.String("deliveriesdb", "umpire.deliveries.db", "file storing result deliveries to callbacks and -serverdb not made yet, and the log of attempts")
+	workers     = flag.Int("workers", 4, "number of judge jobs run concurrently")
+	grace       = flag.Duration("grace", 30*time.Second, "how long in-flight judgements may run after SIGTERM before being cancelled")
+
+	authFile    = flag.String("auth", "", "JSON file with API keys and the JWT secret; without it anyone can submit but nobody can change problems or administer")
+	open        = flag.Bool("insecureopen", false, "without -auth, give anonymous callers every role, problem and admin routes included")
+	corsOrigins = flag.String("corsorigins", "*", "comma separated origins allowed to call the API from a browser")
+	limitsFile  = flag.String("limits", "", "JSON file with per-role and per-IP rate limits and execution quotas")
+
+	webhookAttempts = flag.Int("webhookattempts", 6, "how often a callback delivery is tried before giving up; -serverdb deliveries are tried until they succeed")
+	webhookBackoff  = flag.Duration("webhookbackoff", 5*time.Second, "wait before retrying a failed result delivery, doubled after every failure")
 )
 
 func main() {
-	judgeDataSource = make([]map[string]*umpire.JudgeData, 2)
-	flag.Parse()
+	if err := loadConfig(flag.CommandLine, os.Args[1:]); err != nil {
+		log.Fatalf("Failed to load settings: %v", err)
+		return
+	}
+	umpire.JudgeTimeout = *judgeTimeout
 
+	if *languages != "" {
+		if err := umpire.LoadLanguages(*languages); err != nil {
+			log.Fatalf("Failed to load languages from %s: %v", *languages, err)
+			return
+		}
+	}
+	sandbox := &umpire.Sandbox{Runtime: *runtime}
+	if *seccomp != "" {
+		sandbox.SecurityOpt = append(sandbox.SecurityOpt, "seccomp="+*seccomp)
+	}
+	if *apparmor != "" {
+		sandbox.SecurityOpt = append(sandbox.SecurityOpt, "apparmor="+*apparmor)
+	}
+	if err := umpire.SetDefaultSandbox(sandbox); err != nil {
+		log.Fatalf("Failed to set up sandbox: %v", err)
+		return
+	}
 	agent := &umpire.Agent{
-		Client: dockerutils.NewClient(),
+		Client:   dockerutils.NewClient(),
+		Problems: umpire.NewProblemStore(nil),
 	}
 	if agent.Client == nil {
 		log.Fatalf("Failed to initialize docker client")
 		return
 	}
-	updateJudgeData(agent, cachefile, problemsdir, serverdb)
-	go refreshJudgeData(agent, problemsdir, serverdb)
-	server := NewUmpireServer(agent)
+	if err := umpire.CheckRuntimes(context.Background(), agent.Client); err != nil {
+		log.Fatalf("Failed to verify container runtimes: %v", err)
+		return
+	}
+	statuses, err := umpire.NewImageManager(agent.Client, *registry).Ensure(context.Background(), *pullImages)
+	for _, status := range statuses {
+		log.Infof("Judge image %s: present=%v digest=%s %s", status.Image, status.Present, status.Digest, status.Error)
+	}
+	if err != nil {
+		log.Warnf("Some judge images are missing, judgements using them will fail: %v", err)
+	}
+	reaper := &umpire.Reaper{Client: agent.Client, MaxAge: *reapMaxAge}
+	reaper.Run(context.Background(), *reapEvery)
+	published, err := problems.NewBoltStore(*problemsdb)
+	if err != nil {
+		log.Fatalf("Failed to open problem store %s: %v", *problemsdb, err)
+		return
+	}
+	defer published.Close()
+	updateJudgeData(agent, cachefile, problemsdir, serverdb, published)
+	polled := problemsdir
+	if *problemsdir != "" && *watch {
+		watcher, err := watchProblems(agent, *problemsdir, published)
+		if err != nil {
+			log.Warnf("Failed to watch %s, reading it every %v instead: %v", *problemsdir, *refreshEvery, err)
+		} else {
+			defer watcher.Close()
+			polled = nil
+		}
+	}
+	go refreshJudgeData(agent, cachefile, polled, serverdb, published, *refreshEvery)
+	store, err := jobs.NewBoltStore(*jobsdb)
+	if err != nil {
+		log.Fatalf("Failed to open job store %s: %v", *jobsdb, err)
+		return
+	}
+	defer store.Close()
+	server := NewUmpireServer(agent, store, *workers)
+	if server == nil {
+		log.Fatalf("Failed to start server")
+		return
+	}
+	if *retention > 0 {
+		pruneJobs(server.ctx, server.jobs, *retention)
+	}
+	server.problems = published
+	subs, err := submissions.NewBoltStore(*subsdb)
+	if err != nil {
+		log.Fatalf("Failed to open submission store %s: %v", *subsdb, err)
+		return
+	}
+	server.submissions = subs
+	server.sinks = []submissions.Sink{subs}
+	deliveries, err := webhooks.NewBoltStore(*hooksdb)
+	if err != nil {
+		log.Fatalf("Failed to open delivery store %s: %v", *hooksdb, err)
+		return
+	}
+	defer deliveries.Close()
+	server.hooks.Close(0)
+	if server.hooks, err = webhooks.NewDispatcher(deliveries, webhooks.NewClient(), *webhookAttempts, *webhookBackoff); err != nil {
+		log.Fatalf("Failed to resume result deliveries: %v", err)
+		return
+	}
+	if *serverdb != "" {
+		server.sinks = append(server.sinks, submissions.NewHTTPSink("serverdb", serverdbRequest, server.hooks))
+	}
+	registerServerMetrics(server)
+	if *authFile != "" {
+		if server.auth, err = LoadAuthConfig(*authFile); err != nil {
+			log.Fatalf("Failed to load auth config from %s: %v", *authFile, err)
+			return
+		}
+		log.Infof("Loaded %d API keys from %s", len(server.auth.APIKeys), *authFile)
+	} else if *open {
+		log.Warnf("No -auth file given and -insecureopen set, the whole API, admin routes included, is open to anyone who can reach it")
+	} else {
+		log.Warnf("No -auth file given, anyone who can reach the API may submit, and problem and admin routes are refused")
+	}
+	if *limitsFile != "" {
+		config, err := LoadLimitsConfig(*limitsFile)
+		if err != nil {
+			log.Fatalf("Failed to load limits from %s: %v", *limitsFile, err)
+			return
+		}
+		server.limits = NewLimiter(config, nil)
+	}
 	e := server.e
-	if err := e.Start(":1323"); err != nil {
-		e.Logger.Fatal(err.Error())
+	e.Server.ReadTimeout, e.TLSServer.ReadTimeout = *readTimeout, *readTimeout
+	e.Server.WriteTimeout, e.TLSServer.WriteTimeout = *writeTimeout, *writeTimeout
+	go func() {
+		var err error
+		if *tlsCert != "" {
+			err = e.StartTLS(*listen, *tlsCert, *tlsKey)
+		} else {
+			err = e.Start(*listen)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err.Error())
+		}
+	}()
+	if *grpcListen != "" {
+		opts, err := grpcServerOptions(*tlsCert, *tlsKey)
+		if err != nil {
+			log.Fatalf("Failed to load TLS credentials for gRPC: %v", err)
+			return
+		}
+		lis, err := net.Listen("tcp", *grpcListen)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", *grpcListen, err)
+			return
+		}
+		s := server.NewGRPCServer(opts...)
+		log.Infof("gRPC API listening on %s", lis.Addr())
+		go func() {
+			if err := s.Serve(lis); err != nil {
+				log.Fatalf("gRPC server: %v", err)
+			}
+		}()
 	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	log.Infof("Received %v, shutting down", <-sig)
+	server.Shutdown(*grace)
 }
 
-func refreshJudgeData(agent *umpire.Agent, problemsdir, serverdb *string) {
-	ticker := time.NewTicker(REFRESH_INTERVAL)
+func refreshJudgeData(agent *umpire.Agent, cachefile, problemsdir, serverdb *string, published problems.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
 	quit := make(chan struct{})
 	go func() {
 		for {
 			select {
 			case <-ticker.C:
 				log.Info("Refreshing umpire data")
-				updateJudgeData(agent, cachefile, problemsdir, serverdb)
+				updateJudgeData(agent, cachefile, problemsdir, serverdb, published)
 			case <-quit:
 				ticker.Stop()
 				return
@@ -67,79 +243,210 @@ func refreshJudgeData(agent *umpire.Agent, problemsdir, serverdb *string) {
 	}()
 }
 
-func createSubmission(uid string, payload *umpire.Payload, response *umpire.Response) error {
+// JOB_PRUNE_INTERVAL is how often finished jobs past -jobretention are deleted.
+const JOB_PRUNE_INTERVAL = time.Hour
+
+// pruneJobs deletes the jobs that finished more than retention ago, now and
+// then every JOB_PRUNE_INTERVAL, until ctx is done.
+func pruneJobs(ctx context.Context, queue *jobs.Queue, retention time.Duration) {
+	prune := func() {
+		if n, err := queue.Prune(retention); err != nil {
+			log.Warnf("Failed to prune finished jobs: %v", err)
+		} else if n > 0 {
+			log.Infof("Pruned %d jobs finished over %v ago", n, retention)
+		}
+	}
+	prune()
+	ticker := time.NewTicker(JOB_PRUNE_INTERVAL)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				prune()
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// serverdbRequest is the serverdb consumer of judge results: it records the
+// submission for its user under serverdb's /users/<uid>/submissions.
+func serverdbRequest(sub *submissions.Submission) (string, []byte, error) {
 	v := &struct {
 		*umpire.Payload
 		*umpire.Response
-	}{payload, response}
+	}{sub.Payload, sub.Result}
 	var b bytes.Buffer
 	if err := json.NewEncoder(&b).Encode(v); err != nil {
-		return err
-	}
-	url := fmt.Sprintf("%s/users/%s/submissions", *serverdb, uid)
-	log.Infof("Sending request to %s", url)
-	req, err := http.NewRequest("POST", url, bytes.NewReader(b.Bytes()))
-	if err != nil {
-		return err
-	}
-	req.Header.Add("content-type", "application/json")
-	if _, err = http.DefaultClient.Do(req); err != nil {
-		return err
+		return "", nil, err
 	}
-	return nil
+	return fmt.Sprintf("%s/users/%s/submissions", *serverdb, url.PathEscape(sub.Uid)), b.Bytes(), nil
 }
 
 type UmpireServer struct {
 	localAgent *umpire.Agent
 	e          *echo.Echo
+	// ctx is cancelled when shutdown gives up waiting for judgements.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	draining int32
+	// drain is closed when shutdown starts, ending event streams that
+	// would otherwise keep their connections busy.
+	drain    chan struct{}
+	inflight sync.WaitGroup
+	hooks    *webhooks.Dispatcher
+	jobs     *jobs.Queue
+	events   *eventBroker
+	// auth, when set, is required from every caller.
+	auth *AuthConfig
+	// open gives callers every role when there is no auth; otherwise they
+	// are submitters.
+	open bool
+	// limits, when set, rate limits callers and meters their container time.
+	limits *Limiter
+	// problems holds the problems published through the API.
+	problems problems.Store
+	// submissions keeps judged submissions for GET /submissions; it is
+	// also the first of sinks, which all receive every judged submission.
+	submissions submissions.Store
+	sinks       []submissions.Sink
+	// rejudgeMu serializes recording rejudges, which update submissions.
+	rejudgeMu sync.Mutex
+	// grpc, when set, serves the gRPC API.
+	grpc *grpc.Server
+	// imagesCheck spares readyz from inspecting every image on each probe.
+	imagesCheck cachedCheck
 }
 
-func NewUmpireServer(localAgent *umpire.Agent) *UmpireServer {
+// NewUmpireServer serves judgements with localAgent, queueing /judge
+// requests in store for workers to run. A nil store keeps jobs in memory
+// only.
+func NewUmpireServer(localAgent *umpire.Agent, store jobs.Store, workers int) *UmpireServer {
 	if localAgent == nil {
 		return nil
 	}
+	if store == nil {
+		store = jobs.NewMemoryStore()
+	}
+	if localAgent.Problems == nil {
+		localAgent.Problems = umpire.NewProblemStore(nil)
+	}
 	e := echo.New()
+	ctx, cancel := context.WithCancel(context.Background())
 	server := &UmpireServer{
-		localAgent,
-		e,
+		localAgent: localAgent,
+		e:          e,
+		ctx:        ctx,
+		cancel:     cancel,
+		drain:      make(chan struct{}),
+		events:     newEventBroker(),
+		problems:   problems.NewMemoryStore(),
+		open:       *open,
+	}
+	server.submissions = submissions.NewMemoryStore()
+	server.sinks = []submissions.Sink{server.submissions}
+	hooks, err := webhooks.NewDispatcher(webhooks.NewMemoryStore(), webhooks.NewClient(), *webhookAttempts, *webhookBackoff)
+	if err != nil {
+		log.Errorf("Failed to start result deliveries: %v", err)
+		return nil
 	}
+	server.hooks = hooks
+	localAgent.Progress = server.events.Publish
+	queue, err := jobs.NewQueue(store, server.runJob, workers)
+	if err != nil {
+		log.Errorf("Failed to start judge queue: %v", err)
+		return nil
+	}
+	server.jobs = queue
 	e.Logger.SetLevel(log.INFO)
 
 	// Middleware
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins: strings.Split(*corsOrigins, ","),
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, API_KEY_HEADER},
+	}))
+	e.Use(server.authenticate)
+	e.Use(server.limit)
 
 	// Routes
-	e.POST("/judge", server.judge)
-	e.POST("/run", server.run)
-	e.POST("/validate", server.validate)
-	e.POST("/execute", server.execute)
+	server.api("POST", "/judge", server.judge, server.quota(false), server.track)
+	server.api("POST", "/run", server.run, server.quota(true), server.track)
+	server.api("POST", "/validate", server.validate, requireRole(RoleProblemSetter), server.quota(true), server.track)
+	server.api("POST", "/execute", server.execute, server.quota(true), server.track)
+	server.api("POST", "/batches", server.submitBatch, server.quota(false), server.track, middleware.BodyLimit(BATCH_BODY_LIMIT))
+	server.api("GET", "/batches/:id", server.getBatch)
+	server.api("GET", "/batches/:id/results", server.batchResults)
+	server.api("DELETE", "/batches/:id", server.cancelBatch)
+	server.api("GET", "/submissions", server.listSubmissions)
+	server.api("GET", "/submissions/:id", server.getSubmission)
+	server.api("DELETE", "/submissions/:id", server.cancelSubmission)
+	server.api("GET", "/submissions/:id/events", server.submissionEvents)
+	server.api("GET", "/submissions/:id/deliveries", server.submissionDeliveries)
+	server.api("GET", "/debug/status", server.debugStatus, requireRole(RoleAdmin))
+	server.api("POST", "/admin/reload", server.adminReload, requireRole(RoleAdmin))
+	server.api("GET", "/problems", server.listProblems)
+	server.api("GET", "/problems/:id", server.getProblem, requireRole(RoleProblemSetter))
+	server.api("PUT", "/problems/:id", server.putProblem, requireRole(RoleProblemSetter))
+	server.api("DELETE", "/problems/:id", server.deleteProblem, requireRole(RoleProblemSetter))
+	server.api("POST", "/problems/:id/testcases", server.uploadTestcases, requireRole(RoleProblemSetter), middleware.BodyLimit("64M"))
+	server.api("POST", "/problems/:id/rejudge", server.rejudgeProblem, requireRole(RoleProblemSetter))
+	e.GET("/openapi.json", server.openAPI)
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+	e.GET("/healthz", server.healthz)
+	e.GET("/readyz", server.readyz)
 
 	return server
 }
 
+// API_VERSION prefixes the API routes. The unversioned routes they had
+// before are kept as aliases.
+const API_VERSION = "/v1"
+
+// api registers handler at API_VERSION+path and at path.
+func (us *UmpireServer) api(method, path string, handler echo.HandlerFunc, middleware ...echo.MiddlewareFunc) {
+	us.e.Add(method, API_VERSION+path, handler, middleware...)
+	us.e.Add(method, path, handler, middleware...)
+}
+
+// routePath is the route of the request without API_VERSION, so that an
+// alias and its versioned route share auth exemptions and rate limits.
+func routePath(c echo.Context) string {
+	return strings.TrimPrefix(c.Path(), API_VERSION)
+}
+
+// submissionRef answers requests that create or change a submission.
+type submissionRef struct {
+	Id     string     `json:"id"`
+	Status jobs.State `json:"status"`
+}
+
 func (us *UmpireServer) judge(c echo.Context) error {
-	localAgent := us.localAgent
-	payload := &umpire.Payload{}
-	if err := c.Bind(payload); err != nil {
+	req := &judgeRequest{}
+	if err := c.Bind(req); err != nil {
 		return err
 	}
+	callback, err := req.callback(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	payload := &req.Payload
+	if err := us.localAgent.ValidatePayload(payload, true); err != nil {
+		return invalidRequest(c, err)
+	}
 	c.Logger().Infof("judge: %#v", payload)
-	done := make(chan *umpire.Response)
-	go func() {
-		done <- umpire.JudgeDefault(localAgent, payload)
-	}()
-	for {
-		select {
-		case out := <-done:
-			go func() { createSubmission("anon", payload, out) }()
-			return c.JSON(http.StatusCreated, out)
-		case <-time.After(60 * time.Second):
-			return c.JSON(http.StatusCreated, map[string]string{"status": "pending"})
-		}
+	job, err := us.jobs.Submit(caller(c), payload, callback)
+	if err == jobs.ErrQueueFull || err == jobs.ErrQueueClosed {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
 	}
-
+	if err != nil {
+		return err
+	}
+	us.events.Publish(&umpire.Event{SubmissionId: job.Id, Type: umpire.EventQueued, Time: job.Created})
+	return c.JSON(http.StatusAccepted, &submissionRef{job.Id, job.State})
 }
 
 func (us *UmpireServer) run(c echo.Context) error {
@@ -148,8 +455,14 @@ func (us *UmpireServer) run(c echo.Context) error {
 	if err := c.Bind(payload); err != nil {
 		return err
 	}
+	if err := us.localAgent.ValidatePayload(payload, true); err != nil {
+		return invalidRequest(c, err)
+	}
+	if payload.SubmissionId == "" {
+		payload.SubmissionId = umpire.RandStringRunes(16)
+	}
 	c.Logger().Infof("run: %#v", payload)
-	out := umpire.RunDefault(localAgent, payload)
+	out := umpire.RunContext(us.execContext(c), localAgent, payload)
 	return c.JSON(http.StatusOK, out)
 }
 
@@ -159,8 +472,14 @@ func (us *UmpireServer) execute(c echo.Context) error {
 	if err := c.Bind(payload); err != nil {
 		return err
 	}
+	if err := us.localAgent.ValidatePayload(payload, false); err != nil {
+		return invalidRequest(c, err)
+	}
+	if payload.SubmissionId == "" {
+		payload.SubmissionId = umpire.RandStringRunes(16)
+	}
 	c.Logger().Infof("execute: %#v", payload)
-	out := umpire.ExecuteDefault(localAgent, payload)
+	out := umpire.ExecuteContext(us.execContext(c), localAgent, payload)
 	return c.JSON(http.StatusOK, out)
 }
 
@@ -170,7 +489,10 @@ func (us *UmpireServer) validate(c echo.Context) error {
 	if err := c.Bind(jd); err != nil {
 		return err
 	}
-	err, out := umpire.Validate(localAgent, jd)
+	if err := us.localAgent.ValidateJudgeData(jd); err != nil {
+		return invalidRequest(c, err)
+	}
+	err, out := umpire.ValidateContext(us.execContext(c), localAgent, jd)
 	if err != nil {
 		return err
 	}
@@ -198,46 +520,53 @@ func fetchProblems(apiUrl string) (map[string]*umpire.JudgeData, error) {
 	return v, nil
 }
 
-func updateJudgeData(agent *umpire.Agent, cachefile, problemsdir, serverdb *string) {
-	m := map[string]*umpire.JudgeData{}
+func updateJudgeData(agent *umpire.Agent, cachefile, problemsdir, serverdb *string, published problems.Store) {
+	errs := []string{}
 	if problemsdir != nil && *problemsdir != "" {
 		data := map[string]*umpire.JudgeData{}
 		log.Infof("Using %s directory as source of problems", *problemsdir)
-		if err := umpire.ReadAllProblems(data, *problemsdir); err == nil {
-			log.Infof("number of problems read from directory=%d", len(data))
-			for k, v := range data {
-				m[k] = v
-			}
+		failed, err := umpire.ReadProblems(data, *problemsdir)
+		countRefresh("problemsdir", err)
+		if err == nil {
+			log.Infof("number of problems read from directory=%d, failed=%d", len(data), len(failed))
+			sources.setDir(data, failed)
 		} else {
-			log.Infof("data=%+v, err=%v in reading problemsdir", data, err)
+			log.Warnf("err=%v in reading problemsdir", err)
+			errs = append(errs, fmt.Sprintf("problemsdir: %v", err))
 		}
 	}
 
 	if cachefile != nil && *cachefile != "" {
-		log.Infof("Using %s as source of problems", umpire.UmpireCacheFilename)
-		if data, err := umpire.ReadCache(); err == nil {
-			log.Infof("number of problems read from directory=%d", len(data))
-			for k, v := range data {
-				m[k] = v
-			}
+		filename := expandHome(*cachefile)
+		log.Infof("Using %s as source of problems", filename)
+		data, err := umpire.ReadCacheFile(filename)
+		countRefresh("cachefile", err)
+		if err == nil {
+			log.Infof("number of problems read from cache file=%d", len(data))
+			sources.set(&sources.cache, data)
 		} else {
-			log.Infof("data=%+v, err=%v in reading problemsdir", data, err)
+			log.Infof("err=%v in reading cache file", err)
+			if !os.IsNotExist(err) {
+				errs = append(errs, fmt.Sprintf("cachefile: %v", err))
+			}
 		}
 	}
 
 	if serverdb != nil && *serverdb != "" {
 		log.Infof("Fetching problems from %s", *serverdb)
-		if data, err := fetchProblems(*serverdb); err == nil && data != nil {
-			for k, v := range data {
-				m[k] = v
-			}
+		data, err := fetchProblems(*serverdb)
+		countRefresh("serverdb", err)
+		if err == nil && data != nil {
+			sources.set(&sources.serverdb, data)
 		} else {
-			log.Infof("data=%+v, err=%v in fetching problems", data, err)
+			log.Warnf("data=%+v, err=%v in fetching problems", data, err)
+			errs = append(errs, fmt.Sprintf("serverdb: %v", err))
 		}
 	}
-	judgeDataSource[(currentSrc+1)%2] = m
-	currentSrc = (currentSrc + 1) % 2
-	// Make the following step safe for concurrent use
-	agent.Data = judgeDataSource[currentSrc]
-	log.Infof("data=%+v", agent.Data)
+
+	loaded, publishErr := installProblems(agent, published)
+	if publishErr != nil {
+		errs = append(errs, fmt.Sprintf("problemsdb: %v", publishErr))
+	}
+	lastRefresh.set(loaded, errs)
 }
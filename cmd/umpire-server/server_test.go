@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"github.com/maddyonline/umpire"
 	"github.com/maddyonline/umpire/pkg/dockerutils"
+	"github.com/maddyonline/umpire/pkg/submissions"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -56,7 +57,7 @@ func TestEndToEnd(t *testing.T) {
 	if agent.Client == nil {
 		t.Fatalf("Failed to initialize docker client")
 	}
-	server := NewUmpireServer(agent)
+	server := NewUmpireServer(agent, nil, 4)
 	e := server.e
 	e.Logger.SetOutput(ioutil.Discard)
 	req := jsonPostRequest(t, "/execute", []byte(raw))
@@ -70,3 +71,17 @@ func TestEndToEnd(t *testing.T) {
 	expected := map[string]string{"stderr": "", "status": "pass", "details": "", "stdout": "0 1\n0 2\n"}
 	assertMapEqual(t, got, expected)
 }
+
+func TestServerdbRequestEscapesUid(t *testing.T) {
+	saved := *serverdb
+	*serverdb = "http://localhost:3033"
+	defer func() { *serverdb = saved }()
+	sub := &submissions.Submission{Id: "s1", Uid: "../admin?x=1", Payload: &umpire.Payload{}, Result: &umpire.Response{}}
+	url, _, err := serverdbRequest(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "http://localhost:3033/users/..%2Fadmin%3Fx=1/submissions"; url != expected {
+		t.Errorf("got %s, expected %s", url, expected)
+	}
+}
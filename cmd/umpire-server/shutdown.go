@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/umpire"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// track counts a request as in-flight work and turns new work away once
+// shutdown has started.
+func (us *UmpireServer) track(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if atomic.LoadInt32(&us.draining) != 0 {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "server is shutting down")
+		}
+		us.inflight.Add(1)
+		defer us.inflight.Done()
+		return next(c)
+	}
+}
+
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Shutdown stops accepting work, gives in-flight judgements until grace to
+// finish, cancels the rest, removes this process's containers, makes the
+// result deliveries that are due and closes the submission sinks. Queued
+// and interrupted judge jobs stay in the job store and run after restart,
+// as do the result deliveries to callbacks and serverdb waiting in
+// -deliveriesdb.
+func (us *UmpireServer) Shutdown(grace time.Duration) {
+	atomic.StoreInt32(&us.draining, 1)
+	close(us.drain)
+	deadline := time.Now().Add(grace)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	// The queue stops taking jobs right away rather than once the HTTP
+	// connections are idle; both drain against the same deadline.
+	var drained sync.WaitGroup
+	drained.Add(2)
+	go func() {
+		defer drained.Done()
+		if err := us.e.Shutdown(ctx); err != nil {
+			log.Warnf("Shutdown: http server: %v", err)
+		}
+	}()
+	go func() {
+		defer drained.Done()
+		us.jobs.Shutdown(ctx)
+	}()
+	var grpcStopped chan struct{}
+	if us.grpc != nil {
+		grpcStopped = make(chan struct{})
+		go func() {
+			stopGRPC(us.grpc, deadline)
+			close(grpcStopped)
+		}()
+	}
+	drained.Wait()
+	if !waitTimeout(&us.inflight, deadline.Sub(time.Now())) {
+		log.Warnf("Shutdown: grace period of %v over, cancelling in-flight judgements", grace)
+		us.cancel()
+		if !waitTimeout(&us.inflight, 10*time.Second) {
+			log.Warnf("Shutdown: judgements still running after cancel")
+		}
+	}
+	us.cancel()
+	if grpcStopped != nil {
+		<-grpcStopped
+	}
+	reaper := &umpire.Reaper{Client: us.localAgent.Client, All: true, Owner: umpire.Owner}
+	if removed, err := reaper.Reap(context.Background()); err != nil {
+		log.Warnf("Shutdown: removing containers: %v", err)
+	} else {
+		log.Infof("Shutdown: removed %d containers", len(removed))
+	}
+	if !us.hooks.Close(10 * time.Second) {
+		log.Warnf("Shutdown: some judge results were not delivered, they will be after restart")
+	}
+	us.closeSinks()
+	log.Info("Shutdown complete")
+}
+
+// closeSinks closes the submission sinks last to first, the submission
+// store last.
+func (us *UmpireServer) closeSinks() {
+	for i := len(us.sinks) - 1; i >= 0; i-- {
+		if err := us.sinks[i].Close(); err != nil {
+			log.Warnf("Shutdown: closing submission sink: %v", err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/submissions"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTrackRejectsWhileDraining(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.draining = 1
+	req := jsonPostRequest(t, "/execute", []byte(raw))
+	rw := httptest.NewRecorder()
+	server.e.ServeHTTP(rw, req)
+	if rw.Code != http.StatusServiceUnavailable {
+		t.Errorf("StatusCode: expected %d, got %d", http.StatusServiceUnavailable, rw.Code)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	var wg sync.WaitGroup
+	if !waitTimeout(&wg, time.Millisecond) {
+		t.Errorf("waitTimeout: empty group should finish")
+	}
+	wg.Add(1)
+	if waitTimeout(&wg, 10*time.Millisecond) {
+		t.Errorf("waitTimeout: busy group should time out")
+	}
+	wg.Done()
+}
+
+// orderSink records when it is closed.
+type orderSink struct {
+	name   string
+	closed *[]string
+}
+
+func (s *orderSink) Record(sub *submissions.Submission) error { return nil }
+func (s *orderSink) Close() error {
+	*s.closed = append(*s.closed, s.name)
+	return nil
+}
+
+func TestCloseSinksClosesStoreLast(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	closed := []string{}
+	server.sinks = []submissions.Sink{&orderSink{"store", &closed}, &orderSink{"serverdb", &closed}}
+	server.closeSinks()
+	if len(closed) != 2 || closed[0] != "serverdb" || closed[1] != "store" {
+		t.Errorf("unexpected close order %v", closed)
+	}
+}
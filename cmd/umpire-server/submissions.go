@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/jobs"
+	"github.com/maddyonline/umpire/pkg/submissions"
+	"github.com/maddyonline/umpire/pkg/webhooks"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// judgeRequest is the body of POST /judge: a payload plus an optional
+// callback receiving the result once judging is done.
+type judgeRequest struct {
+	umpire.Payload
+	CallbackURL    string `json:"callback_url,omitempty"`
+	CallbackSecret string `json:"callback_secret,omitempty"`
+}
+
+// CALLBACK_LOOKUP_TIMEOUT bounds the lookup of a callback's host while the
+// caller waits for /judge to answer.
+const CALLBACK_LOOKUP_TIMEOUT = 2 * time.Second
+
+func (r *judgeRequest) callback(ctx context.Context) (*jobs.Callback, error) {
+	if r.CallbackURL == "" {
+		if r.CallbackSecret != "" {
+			return nil, fmt.Errorf("callback_secret given without callback_url")
+		}
+		return nil, nil
+	}
+	u, err := url.Parse(r.CallbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("callback_url must be an absolute http(s) URL")
+	}
+	// Deliveries check the address again when connecting; this only turns
+	// an obviously unusable callback into a 400 up front.
+	ctx, cancel := context.WithTimeout(ctx, CALLBACK_LOOKUP_TIMEOUT)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("callback_url host cannot be resolved")
+	}
+	for _, addr := range addrs {
+		if webhooks.CheckIP(addr.IP) != nil {
+			return nil, fmt.Errorf("callback_url must not point to a loopback, link-local or private address")
+		}
+	}
+	return &jobs.Callback{URL: r.CallbackURL, Secret: r.CallbackSecret}, nil
+}
+
+func (us *UmpireServer) runJob(ctx context.Context, job *jobs.Job) *umpire.Response {
+	judge := umpire.JudgeContext
+	if job.Rejudges != "" {
+		judge = umpire.RejudgeContext
+	}
+	usage := &umpire.ContainerUsage{}
+	out := judge(umpire.WithContainerUsage(ctx, usage), us.localAgent, job.Payload)
+	// Rejudges are judged on the server's behalf, not their setter's.
+	if us.limits != nil && job.Rejudges == "" {
+		us.limits.charge(job.Uid, usage.Total())
+	}
+	if ctx.Err() == nil {
+		us.deliverResult(job, out)
+	}
+	us.events.Publish(&umpire.Event{SubmissionId: job.Id, Type: umpire.EventResult, Result: out, Time: time.Now().UTC()})
+	return out
+}
+
+// deliverResult hands the result of job to every consumer: the submission
+// sinks and the job's callback. The result of a rejudge is recorded with
+// the submission it judged again instead.
+func (us *UmpireServer) deliverResult(job *jobs.Job, out *umpire.Response) {
+	if job.Rejudges != "" {
+		us.recordRejudge(job, out)
+		return
+	}
+	sub := &submissions.Submission{
+		Id:        job.Id,
+		Uid:       job.Uid,
+		Language:  job.Payload.Language,
+		Payload:   job.Payload,
+		Result:    out,
+		Submitted: job.Created,
+		Judged:    time.Now().UTC(),
+	}
+	if job.Payload.Problem != nil {
+		sub.ProblemId = job.Payload.Problem.Id
+	}
+	for _, sink := range us.sinks {
+		if err := sink.Record(sub); err != nil {
+			log.Errorf("Failed to record submission %s: %v", job.Id, err)
+		}
+	}
+	if job.Callback != nil {
+		done := *job
+		done.State = jobs.Done
+		done.Result = out
+		done.Finished = time.Now().UTC()
+		done.Callback = nil
+		body, err := json.Marshal(&done)
+		if err != nil {
+			log.Warnf("Failed to encode result of submission %s: %v", job.Id, err)
+			return
+		}
+		target := &webhooks.Target{Name: "callback", URL: job.Callback.URL, Secret: job.Callback.Secret}
+		if err := us.hooks.Deliver(target, job.Id, body); err != nil {
+			log.Errorf("Failed to queue delivery of submission %s: %v", job.Id, err)
+		}
+	}
+}
+
+// redacted returns a copy of job that is safe to show: callback secrets
+// never leave the server.
+func redacted(job *jobs.Job) *jobs.Job {
+	if job.Callback == nil || job.Callback.Secret == "" {
+		return job
+	}
+	out := *job
+	out.Callback = &jobs.Callback{URL: job.Callback.URL}
+	return &out
+}
+
+// callerJob looks up the job named by the :id parameter. Jobs submitted by
+// someone else are reported as not found, except to admins.
+func (us *UmpireServer) callerJob(c echo.Context) (*jobs.Job, error) {
+	job, err := us.jobs.Get(c.Param("id"))
+	if err == jobs.ErrNotFound || err == nil && job.Uid != caller(c) && !hasRole(c, RoleAdmin) {
+		return nil, echo.NewHTTPError(http.StatusNotFound, jobs.ErrNotFound.Error())
+	}
+	return job, err
+}
+
+func (us *UmpireServer) getSubmission(c echo.Context) error {
+	job, err := us.callerJob(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, redacted(job))
+}
+
+// MAX_LIST bounds how many submissions GET /submissions returns.
+const MAX_LIST = 500
+
+// listSubmissions returns judged submissions, newest first, filtered by
+// ?uid=, ?problem=, ?status= and the RFC 3339 times ?since= and ?until=,
+// and at most ?limit= of them. Callers other than admins only see their
+// own.
+func (us *UmpireServer) listSubmissions(c echo.Context) error {
+	q := &submissions.Query{Uid: c.QueryParam("uid"), ProblemId: c.QueryParam("problem"), Status: umpire.Decision(c.QueryParam("status")), Limit: 50}
+	for name, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if s := c.QueryParam(name); s != "" {
+			var err error
+			if *t, err = time.Parse(time.RFC3339, s); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, name+" must be an RFC 3339 time")
+			}
+		}
+	}
+	if q.Status != "" && q.Status != umpire.Pass && q.Status != umpire.Fail {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("status must be %s or %s", umpire.Pass, umpire.Fail))
+	}
+	if s := c.QueryParam("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be a positive number")
+		}
+		q.Limit = n
+	}
+	if q.Limit > MAX_LIST {
+		q.Limit = MAX_LIST
+	}
+	if !hasRole(c, RoleAdmin) {
+		if q.Uid != "" && q.Uid != caller(c) {
+			return echo.NewHTTPError(http.StatusForbidden, "admin role required to see other users' submissions")
+		}
+		q.Uid = caller(c)
+	}
+	subs, err := us.submissions.Find(q)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, subs)
+}
+
+func (us *UmpireServer) cancelSubmission(c echo.Context) error {
+	if _, err := us.callerJob(c); err != nil {
+		return err
+	}
+	job, err := us.jobs.Cancel(c.Param("id"))
+	if err == jobs.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	if job.State == jobs.Cancelled {
+		us.events.expire(job.Id)
+	}
+	return c.JSON(http.StatusOK, &submissionRef{job.Id, job.State})
+}
+
+func (us *UmpireServer) submissionDeliveries(c echo.Context) error {
+	job, err := us.callerJob(c)
+	if err != nil {
+		return err
+	}
+	deliveries, err := us.hooks.Deliveries(job.Id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// invalidRequest answers a request whose payload failed validation with
+// the validation error as JSON.
+func invalidRequest(c echo.Context, err error) error {
+	verr, ok := err.(*umpire.ValidationError)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	status := http.StatusBadRequest
+	switch verr.Code {
+	case umpire.ErrCodeUnknownProblem:
+		status = http.StatusNotFound
+	case umpire.ErrCodeSourceTooLarge, umpire.ErrCodeStdinTooLarge, umpire.ErrCodeOutputTooLarge:
+		status = http.StatusRequestEntityTooLarge
+	case umpire.ErrCodeUnknownLanguage, umpire.ErrCodeUnknownVariant:
+		status = http.StatusUnprocessableEntity
+	}
+	return c.JSON(status, verr)
+}
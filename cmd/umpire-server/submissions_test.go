@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/jobs"
+	"github.com/maddyonline/umpire/pkg/submissions"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJudgeRejectsBadCallback(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	for _, body := range []string{
+		`{"problem":{"id":"p"},"callback_url":"ftp://example.com/hook"}`,
+		`{"problem":{"id":"p"},"callback_secret":"s"}`,
+		`{"problem":{"id":"p"},"callback_url":"http://127.0.0.1:1323/hook"}`,
+		`{"problem":{"id":"p"},"callback_url":"http://169.254.169.254/latest/meta-data"}`,
+		`{"problem":{"id":"p"},"callback_url":"http://[::1]/hook"}`,
+		`{"problem":{"id":"p"},"callback_url":"http://localhost/hook"}`,
+	} {
+		rw := httptest.NewRecorder()
+		server.e.ServeHTTP(rw, jsonPostRequest(t, "/judge", []byte(body)))
+		if rw.Code != http.StatusBadRequest {
+			t.Errorf("%s: StatusCode: expected %d, got %d", body, http.StatusBadRequest, rw.Code)
+		}
+	}
+}
+
+func TestRedactedHidesCallbackSecret(t *testing.T) {
+	job := &jobs.Job{Id: "j", Callback: &jobs.Callback{URL: "http://example.com", Secret: "s"}}
+	out := redacted(job)
+	if out.Callback.Secret != "" || out.Callback.URL != job.Callback.URL {
+		t.Errorf("unexpected callback: %+v", out.Callback)
+	}
+	if job.Callback.Secret != "s" {
+		t.Errorf("redacted modified the stored job")
+	}
+}
+
+func TestInvalidPayloadIsStructured(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	rw := httptest.NewRecorder()
+	body := `{"language":"cobol","files":[{"name":"main.cob","content":""}]}`
+	server.e.ServeHTTP(rw, jsonPostRequest(t, "/execute", []byte(body)))
+	if rw.Code != http.StatusUnprocessableEntity {
+		t.Errorf("StatusCode: expected %d, got %d", http.StatusUnprocessableEntity, rw.Code)
+	}
+	verr := &umpire.ValidationError{}
+	if err := json.Unmarshal(rw.Body.Bytes(), verr); err != nil || verr.Code != umpire.ErrCodeUnknownLanguage || verr.Field != "language" {
+		t.Errorf("unexpected body %s (%v)", rw.Body.String(), err)
+	}
+}
+
+func TestListSubmissionsOnlyShowsOwn(t *testing.T) {
+	server := NewUmpireServer(&umpire.Agent{}, nil, 4)
+	server.e.Logger.SetOutput(ioutil.Discard)
+	server.auth = &AuthConfig{APIKeys: []*APIKey{{Uid: "alice", Key: "a"}, {Uid: "root", Key: "r", Roles: []string{RoleAdmin}}}}
+	for _, sub := range []*submissions.Submission{
+		{Id: "1", Uid: "alice", ProblemId: "sum", Judged: time.Now()},
+		{Id: "2", Uid: "bob", ProblemId: "sum", Judged: time.Now()},
+	} {
+		server.submissions.Record(sub)
+	}
+	list := func(key, query string) (int, []*submissions.Submission) {
+		req, _ := http.NewRequest("GET", "/submissions"+query, nil)
+		req.Header.Set(API_KEY_HEADER, key)
+		rw := httptest.NewRecorder()
+		server.e.ServeHTTP(rw, req)
+		subs := []*submissions.Submission{}
+		json.Unmarshal(rw.Body.Bytes(), &subs)
+		return rw.Code, subs
+	}
+	if code, subs := list("a", "?problem=sum"); code != http.StatusOK || len(subs) != 1 || subs[0].Id != "1" {
+		t.Errorf("alice: got %d %+v", code, subs)
+	}
+	if code, _ := list("a", "?uid=bob"); code != http.StatusForbidden {
+		t.Errorf("alice asking for bob: StatusCode: expected %d, got %d", http.StatusForbidden, code)
+	}
+	if code, subs := list("r", "?problem=sum"); code != http.StatusOK || len(subs) != 2 {
+		t.Errorf("admin: got %d %+v", code, subs)
+	}
+	if code, _ := list("a", "?status=passed"); code != http.StatusBadRequest {
+		t.Errorf("unknown status: StatusCode: expected %d, got %d", http.StatusBadRequest, code)
+	}
+}
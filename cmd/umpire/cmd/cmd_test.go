@@ -1 +1,47 @@
 package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRejudgeWaitsForResults(t *testing.T) {
+	polls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/problems/sum/rejudge":
+			body, _ := ioutil.ReadAll(r.Body)
+			if r.Header.Get("X-API-Key") != "s" || string(body) != "{\"status\":\"pass\"}\n" {
+				t.Errorf("unexpected request %v %s", r.Header, body)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"batch":"b1","total":2}`)
+		case "GET /v1/batches/b1":
+			polls++
+			fmt.Fprint(w, `{"done":2,"complete":true}`)
+		case "GET /v1/batches/b1/results":
+			fmt.Fprint(w, `{"rejudges":"s1","previous":"pass","result":{"status":"fail"}}`+"\n")
+			fmt.Fprint(w, `{"rejudges":"s2","previous":"pass","result":{"status":"pass"}}`+"\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"Problem not found"}`)
+		}
+	}))
+	defer ts.Close()
+	defer func() { rejudgeStatus = "" }()
+	rejudgeStatus = "pass"
+	if err := rejudge(&umpireClient{server: ts.URL, apiKey: "s", client: ts.Client()}, "sum", true); err != nil {
+		t.Fatal(err)
+	}
+	if polls != 1 {
+		t.Errorf("expected one poll, got %d", polls)
+	}
+	if err := rejudge(&umpireClient{server: ts.URL, client: ts.Client()}, "nope", false); err == nil {
+		t.Errorf("expected an error for an unknown problem")
+	} else if err.Error() != "POST /problems/nope/rejudge: 404 Not Found Problem not found" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
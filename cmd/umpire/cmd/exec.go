@@ -23,7 +23,10 @@ import (
 	"os"
 )
 
-var language string
+var (
+	language string
+	variant  string
+)
 
 // execCmd represents the exec command
 var execCmd = &cobra.Command{
@@ -34,9 +37,11 @@ var execCmd = &cobra.Command{
 One may run cpp source files in the current directory
 by running: ump exec . input.txt
 More generally, one can run as follows.
-ump exec <source-dir> [<input.txt>] -L python`,
+ump exec <source-dir> [<input.txt>] -L python
+A language variant, such as a compiler standard, can be picked with -V:
+ump exec . input.txt -L cpp -V c++17`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("exec called with args: %v with language=%s\n", args, language)
+		fmt.Printf("exec called with args: %v with language=%s variant=%s\n", args, language, variant)
 		agent := &umpire.Agent{
 			Client: dockerutils.NewClient(),
 		}
@@ -53,6 +58,7 @@ ump exec <source-dir> [<input.txt>] -L python`,
 			fmt.Printf("Err: %v\n", err)
 			return
 		}
+		payload.Variant = variant
 		json.NewEncoder(os.Stdout).Encode(payload)
 		exec(agent, payload)
 	},
@@ -74,5 +80,6 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	execCmd.Flags().StringVarP(&language, "lang", "L", "cpp", "Programming language of source file(s)")
+	execCmd.Flags().StringVarP(&variant, "variant", "V", "", "Language variant, e.g. c++17 (default is the language's default variant)")
 
 }
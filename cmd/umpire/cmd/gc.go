@@ -0,0 +1,67 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/dockerutils"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+var (
+	gcMaxAge time.Duration
+	gcAll    bool
+	gcDryRun bool
+)
+
+// gcCmd represents the gc command
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "removes judge containers leaked by umpire",
+	Long: `Removes containers labeled by umpire whose owning process has exited
+or that are older than --max-age. Containers without umpire labels are never touched.
+
+umpire gc --max-age=10m
+umpire gc --all --dry-run`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cli := dockerutils.NewClient()
+		if cli == nil {
+			fmt.Println("Failed to initialze docker client")
+			os.Exit(1)
+		}
+		reaper := &umpire.Reaper{Client: cli, MaxAge: gcMaxAge, All: gcAll, DryRun: gcDryRun}
+		removed, err := reaper.Reap(context.Background())
+		if err != nil {
+			fmt.Printf("Err: %v\n", err)
+			os.Exit(1)
+		}
+		for _, id := range removed {
+			fmt.Println(id)
+		}
+		fmt.Printf("removed %d containers\n", len(removed))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(gcCmd)
+
+	gcCmd.Flags().DurationVar(&gcMaxAge, "max-age", 10*time.Minute, "remove labeled containers older than this")
+	gcCmd.Flags().BoolVar(&gcAll, "all", false, "remove every umpire container, including ones owned by running processes")
+	gcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "only list the containers that would be removed")
+}
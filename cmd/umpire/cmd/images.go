@@ -0,0 +1,165 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/dockerutils"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var registry string
+
+func imageManager() *umpire.ImageManager {
+	cli := dockerutils.NewClient()
+	if cli == nil {
+		fmt.Println("Failed to initialze docker client")
+		os.Exit(1)
+	}
+	return umpire.NewImageManager(cli, registry)
+}
+
+func printImageStatuses(statuses []*umpire.ImageStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tPRESENT\tDIGEST\tLANGUAGES\tERROR")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%s\t%v\t%s\t%s\t%s\n", s.Image, s.Present, s.Digest, strings.Join(s.Languages, ","), s.Error)
+	}
+	w.Flush()
+}
+
+// imagesCmd represents the images command
+var imagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "lists, verifies and pulls the judge images",
+	Long: `Manages the docker images named in the language configuration.
+
+umpire images list      shows every configured image and its digest
+umpire images verify    fails unless every image is present and matches its pinned digest
+umpire images pull      pulls missing or mismatched images, by pinned digest, optionally from --registry
+umpire images export <file>   bundles the configured images into one tarball
+umpire images import <file>   loads a bundle on a host without network access`,
+	Run: func(cmd *cobra.Command, args []string) {
+		printImageStatuses(imageManager().List(context.Background()))
+	},
+}
+
+var imagesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists the configured judge images",
+	Run: func(cmd *cobra.Command, args []string) {
+		printImageStatuses(imageManager().List(context.Background()))
+	},
+}
+
+var imagesVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "verifies every configured judge image is present",
+	Run: func(cmd *cobra.Command, args []string) {
+		statuses, err := imageManager().Verify(context.Background())
+		printImageStatuses(statuses)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+var imagesPullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "pulls missing judge images and ones not matching their pinned digest",
+	Run: func(cmd *cobra.Command, args []string) {
+		statuses, err := imageManager().Ensure(context.Background(), true)
+		printImageStatuses(statuses)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+var imagesExportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "bundles the configured judge images into a tarball",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Println("Usage: umpire images export <file>")
+			return
+		}
+		f, err := os.Create(args[0])
+		if err != nil {
+			fmt.Printf("Err: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		manifest, err := imageManager().Export(context.Background(), f)
+		if err != nil {
+			fmt.Printf("Err: %v\n", err)
+			os.Remove(args[0])
+			os.Exit(1)
+		}
+		for _, image := range manifest.Images {
+			fmt.Printf("exported %s (%s, sha256 %s)\n", image.Image, image.Digest, image.Sha256)
+		}
+	},
+}
+
+var imagesImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "loads judge images from a bundle made by export",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Println("Usage: umpire images import <file>")
+			return
+		}
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Printf("Err: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		m := imageManager()
+		manifest, err := m.Import(context.Background(), f)
+		if err != nil {
+			fmt.Printf("Err: %v\n", err)
+			os.Exit(1)
+		}
+		for _, image := range manifest.Images {
+			fmt.Printf("imported %s (%s)\n", image.Image, image.Digest)
+		}
+		statuses, err := m.Verify(context.Background())
+		printImageStatuses(statuses)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(imagesCmd)
+	imagesCmd.AddCommand(imagesListCmd)
+	imagesCmd.AddCommand(imagesVerifyCmd)
+	imagesCmd.AddCommand(imagesPullCmd)
+	imagesCmd.AddCommand(imagesExportCmd)
+	imagesCmd.AddCommand(imagesImportCmd)
+
+	imagesCmd.PersistentFlags().StringVar(&registry, "registry", "", "registry to pull judge images from (default is Docker Hub)")
+}
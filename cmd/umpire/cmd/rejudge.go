@@ -0,0 +1,190 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	rejudgeServer string
+	rejudgeAPIKey string
+	rejudgeStatus string
+	rejudgeSince  string
+	rejudgeUntil  string
+	rejudgeWait   bool
+)
+
+// rejudgeRef is the answer of umpire-server to a rejudge.
+type rejudgeRef struct {
+	Batch   string `json:"batch"`
+	Total   int    `json:"total"`
+	Skipped int    `json:"skipped"`
+}
+
+// rejudgeLine is one line of the results of a rejudge batch.
+type rejudgeLine struct {
+	Rejudges string `json:"rejudges"`
+	Previous string `json:"previous"`
+	Result   *struct {
+		Status  string `json:"status"`
+		Details string `json:"details"`
+	} `json:"result"`
+}
+
+// umpireClient calls the API of an umpire-server.
+type umpireClient struct {
+	server string
+	apiKey string
+	client *http.Client
+}
+
+// call sends body, when not nil, as JSON and decodes the JSON answer into
+// out, which may be nil. Statuses other than want are errors.
+func (uc *umpireClient) call(method, path string, body interface{}, want int, out interface{}) (*http.Response, error) {
+	var b bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&b).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(uc.server, "/")+"/v1"+path, &b)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if uc.apiKey != "" {
+		req.Header.Set("X-API-Key", uc.apiKey)
+	}
+	res, err := uc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != want {
+		defer res.Body.Close()
+		msg := &struct {
+			Message string `json:"message"`
+		}{}
+		json.NewDecoder(res.Body).Decode(msg)
+		return nil, fmt.Errorf("%s %s: %s %s", method, path, res.Status, msg.Message)
+	}
+	if out == nil {
+		return res, nil
+	}
+	defer res.Body.Close()
+	return res, json.NewDecoder(res.Body).Decode(out)
+}
+
+// rejudge starts rejudging problem and, if wait is set, waits for it to
+// finish and prints the submissions whose verdict changed.
+func rejudge(uc *umpireClient, problem string, wait bool) error {
+	req := map[string]string{}
+	if rejudgeStatus != "" {
+		req["status"] = rejudgeStatus
+	}
+	for name, value := range map[string]string{"since": rejudgeSince, "until": rejudgeUntil} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return fmt.Errorf("--%s must be an RFC 3339 time such as 2017-03-01T00:00:00Z", name)
+		}
+		req[name] = value
+	}
+	ref := &rejudgeRef{}
+	if _, err := uc.call("POST", "/problems/"+problem+"/rejudge", req, http.StatusAccepted, ref); err != nil {
+		return err
+	}
+	fmt.Printf("rejudging %d submissions of %s in batch %s (%d skipped)\n", ref.Total, problem, ref.Batch, ref.Skipped)
+	if !wait {
+		return nil
+	}
+	for {
+		status := &struct {
+			Done     int  `json:"done"`
+			Complete bool `json:"complete"`
+		}{}
+		if _, err := uc.call("GET", "/batches/"+ref.Batch, nil, http.StatusOK, status); err != nil {
+			return err
+		}
+		if status.Complete {
+			break
+		}
+		fmt.Printf("%d/%d done\n", status.Done, ref.Total)
+		time.Sleep(2 * time.Second)
+	}
+	res, err := uc.call("GET", "/batches/"+ref.Batch+"/results", nil, http.StatusOK, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	changed := 0
+	dec := json.NewDecoder(res.Body)
+	for dec.More() {
+		line := &rejudgeLine{}
+		if err := dec.Decode(line); err != nil {
+			return err
+		}
+		if line.Result == nil || line.Result.Status == line.Previous {
+			continue
+		}
+		changed++
+		fmt.Println(strings.TrimSpace(fmt.Sprintf("%s: %s -> %s %s", line.Rejudges, line.Previous, line.Result.Status, line.Result.Details)))
+	}
+	fmt.Printf("%d verdicts changed\n", changed)
+	return nil
+}
+
+// rejudgeCmd represents the rejudge command
+var rejudgeCmd = &cobra.Command{
+	Use:   "rejudge <problem>",
+	Short: "judges stored submissions of a problem again on an umpire-server",
+	Long: `Asks an umpire-server to judge the stored submissions of a problem again
+against its current testcases, for example after fixing a wrong expected
+output. The submissions are judged in the background; new verdicts are
+recorded with each submission next to its original one.
+
+umpire rejudge sum --server=http://localhost:1323 --api-key=...
+umpire rejudge sum --status=pass --since=2017-03-01T00:00:00Z --wait`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Println("Usage: umpire rejudge <problem>")
+			os.Exit(1)
+		}
+		uc := &umpireClient{server: rejudgeServer, apiKey: rejudgeAPIKey, client: &http.Client{Timeout: time.Minute}}
+		if err := rejudge(uc, args[0], rejudgeWait); err != nil {
+			fmt.Printf("Err: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(rejudgeCmd)
+
+	rejudgeCmd.Flags().StringVar(&rejudgeServer, "server", "http://localhost:1323", "umpire-server to rejudge on")
+	rejudgeCmd.Flags().StringVar(&rejudgeAPIKey, "api-key", os.Getenv("UMPIRE_API_KEY"), "API key of a problem setter, $UMPIRE_API_KEY by default")
+	rejudgeCmd.Flags().StringVar(&rejudgeStatus, "status", "", "only rejudge submissions with this verdict, pass or fail")
+	rejudgeCmd.Flags().StringVar(&rejudgeSince, "since", "", "only rejudge submissions made at or after this RFC 3339 time")
+	rejudgeCmd.Flags().StringVar(&rejudgeUntil, "until", "", "only rejudge submissions made before this RFC 3339 time")
+	rejudgeCmd.Flags().BoolVar(&rejudgeWait, "wait", false, "wait for the rejudge to finish and list the changed verdicts")
+}
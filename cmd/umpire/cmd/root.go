@@ -18,11 +18,15 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/maddyonline/umpire"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-var cfgFile string
+var (
+	cfgFile       string
+	languagesFile string
+)
 
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
@@ -56,6 +60,8 @@ func init() {
 	// will be global for your application.
 
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.umpire.yaml)")
+	RootCmd.PersistentFlags().StringVar(&languagesFile, "languages", "", "JSON file describing language images and variants")
+	viper.BindPFlag("languages", RootCmd.PersistentFlags().Lookup("languages"))
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	RootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
@@ -75,4 +81,11 @@ func initConfig() {
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Println("Using config file:", viper.ConfigFileUsed())
 	}
+
+	if languages := viper.GetString("languages"); languages != "" {
+		if err := umpire.LoadLanguages(languages); err != nil {
+			fmt.Printf("Failed to load languages from %s: %v\n", languages, err)
+			os.Exit(1)
+		}
+	}
 }
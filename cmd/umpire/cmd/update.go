@@ -23,6 +23,7 @@ import (
 
 var (
 	overwrite bool
+	cacheFile string
 )
 
 // updateCmd represents the update command
@@ -40,7 +41,13 @@ to quickly create a Cobra application.`,
 			log.Println("Usage: umpire update <directory>")
 			return
 		}
-		data, err := umpire.ReadCache()
+		var data map[string]*umpire.JudgeData
+		var err error
+		if cacheFile != "" {
+			data, err = umpire.ReadCacheFile(cacheFile)
+		} else {
+			data, err = umpire.ReadCache()
+		}
 		if err != nil {
 			log.Printf("Warning: Got err %v while reading cachefile", err)
 			data = map[string]*umpire.JudgeData{}
@@ -57,7 +64,11 @@ to quickly create a Cobra application.`,
 			}
 			umpire.ReadAllProblems(data, dir)
 		}
-		umpire.UpdateCache(data)
+		if cacheFile != "" {
+			umpire.UpdateCacheFile(cacheFile, data)
+		} else {
+			umpire.UpdateCache(data)
+		}
 		log.Printf("updated cache, number of problems: %d\n", len(data))
 	},
 }
@@ -74,5 +85,6 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	updateCmd.Flags().BoolVarP(&overwrite, "overwrite", "w", false, "Overwrite cache file")
+	updateCmd.Flags().StringVar(&cacheFile, "cachefile", "", "Cache file to update, the one umpire-server -cachefile reads (default $HOME/.umpire.cache.json)")
 
 }
@@ -25,8 +25,8 @@ import (
 
 func validate(args []string) {
 	agent := &umpire.Agent{
-		Client: dockerutils.NewClient(),
-		Data:   make(map[string]*umpire.JudgeData),
+		Client:   dockerutils.NewClient(),
+		Problems: umpire.NewProblemStore(nil),
 	}
 	data := map[string]*umpire.JudgeData{}
 	for _, input := range args {
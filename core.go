@@ -11,6 +11,7 @@ import (
 	"github.com/labstack/gommon/log"
 	"io/ioutil"
 	"net"
+	"time"
 )
 
 type PayloadResult struct {
@@ -20,38 +21,38 @@ type PayloadResult struct {
 }
 
 func payloadRun(ctx context.Context, cli *client.Client, payload *Payload) (*PayloadResult, error) {
-	var configMap = map[string]struct {
-		Cmd   []string
-		Image string
-	}{
-		"cpp":        {[]string{"-stream=false"}, "phluent/clang"},
-		"python":     {[]string{"-stream=false"}, "phluent/python"},
-		"javascript": {[]string{"-stream=false"}, "phluent/javascript"},
-		"typescript": {[]string{"-stream=false"}, "phluent/typescript"},
+	cfg, err := resolveLanguage(payload.Language, payload.Variant)
+	if err != nil {
+		return nil, err
 	}
-	cfg := configMap[payload.Language]
+	env, _ := markedEnv(cfg.Env)
 	config := &container.Config{
 		Image:       cfg.Image,
-		Cmd:         cfg.Cmd,
+		Cmd:         append(cfg.Cmd, "-stream=false"),
+		Env:         env,
+		Labels:      containerLabels(payload),
 		AttachStdin: true,
 		OpenStdin:   true,
 		StdinOnce:   false,
 	}
 
-	resp, err := cli.ContainerCreate(ctx, config, &container.HostConfig{}, &network.NetworkingConfig{}, "")
+	start := time.Now()
+	resp, err := cli.ContainerCreate(ctx, config, cfg.hostConfig(), &network.NetworkingConfig{}, "")
 	if err != nil {
-		return nil, err
+		return nil, imageCreateError(cfg.Image, dockerError("create", err))
 	}
 	containerId := resp.ID
+	timer := newContainerTimer(ctx, payload.Language, start)
 
 	defer func() {
 		log.Infof("Cleaning up docker container %s", containerId)
-		cli.ContainerRemove(context.Background(), containerId, types.ContainerRemoveOptions{Force: true})
+		timer.removed()
+		dockerError("remove", cli.ContainerRemove(context.Background(), containerId, types.ContainerRemoveOptions{Force: true}))
 	}()
 
 	err = cli.ContainerStart(ctx, containerId, types.ContainerStartOptions{})
 	if err != nil {
-		return nil, err
+		return nil, dockerError("start", err)
 	}
 
 	data, err := json.Marshal(payload)
@@ -63,8 +64,9 @@ func payloadRun(ctx context.Context, cli *client.Client, payload *Payload) (*Pay
 		Stream: true,
 	})
 	if err != nil {
-		return nil, err
+		return nil, dockerError("attach", err)
 	}
+	timer.phase(PhaseSetup)
 	go func(data []byte, conn net.Conn) {
 		defer func() { log.Printf("done writing to attached stdin") }()
 		defer conn.Close()
@@ -74,22 +76,30 @@ func payloadRun(ctx context.Context, cli *client.Client, payload *Payload) (*Pay
 		}
 	}(data, hijackedResp.Conn)
 
-	cli.ContainerWait(ctx, containerId)
+	if _, err := cli.ContainerWait(ctx, containerId); err != nil {
+		dockerError("wait", err)
+	} else {
+		timer.exit()
+	}
 	stdout, err := cli.ContainerLogs(ctx, containerId, types.ContainerLogsOptions{
 		ShowStdout: true,
 		Follow:     true,
 	})
 	if err != nil {
-		return nil, err
+		return nil, dockerError("logs", err)
 	}
 	out, err := ioutil.ReadAll(stdout)
 	log.Infof("payloadRun: %q", string(out))
 	if err != nil {
 		return nil, err
 	}
-	v := &PayloadResult{}
+	v := &struct {
+		*PayloadResult
+		CompileSeconds float64 `json:"compile_seconds"`
+	}{PayloadResult: &PayloadResult{}}
 	if err := json.NewDecoder(bytes.NewReader(out[8:])).Decode(v); err != nil {
 		return nil, err
 	}
-	return v, nil
+	timer.compiled(time.Duration(v.CompileSeconds * float64(time.Second)))
+	return v.PayloadResult, nil
 }
@@ -0,0 +1,193 @@
+package umpire
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"strings"
+)
+
+// RunOutputLimit bounds how much of each output of a run, the user's and the
+// reference solution's, is kept and returned. The verdict still covers the
+// full outputs.
+var RunOutputLimit = 64 << 10
+
+// MAX_DIFF_CELLS bounds the line-by-line comparison table built by Diff,
+// 4 bytes a cell; beyond it the differing middle of two outputs is compared
+// line by line at the same positions instead.
+const MAX_DIFF_CELLS = 1 << 20
+
+// MISSING_LINE stands for the line one output lacks in a mismatch error.
+const MISSING_LINE = "<missing>"
+
+type DiffOp string
+
+const (
+	DiffEqual   DiffOp = "equal"
+	DiffChanged DiffOp = "changed"
+	// DiffExtra rows hold a line only the user's output has.
+	DiffExtra DiffOp = "extra"
+	// DiffMissing rows hold a line only the expected output has.
+	DiffMissing DiffOp = "missing"
+)
+
+// DiffRow is one row of a side-by-side diff. Line numbers start at 1; a
+// side without a line in the row has number 0.
+type DiffRow struct {
+	Op           DiffOp `json:"op"`
+	GotLine      int    `json:"got_line,omitempty"`
+	Got          string `json:"got,omitempty"`
+	ExpectedLine int    `json:"expected_line,omitempty"`
+	Expected     string `json:"expected,omitempty"`
+}
+
+// outputCapture keeps the first RunOutputLimit bytes of an output and a
+// hash of all of it, so two outputs of any size can be compared afterwards.
+// Lines ending in "\r\n" are kept as ending in "\n", as the line scanner
+// judging testcases reads them.
+type outputCapture struct {
+	limit     int
+	kept      bytes.Buffer
+	partial   []byte
+	sum       hash.Hash
+	truncated bool
+}
+
+func newOutputCapture(limit int) *outputCapture {
+	return &outputCapture{limit: limit, sum: sha256.New()}
+}
+
+// Write never fails, so the program writing is never held up.
+func (c *outputCapture) Write(p []byte) (int, error) {
+	c.partial = append(c.partial, p...)
+	for {
+		i := bytes.IndexByte(c.partial, '\n')
+		if i < 0 {
+			break
+		}
+		c.line(c.partial[:i+1])
+		c.partial = c.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+func (c *outputCapture) line(line []byte) {
+	if bytes.HasSuffix(line, []byte("\r\n")) {
+		line = append(line[:len(line)-2], '\n')
+	}
+	c.sum.Write(line)
+	if c.truncated || c.kept.Len()+len(line) > c.limit {
+		c.truncated = true
+		return
+	}
+	c.kept.Write(line)
+}
+
+// close ends the output; a last line without newline counts as a line.
+func (c *outputCapture) close() {
+	if len(c.partial) > 0 {
+		c.line(append(c.partial, '\n'))
+		c.partial = nil
+	}
+}
+
+func (c *outputCapture) String() string {
+	return c.kept.String()
+}
+
+func (c *outputCapture) sameAs(other *outputCapture) bool {
+	return bytes.Equal(c.sum.Sum(nil), other.sum.Sum(nil))
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// Diff compares got with expected line by line and returns the rows of a
+// side-by-side view: a longest common subsequence of lines is shown as
+// equal, and the lines between are paired up as changed, the surplus of
+// either side being extra or missing.
+func Diff(got, expected string) []*DiffRow {
+	a, b := splitLines(got), splitLines(expected)
+	rows := []*DiffRow{}
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		rows = append(rows, &DiffRow{Op: DiffEqual, GotLine: prefix + 1, Got: a[prefix], ExpectedLine: prefix + 1, Expected: b[prefix]})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	rows = append(rows, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix)...)
+	for i := suffix; i > 0; i-- {
+		ga, gb := len(a)-i, len(b)-i
+		rows = append(rows, &DiffRow{Op: DiffEqual, GotLine: ga + 1, Got: a[ga], ExpectedLine: gb + 1, Expected: b[gb]})
+	}
+	return rows
+}
+
+// diffMiddle diffs the differing middles of two outputs, which both start
+// after offset lines.
+func diffMiddle(a, b []string, offset int) []*DiffRow {
+	rows := []*DiffRow{}
+	if len(a)*len(b) > MAX_DIFF_CELLS {
+		return pairLines(a, b, offset, offset)
+	}
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	si, sj := 0, 0 // start of the current run of differing lines
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			rows = append(rows, pairLines(a[si:i], b[sj:j], offset+si, offset+sj)...)
+			rows = append(rows, &DiffRow{Op: DiffEqual, GotLine: offset + i + 1, Got: a[i], ExpectedLine: offset + j + 1, Expected: b[j]})
+			i, j = i+1, j+1
+			si, sj = i, j
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return append(rows, pairLines(a[si:], b[sj:], offset+si, offset+sj)...)
+}
+
+// pairLines shows two runs of differing lines side by side.
+func pairLines(a, b []string, offsetA, offsetB int) []*DiffRow {
+	rows := []*DiffRow{}
+	for k := 0; k < len(a) || k < len(b); k++ {
+		row := &DiffRow{Op: DiffChanged}
+		if k < len(a) {
+			row.GotLine, row.Got = offsetA+k+1, a[k]
+		} else {
+			row.Op = DiffMissing
+		}
+		if k < len(b) {
+			row.ExpectedLine, row.Expected = offsetB+k+1, b[k]
+		} else {
+			row.Op = DiffExtra
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,99 @@
+package umpire
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func rowsString(rows []*DiffRow) string {
+	out := []string{}
+	for _, row := range rows {
+		out = append(out, fmt.Sprintf("%s %d:%s %d:%s", row.Op, row.GotLine, row.Got, row.ExpectedLine, row.Expected))
+	}
+	return strings.Join(out, "\n")
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		got, expected string
+		rows          []string
+	}{
+		{"1\n2\n", "1\n2\n", []string{"equal 1:1 1:1", "equal 2:2 2:2"}},
+		{"1\nx\n3\n", "1\n2\n3\n", []string{"equal 1:1 1:1", "changed 2:x 2:2", "equal 3:3 3:3"}},
+		{"1\n3\n", "1\n2\n3\n", []string{"equal 1:1 1:1", "missing 0: 2:2", "equal 2:3 3:3"}},
+		{"1\n2\n3\n4\n", "1\n3\n", []string{"equal 1:1 1:1", "extra 2:2 0:", "equal 3:3 2:3", "extra 4:4 0:"}},
+		{"", "a\n", []string{"missing 0: 1:a"}},
+		{"a\nb\nc", "x\nb\ny\nz\n", []string{"changed 1:a 1:x", "equal 2:b 2:b", "changed 3:c 3:y", "missing 0: 4:z"}},
+	}
+	for _, test := range tests {
+		if got, expected := rowsString(Diff(test.got, test.expected)), strings.Join(test.rows, "\n"); got != expected {
+			t.Errorf("Diff(%q, %q):\n%s\nexpected:\n%s", test.got, test.expected, got, expected)
+		}
+	}
+}
+
+func TestOutputCaptureComparesBeyondLimit(t *testing.T) {
+	a, b, c := newOutputCapture(8), newOutputCapture(8), newOutputCapture(8)
+	for _, capture := range []*outputCapture{a, b, c} {
+		fmt.Fprint(capture, "one\ntwo\nthr")
+		fmt.Fprint(capture, "ee\n")
+	}
+	fmt.Fprint(a, "four")
+	fmt.Fprint(b, "four\n")
+	fmt.Fprint(c, "five\n")
+	for _, capture := range []*outputCapture{a, b, c} {
+		capture.close()
+	}
+	if a.String() != "one\ntwo\n" || !a.truncated {
+		t.Errorf("kept %q, truncated=%v", a.String(), a.truncated)
+	}
+	if !a.sameAs(b) {
+		t.Errorf("outputs differing only in the final newline should be the same")
+	}
+	if a.sameAs(c) {
+		t.Errorf("outputs differing after the limit should differ")
+	}
+}
+
+func TestOutputCaptureNormalizesLineEndings(t *testing.T) {
+	a, b := newOutputCapture(RunOutputLimit), newOutputCapture(RunOutputLimit)
+	fmt.Fprint(a, "one\r")
+	fmt.Fprint(a, "\ntwo\r\nthree\r")
+	fmt.Fprint(b, "one\ntwo\nthree\n")
+	a.close()
+	b.close()
+	if a.String() != "one\ntwo\nthree\n" || !a.sameAs(b) {
+		t.Errorf("kept %q, same=%v", a.String(), a.sameAs(b))
+	}
+}
+
+func TestRunVerdict(t *testing.T) {
+	capture := func(s string) *outputCapture {
+		c := newOutputCapture(RunOutputLimit)
+		fmt.Fprint(c, s)
+		c.close()
+		return c
+	}
+	tests := []struct {
+		got, gotErr, expected, details string
+	}{
+		{"5\n2\n", "", "5\n2\n", ""},
+		{"5\n3\n", "", "5\n2\n", "Mismatch Error: got 3, expected 2"},
+		{"5\n", "", "5\n2\n", "Mismatch Error: got <missing>, expected 2"},
+		{"5\n2\n7\n", "", "5\n2\n", "Mismatch Error: got 7, expected <missing>"},
+		{"5\r\n2\r\n", "", "5\n2\n", ""},
+		{"5\r\n2", "", "5\n2\n", ""},
+		{"", "main.cpp:1: error\n", "5\n", "stderr error: main.cpp:1: error\n"},
+	}
+	for _, test := range tests {
+		out := &runOutputs{got: capture(test.got), gotErr: capture(test.gotErr), expected: capture(test.expected)}
+		details := ""
+		if err := out.verdict(); err != nil {
+			details = err.Error()
+		}
+		if details != test.details {
+			t.Errorf("verdict(%q, %q): got %q, expected %q", test.got, test.expected, details, test.details)
+		}
+	}
+}
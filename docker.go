@@ -14,21 +14,12 @@ import (
 	"io"
 	"net"
 	_ "os"
-	_ "strings"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
-var configMap = map[string]struct {
-	Cmd   []string
-	Image string
-}{
-	"cpp":        {[]string{"-stream=true"}, "phluent/clang"},
-	"python":     {[]string{"-stream=true"}, "phluent/python"},
-	"javascript": {[]string{"-stream=true"}, "phluent/javascript"},
-	"typescript": {[]string{"-stream=true"}, "phluent/typescript"},
-}
-
 type Problem struct {
 	Id string `json:"id"`
 }
@@ -40,9 +31,13 @@ type InMemoryFile struct {
 
 type Payload struct {
 	Language string          `json:"language"`
+	Variant  string          `json:"variant,omitempty"`
 	Files    []*InMemoryFile `json:"files"`
 	Problem  *Problem        `json:"problem"`
 	Stdin    string          `json:"stdin"`
+	// SubmissionId is recorded in the labels of the containers judging
+	// this payload.
+	SubmissionId string `json:"submission_id,omitempty"`
 }
 
 func writeConn(conn io.Writer, data []byte) error {
@@ -142,8 +137,10 @@ func DockerJudge(ctx context.Context, cli *client.Client, payload *Payload, wStd
 			fullText += text
 			log.Infof("scanning %s: %s", source, text)
 			if source == "stdout" {
-				expected.Scan()
-				text1, text2 := text, expected.Text()
+				text1, text2 := text, MISSING_LINE
+				if expected.Scan() {
+					text2 = expected.Text()
+				}
 				log.Printf("got text: %q", text1)
 				log.Printf("want text: %q", text2)
 				if text1 != text2 {
@@ -191,25 +188,43 @@ func DockerJudge(ctx context.Context, cli *client.Client, payload *Payload, wStd
 	return <-errChan
 }
 
+// JudgeTimeout bounds how long a judge container may run before it is
+// stopped.
+var JudgeTimeout = 30 * time.Second
+
 func dockerEval(ctx context.Context, cli *client.Client, payload *Payload) (*DockerEvalResult, error) {
-	cfg := configMap[payload.Language]
+	cfg, err := resolveLanguage(payload.Language, payload.Variant)
+	if err != nil {
+		return nil, err
+	}
+	env, mark := markedEnv(cfg.Env)
 	config := &container.Config{
 		Image:       cfg.Image,
-		Cmd:         cfg.Cmd,
+		Cmd:         append(cfg.Cmd, "-stream=true"),
+		Env:         env,
+		Labels:      containerLabels(payload),
 		AttachStdin: true,
 		OpenStdin:   true,
 		StdinOnce:   false,
 	}
 
-	resp, err := cli.ContainerCreate(ctx, config, &container.HostConfig{}, &network.NetworkingConfig{}, "")
+	start := time.Now()
+	resp, err := cli.ContainerCreate(ctx, config, cfg.hostConfig(), &network.NetworkingConfig{}, "")
 	if err != nil {
-		return nil, err
+		return nil, imageCreateError(cfg.Image, dockerError("create", err))
 	}
 	containerId := resp.ID
+	timer := newContainerTimer(ctx, payload.Language, start)
+	cleanup := func() error {
+		log.Info("Docker cleanup called")
+		timer.removed()
+		return dockerError("remove", cli.ContainerRemove(context.Background(), containerId, types.ContainerRemoveOptions{Force: true}))
+	}
 
 	err = cli.ContainerStart(ctx, containerId, types.ContainerStartOptions{})
 	if err != nil {
-		return nil, err
+		cleanup()
+		return nil, dockerError("start", err)
 	}
 
 	stdout, err := cli.ContainerLogs(ctx, containerId, types.ContainerLogsOptions{
@@ -217,18 +232,21 @@ func dockerEval(ctx context.Context, cli *client.Client, payload *Payload) (*Doc
 		Follow:     true,
 	})
 	if err != nil {
-		return nil, err
+		cleanup()
+		return nil, dockerError("logs", err)
 	}
 	stderr, err := cli.ContainerLogs(ctx, containerId, types.ContainerLogsOptions{
 		ShowStderr: true,
 		Follow:     true,
 	})
 	if err != nil {
-		return nil, err
+		cleanup()
+		return nil, dockerError("logs", err)
 	}
 
 	data, err := json.Marshal(payload)
 	if err != nil {
+		cleanup()
 		return nil, err
 	}
 	hijackedResp, err := cli.ContainerAttach(ctx, containerId, types.ContainerAttachOptions{
@@ -236,8 +254,10 @@ func dockerEval(ctx context.Context, cli *client.Client, payload *Payload) (*Doc
 		Stream: true,
 	})
 	if err != nil {
-		return nil, err
+		cleanup()
+		return nil, dockerError("attach", err)
 	}
+	timer.phase(PhaseSetup)
 	go func(data []byte, conn net.Conn) {
 		defer func() { log.Printf("dockerEval: Done writing") }()
 		defer conn.Close()
@@ -247,27 +267,36 @@ func dockerEval(ctx context.Context, cli *client.Client, payload *Payload) (*Doc
 		}
 	}(data, hijackedResp.Conn)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), JudgeTimeout)
 	done := make(chan struct{})
 	go func() {
 		_, err = cli.ContainerWait(ctx, containerId)
 		if err != nil {
-			log.Printf("here: %v", err)
+			log.Printf("here: %v", dockerError("wait", err))
 			done <- struct{}{}
 			return
 		}
+		timer.exit()
 		done <- struct{}{}
 	}()
 
 	rStdout, wStdout := io.Pipe()
 	rStderr, wStderr := io.Pipe()
 
-	scanLines := func(r io.Reader, w io.WriteCloser) {
+	// mark is only looked for on stderr, and only its first line counts.
+	scanLines := func(r io.Reader, w io.WriteCloser, mark string) {
 		defer w.Close()
 		scanner := bufio.NewScanner(r)
 		for scanner.Scan() {
 			text := scanner.Text()
 			text = text[8:]
+			if mark != "" && strings.HasPrefix(text, mark+" ") {
+				if seconds, err := strconv.ParseFloat(text[len(mark)+1:], 64); err == nil {
+					timer.compiled(time.Duration(seconds * float64(time.Second)))
+					mark = ""
+					continue
+				}
+			}
 			if len(text) > 0 {
 				if err := writeLine(w, text); err != nil {
 					log.Fatalf("system err: %v", err)
@@ -281,12 +310,8 @@ func dockerEval(ctx context.Context, cli *client.Client, payload *Payload) (*Doc
 		}
 	}
 
-	go scanLines(stdout, wStdout)
-	go scanLines(stderr, wStderr)
+	go scanLines(stdout, wStdout, "")
+	go scanLines(stderr, wStderr, mark)
 
-	cleanup := func() error {
-		log.Info("Docker cleanup called")
-		return cli.ContainerRemove(context.Background(), containerId, types.ContainerRemoveOptions{Force: true})
-	}
 	return &DockerEvalResult{containerId, done, rStdout, rStderr, cancel, cleanup}, nil
 }
@@ -0,0 +1,294 @@
+package umpire
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/labstack/gommon/log"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ImageStatus reports what the Docker host knows about one configured image.
+type ImageStatus struct {
+	Image     string   `json:"image"`
+	Languages []string `json:"languages"`
+	Present   bool     `json:"present"`
+	// Id is the image id, the digest of its configuration. Unlike Digest
+	// it survives `docker save` and `docker load`.
+	Id     string `json:"id,omitempty"`
+	Digest string `json:"digest,omitempty"`
+	Pinned string `json:"pinned,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type imageSpec struct {
+	Image     string
+	Digest    string
+	Languages []string
+}
+
+var pinnedImages = struct {
+	sync.RWMutex
+	refs map[string]string
+}{refs: map[string]string{}}
+
+// PinImage makes every container that would use image run ref instead,
+// usually the image referenced by digest.
+func PinImage(image, ref string) {
+	pinnedImages.Lock()
+	defer pinnedImages.Unlock()
+	pinnedImages.refs[image] = ref
+}
+
+func pinnedImage(image string) string {
+	pinnedImages.RLock()
+	defer pinnedImages.RUnlock()
+	if ref, ok := pinnedImages.refs[image]; ok {
+		return ref
+	}
+	return image
+}
+
+// ImageOf returns the image reference, pinned by digest when known, that
+// will judge the payload.
+func ImageOf(payload *Payload) string {
+	if payload == nil {
+		return ""
+	}
+	rc, err := resolveLanguage(payload.Language, payload.Variant)
+	if err != nil {
+		return ""
+	}
+	return rc.Image
+}
+
+// configuredImages lists every distinct image referenced by Languages along
+// with the languages and variants using it.
+func configuredImages() []*imageSpec {
+	specs := map[string]*imageSpec{}
+	add := func(image, digest, user string) {
+		spec, ok := specs[image]
+		if !ok {
+			spec = &imageSpec{Image: image}
+			specs[image] = spec
+		}
+		if digest != "" {
+			spec.Digest = digest
+		}
+		spec.Languages = append(spec.Languages, user)
+	}
+	for name, lc := range Languages {
+		if len(lc.Variants) == 0 {
+			add(lc.Image, lc.Digest, name)
+			continue
+		}
+		for vname, v := range lc.Variants {
+			image, digest := lc.Image, lc.Digest
+			if v.Image != "" {
+				image, digest = v.Image, v.Digest
+			}
+			add(image, digest, name+"/"+vname)
+		}
+	}
+	out := imageSpecs{}
+	for _, spec := range specs {
+		sort.Strings(spec.Languages)
+		out = append(out, spec)
+	}
+	sort.Sort(out)
+	return out
+}
+
+type imageSpecs []*imageSpec
+
+func (a imageSpecs) Len() int           { return len(a) }
+func (a imageSpecs) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a imageSpecs) Less(i, j int) bool { return a[i].Image < a[j].Image }
+
+// ImageManager checks, pulls and pins the images named in Languages.
+type ImageManager struct {
+	Client *client.Client
+	// Registry, when set, is prefixed to image names when pulling,
+	// e.g. registry.example.com:5000.
+	Registry string
+}
+
+func NewImageManager(cli *client.Client, registry string) *ImageManager {
+	return &ImageManager{Client: cli, Registry: strings.TrimSuffix(registry, "/")}
+}
+
+// repository strips the tag from an image name, keeping any registry port.
+func repository(image string) string {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i]
+	}
+	return image
+}
+
+func repoDigest(image string, inspect types.ImageInspect) string {
+	repo := repository(image)
+	for _, rd := range inspect.RepoDigests {
+		if strings.HasPrefix(rd, repo+"@") {
+			return rd
+		}
+	}
+	if len(inspect.RepoDigests) > 0 {
+		return inspect.RepoDigests[0]
+	}
+	return ""
+}
+
+func (m *ImageManager) inspect(ctx context.Context, spec *imageSpec) *ImageStatus {
+	status := &ImageStatus{Image: spec.Image, Languages: spec.Languages}
+	inspect, _, err := m.Client.ImageInspectWithRaw(ctx, spec.Image)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Present = true
+	status.Id = inspect.ID
+	status.Digest = inspect.ID
+	ref := inspect.ID
+	if rd := repoDigest(spec.Image, inspect); rd != "" {
+		status.Digest = rd[strings.Index(rd, "@")+1:]
+		ref = rd
+	}
+	if spec.Digest != "" && spec.Digest != status.Digest && spec.Digest != inspect.ID && m.importedAs(ctx, spec, inspect.ID) {
+		// `docker load` drops registry digests; Import tagged the image
+		// with the digest it had where it was exported.
+		status.Digest = spec.Digest
+	}
+	if spec.Digest != "" && spec.Digest != status.Digest && spec.Digest != inspect.ID {
+		status.Error = fmt.Sprintf("Image %s has digest %s, configuration expects %s", spec.Image, status.Digest, spec.Digest)
+		return status
+	}
+	status.Pinned = ref
+	return status
+}
+
+// digestTag is the tag Import gives an image whose registry digest was
+// digest where it was exported, e.g. phluent/clang:sha256-abc...
+func digestTag(image, digest string) string {
+	return repository(image) + ":" + strings.Replace(digest, ":", "-", 1)
+}
+
+// importedAs reports whether a bundle imported the image with id as the
+// image spec pins by digest.
+func (m *ImageManager) importedAs(ctx context.Context, spec *imageSpec, id string) bool {
+	inspect, _, err := m.Client.ImageInspectWithRaw(ctx, digestTag(spec.Image, spec.Digest))
+	return err == nil && inspect.ID == id
+}
+
+// List reports the state of every configured image without changing anything.
+func (m *ImageManager) List(ctx context.Context) []*ImageStatus {
+	statuses := []*ImageStatus{}
+	for _, spec := range configuredImages() {
+		statuses = append(statuses, m.inspect(ctx, spec))
+	}
+	return statuses
+}
+
+// Verify checks every configured image and pins the ones that are present
+// and match their configured digest. It returns an error naming the images
+// that cannot be used.
+func (m *ImageManager) Verify(ctx context.Context) ([]*ImageStatus, error) {
+	statuses := m.List(ctx)
+	return statuses, m.pin(statuses)
+}
+
+// Ensure is Verify, but when pull is set it first pulls the images that
+// are missing or do not match their pinned digest.
+func (m *ImageManager) Ensure(ctx context.Context, pull bool) ([]*ImageStatus, error) {
+	statuses := []*ImageStatus{}
+	for _, spec := range configuredImages() {
+		status := m.inspect(ctx, spec)
+		if pull && (!status.Present || status.Error != "") {
+			if err := m.Pull(ctx, spec.Image, spec.Digest); err != nil {
+				status.Error = err.Error()
+			} else {
+				status = m.inspect(ctx, spec)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, m.pin(statuses)
+}
+
+func (m *ImageManager) pin(statuses []*ImageStatus) error {
+	failed := []string{}
+	for _, status := range statuses {
+		if status.Error != "" {
+			failed = append(failed, status.Image)
+			continue
+		}
+		PinImage(status.Image, status.Pinned)
+		log.Infof("Pinned image %s to %s", status.Image, status.Pinned)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Images not usable: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// pullRef is the reference Pull fetches image by: from Registry when one
+// is configured, and by digest when one is pinned.
+func (m *ImageManager) pullRef(image, digest string) string {
+	ref := image
+	if m.Registry != "" {
+		ref = m.Registry + "/" + image
+	}
+	if digest != "" {
+		ref = repository(ref) + "@" + digest
+	}
+	return ref
+}
+
+// Pull fetches image, by digest when digest is not empty, and tags it with
+// the name the language configuration uses.
+func (m *ImageManager) Pull(ctx context.Context, image, digest string) error {
+	ref := m.pullRef(image, digest)
+	log.Infof("Pulling image %s", ref)
+	out, err := m.Client.ImagePull(ctx, ref, types.ImagePullOptions{})
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := readProgress(out); err != nil {
+		return err
+	}
+	if ref != image {
+		return m.Client.ImageTag(ctx, ref, image)
+	}
+	return nil
+}
+
+// readProgress drains a Docker progress stream and returns the first error
+// message it carries.
+func readProgress(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("%s", msg.Error)
+		}
+	}
+}
+
+func imageCreateError(image string, err error) error {
+	if client.IsErrImageNotFound(err) {
+		return fmt.Errorf("Judge image %s is not present on the docker host, run `umpire images pull`: %v", image, err)
+	}
+	return err
+}
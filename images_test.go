@@ -0,0 +1,82 @@
+package umpire
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRepository(t *testing.T) {
+	var tests = []struct {
+		image    string
+		expected string
+	}{
+		{"phluent/clang", "phluent/clang"},
+		{"phluent/python:2.7", "phluent/python"},
+		{"localhost:5000/phluent/clang", "localhost:5000/phluent/clang"},
+		{"localhost:5000/phluent/clang:latest", "localhost:5000/phluent/clang"},
+	}
+	for _, test := range tests {
+		if got := repository(test.image); got != test.expected {
+			t.Errorf("repository(%q): got %q, expected %q", test.image, got, test.expected)
+		}
+	}
+}
+
+func TestDigestTag(t *testing.T) {
+	if got := digestTag("localhost:5000/phluent/python:2.7", "sha256:abc"); got != "localhost:5000/phluent/python:sha256-abc" {
+		t.Errorf("digestTag: got %q", got)
+	}
+}
+
+func TestConfiguredImages(t *testing.T) {
+	images := map[string]*imageSpec{}
+	for _, spec := range configuredImages() {
+		images[spec.Image] = spec
+	}
+	for _, image := range []string{"phluent/clang", "phluent/python", "phluent/python:2.7", "phluent/javascript", "phluent/typescript"} {
+		if images[image] == nil {
+			t.Errorf("configuredImages: missing %s", image)
+		}
+	}
+	if n := len(images["phluent/clang"].Languages); n != 4 {
+		t.Errorf("configuredImages: phluent/clang used by %d variants, expected 4", n)
+	}
+}
+
+func TestPinnedImageResolution(t *testing.T) {
+	PinImage("phluent/clang", "phluent/clang@sha256:abc")
+	defer PinImage("phluent/clang", "phluent/clang")
+	payload := &Payload{Language: "cpp", Variant: "c++17"}
+	if got := ImageOf(payload); got != "phluent/clang@sha256:abc" {
+		t.Errorf("ImageOf: got %q, expected pinned reference", got)
+	}
+}
+
+func TestReadProgress(t *testing.T) {
+	ok := `{"status":"Pulling"}` + "\n" + `{"status":"Done"}`
+	if err := readProgress(strings.NewReader(ok)); err != nil {
+		t.Errorf("readProgress: %v", err)
+	}
+	failed := `{"status":"Pulling"}` + "\n" + `{"error":"manifest unknown"}`
+	if err := readProgress(strings.NewReader(failed)); err == nil || err.Error() != "manifest unknown" {
+		t.Errorf("readProgress: got %v, expected manifest unknown", err)
+	}
+}
+
+func TestPullRef(t *testing.T) {
+	var tests = []struct {
+		registry, image, digest string
+		expected                string
+	}{
+		{"", "phluent/python:2.7", "", "phluent/python:2.7"},
+		{"", "phluent/python:2.7", "sha256:abc", "phluent/python@sha256:abc"},
+		{"localhost:5000", "phluent/clang", "", "localhost:5000/phluent/clang"},
+		{"localhost:5000", "phluent/clang:latest", "sha256:abc", "localhost:5000/phluent/clang@sha256:abc"},
+	}
+	for _, test := range tests {
+		m := NewImageManager(nil, test.registry)
+		if got := m.pullRef(test.image, test.digest); got != test.expected {
+			t.Errorf("pullRef(%q, %q) with registry %q: got %q, expected %q", test.image, test.digest, test.registry, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package umpire
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"os"
+)
+
+// Variant describes one version or build flavour of a language, e.g. C++17
+// with optimizations or Python 2.7. Cmd replaces the language's arguments to
+// the judge image's entrypoint; umpire-runner, the entrypoint of the images
+// in images/, takes compiler flags as -cxxflags. Env is handed to the judge
+// container as is. Digest, when set, pins Image to that content digest
+// (sha256:...). Sandbox overrides the language's runtime and security
+// options.
+type Variant struct {
+	Image   string   `json:"image,omitempty"`
+	Digest  string   `json:"digest,omitempty"`
+	Cmd     []string `json:"cmd,omitempty"`
+	Env     []string `json:"env,omitempty"`
+	Sandbox *Sandbox `json:"sandbox,omitempty"`
+}
+
+type LanguageConfig struct {
+	Image          string              `json:"image"`
+	Digest         string              `json:"digest,omitempty"`
+	Cmd            []string            `json:"cmd"`
+	DefaultVariant string              `json:"default_variant"`
+	Variants       map[string]*Variant `json:"variants"`
+	Sandbox        *Sandbox            `json:"sandbox,omitempty"`
+}
+
+var Languages = map[string]*LanguageConfig{
+	"cpp": &LanguageConfig{
+		Image:          "phluent/clang",
+		DefaultVariant: "c++11",
+		Variants: map[string]*Variant{
+			"c++11": &Variant{Cmd: []string{"-cxxflags=-std=c++11 -O2"}},
+			"c++17": &Variant{Cmd: []string{"-cxxflags=-std=c++17 -O2"}},
+			"c++20": &Variant{Cmd: []string{"-cxxflags=-std=c++20 -O2"}},
+			"debug": &Variant{Cmd: []string{"-cxxflags=-std=c++17 -g -O0 -fsanitize=address,undefined"}},
+		},
+	},
+	"python": &LanguageConfig{
+		Image:          "phluent/python",
+		DefaultVariant: "3",
+		Variants: map[string]*Variant{
+			"3":   &Variant{},
+			"2.7": &Variant{Image: "phluent/python:2.7"},
+		},
+	},
+	"javascript": &LanguageConfig{Image: "phluent/javascript"},
+	"typescript": &LanguageConfig{Image: "phluent/typescript"},
+}
+
+// LoadLanguages replaces the language table with the one in the given JSON
+// file. The file maps language names to LanguageConfig entries.
+func LoadLanguages(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	languages := map[string]*LanguageConfig{}
+	if err := json.NewDecoder(f).Decode(&languages); err != nil {
+		return err
+	}
+	for name, lc := range languages {
+		if lc == nil || lc.Image == "" {
+			return fmt.Errorf("Language '%s' has no image configured", name)
+		}
+		if err := lc.Sandbox.load(); err != nil {
+			return err
+		}
+		for _, v := range lc.Variants {
+			if err := v.Sandbox.load(); err != nil {
+				return err
+			}
+		}
+	}
+	Languages = languages
+	return nil
+}
+
+type runConfig struct {
+	Variant string
+	Image   string
+	Cmd     []string
+	Env     []string
+	Sandbox *Sandbox
+}
+
+// resolveLanguage looks up the image, runner arguments and environment for
+// a payload. An empty variant selects the language's default one.
+func resolveLanguage(language, variant string) (*runConfig, error) {
+	lc, ok := Languages[language]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported language '%s'", language)
+	}
+	rc := &runConfig{Image: lc.Image, Cmd: append([]string{}, lc.Cmd...), Sandbox: DefaultSandbox}
+	if lc.Sandbox != nil {
+		rc.Sandbox = lc.Sandbox
+	}
+	digest := lc.Digest
+	if variant == "" {
+		variant = lc.DefaultVariant
+	}
+	if variant != "" {
+		v, ok := lc.Variants[variant]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported variant '%s' for language '%s'", variant, language)
+		}
+		rc.Variant = variant
+		if v.Image != "" {
+			rc.Image, digest = v.Image, v.Digest
+		}
+		if v.Cmd != nil {
+			rc.Cmd = append([]string{}, v.Cmd...)
+		}
+		rc.Env = v.Env
+		if v.Sandbox != nil {
+			rc.Sandbox = v.Sandbox
+		}
+	}
+	if pinned := pinnedImage(rc.Image); pinned != rc.Image {
+		rc.Image = pinned
+	} else if digest != "" {
+		rc.Image = repository(rc.Image) + "@" + digest
+	}
+	return rc, nil
+}
+
+func (rc *runConfig) hostConfig() *container.HostConfig {
+	hc := &container.HostConfig{}
+	if rc.Sandbox != nil {
+		hc.Runtime = rc.Sandbox.Runtime
+		hc.SecurityOpt = rc.Sandbox.SecurityOpt
+	}
+	return hc
+}
+
+// VariantOf returns the variant that will judge the payload, filling in the
+// language default when the payload leaves it empty.
+func VariantOf(payload *Payload) string {
+	if payload == nil {
+		return ""
+	}
+	rc, err := resolveLanguage(payload.Language, payload.Variant)
+	if err != nil {
+		return payload.Variant
+	}
+	return rc.Variant
+}
@@ -0,0 +1,53 @@
+package umpire
+
+import (
+	"testing"
+)
+
+func TestResolveLanguage(t *testing.T) {
+	var tests = []struct {
+		language string
+		variant  string
+		image    string
+		resolved string
+	}{
+		{"cpp", "", "phluent/clang", "c++11"},
+		{"cpp", "c++17", "phluent/clang", "c++17"},
+		{"python", "2.7", "phluent/python:2.7", "2.7"},
+		{"javascript", "", "phluent/javascript", ""},
+	}
+	for _, test := range tests {
+		rc, err := resolveLanguage(test.language, test.variant)
+		if err != nil {
+			t.Errorf("resolveLanguage(%q, %q): %v", test.language, test.variant, err)
+			continue
+		}
+		if rc.Image != test.image {
+			t.Errorf("resolveLanguage(%q, %q): got image %q, expected %q", test.language, test.variant, rc.Image, test.image)
+		}
+		if rc.Variant != test.resolved {
+			t.Errorf("resolveLanguage(%q, %q): got variant %q, expected %q", test.language, test.variant, rc.Variant, test.resolved)
+		}
+	}
+}
+
+func TestCppVariantsPassCompilerFlags(t *testing.T) {
+	for variant, flags := range map[string]string{"": "-std=c++11 -O2", "c++17": "-std=c++17 -O2", "debug": "-std=c++17 -g -O0 -fsanitize=address,undefined"} {
+		rc, err := resolveLanguage("cpp", variant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rc.Cmd) != 1 || rc.Cmd[0] != "-cxxflags="+flags {
+			t.Errorf("variant %q: got cmd %q, expected -cxxflags=%s", variant, rc.Cmd, flags)
+		}
+	}
+}
+
+func TestResolveLanguageUnknown(t *testing.T) {
+	if _, err := resolveLanguage("cobol", ""); err == nil {
+		t.Errorf("expected error for unknown language")
+	}
+	if _, err := resolveLanguage("cpp", "c++98"); err == nil {
+		t.Errorf("expected error for unknown variant")
+	}
+}
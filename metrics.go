@@ -0,0 +1,195 @@
+package umpire
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+// Container phases. Setup covers creating, starting and attaching to the
+// judge container; compile the time the image reports compiling took, and
+// run everything else until the container exits. Images that do not report
+// compiling have it counted in run.
+const (
+	PhaseSetup   = "setup"
+	PhaseCompile = "compile"
+	PhaseRun     = "run"
+)
+
+// COMPILED_MARK_ENV names the variable holding a random mark given to every
+// judge container. umpire-runner reports how long compiling took with it:
+// with -stream=true as a line "<mark> <seconds>" on stderr, which umpire
+// swallows, otherwise as compile_seconds in its result.
+const COMPILED_MARK_ENV = "UMPIRE_COMPILED_MARK"
+
+// markedEnv returns env with a new COMPILED_MARK_ENV, and the mark.
+func markedEnv(env []string) ([]string, string) {
+	mark := RandStringRunes(16)
+	return append(append([]string{}, env...), COMPILED_MARK_ENV+"="+mark), mark
+}
+
+var durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+var (
+	requestSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "umpire",
+		Name:      "request_duration_seconds",
+		Help:      "Time to judge, run, execute or validate a payload.",
+		Buckets:   durationBuckets,
+	}, []string{"endpoint", "language"})
+	containerSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "umpire",
+		Name:      "container_phase_duration_seconds",
+		Help:      "Time spent in each phase of a judge container.",
+		Buckets:   durationBuckets,
+	}, []string{"language", "phase"})
+	verdicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "umpire",
+		Name:      "verdicts_total",
+		Help:      "Results by endpoint, language and verdict.",
+	}, []string{"endpoint", "language", "verdict"})
+	dockerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "umpire",
+		Name:      "docker_errors_total",
+		Help:      "Failed Docker API calls by operation.",
+	}, []string{"operation"})
+	activeContainers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "umpire",
+		Name:      "active_containers",
+		Help:      "Judge containers created by this process and not yet removed.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(requestSeconds, containerSeconds, verdicts, dockerErrors, activeContainers)
+}
+
+// dockerError counts a failed Docker API call and returns err unchanged.
+func dockerError(operation string, err error) error {
+	if err != nil {
+		dockerErrors.WithLabelValues(operation).Inc()
+	}
+	return err
+}
+
+// UNKNOWN_LANGUAGE labels requests whose language is not configured, so
+// callers cannot create a time series per made-up language.
+const UNKNOWN_LANGUAGE = "unknown"
+
+// observe records the outcome of one request made through the library.
+func observe(endpoint string, payload *Payload, resp *Response, start time.Time) {
+	language := UNKNOWN_LANGUAGE
+	if payload != nil {
+		if _, ok := Languages[payload.Language]; ok {
+			language = payload.Language
+		}
+	}
+	requestSeconds.WithLabelValues(endpoint, language).Observe(time.Since(start).Seconds())
+	verdicts.WithLabelValues(endpoint, language, string(resp.Status)).Inc()
+}
+
+// ContainerUsage adds up how long the judge containers started with a
+// context carrying it existed, from creation until removal. Containers of
+// one request may run in parallel, so this can exceed the request's own
+// duration.
+type ContainerUsage struct {
+	mu    sync.Mutex
+	total time.Duration
+}
+
+type containerUsageKey struct{}
+
+// WithContainerUsage returns a context whose judge containers add their
+// time to usage.
+func WithContainerUsage(ctx context.Context, usage *ContainerUsage) context.Context {
+	return context.WithValue(ctx, containerUsageKey{}, usage)
+}
+
+// Total is the container time added so far.
+func (u *ContainerUsage) Total() time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.total
+}
+
+func (u *ContainerUsage) add(d time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.total += d
+}
+
+// containerTimer times the phases of one judge container and keeps the
+// active container count.
+type containerTimer struct {
+	language string
+	created  time.Time
+	start    time.Time
+	usage    *ContainerUsage
+	once     sync.Once
+
+	// compile and ran are reported as they come, possibly in the other
+	// order; removed observes them.
+	mu      sync.Mutex
+	compile time.Duration
+	ran     time.Duration
+	exited  bool
+}
+
+// newContainerTimer is called once the container exists; start is when its
+// creation began.
+func newContainerTimer(ctx context.Context, language string, start time.Time) *containerTimer {
+	activeContainers.Inc()
+	usage, _ := ctx.Value(containerUsageKey{}).(*ContainerUsage)
+	return &containerTimer{language: language, created: start, start: start, usage: usage}
+}
+
+// phase records the time since the previous phase ended.
+func (t *containerTimer) phase(name string) {
+	now := time.Now()
+	containerSeconds.WithLabelValues(t.language, name).Observe(now.Sub(t.start).Seconds())
+	t.start = now
+}
+
+// compiled records how long the image said compiling took.
+func (t *containerTimer) compiled(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.compile = d
+}
+
+// exit records that the container exited, ending the run phase.
+func (t *containerTimer) exit() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ran = time.Since(t.start)
+	t.exited = true
+}
+
+// observeRun observes the run phase of a container that exited, split in
+// compile and run when the image reported compiling.
+func (t *containerTimer) observeRun() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.exited {
+		return
+	}
+	ran := t.ran
+	if t.compile > 0 && t.compile <= ran {
+		containerSeconds.WithLabelValues(t.language, PhaseCompile).Observe(t.compile.Seconds())
+		ran -= t.compile
+	}
+	containerSeconds.WithLabelValues(t.language, PhaseRun).Observe(ran.Seconds())
+}
+
+// removed marks the container gone and observes its run phase; later calls
+// do nothing.
+func (t *containerTimer) removed() {
+	t.once.Do(func() {
+		t.observeRun()
+		activeContainers.Dec()
+		if t.usage != nil {
+			t.usage.add(time.Since(t.created))
+		}
+	})
+}
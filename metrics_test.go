@@ -0,0 +1,82 @@
+package umpire
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"testing"
+	"time"
+)
+
+func TestContainerUsageAddsParallelContainers(t *testing.T) {
+	usage := &ContainerUsage{}
+	ctx := WithContainerUsage(context.Background(), usage)
+	start := time.Now().Add(-2 * time.Second)
+	a, b := newContainerTimer(ctx, "go", start), newContainerTimer(ctx, "go", start)
+	a.removed()
+	b.removed()
+	a.removed()
+	if total := usage.Total(); total < 4*time.Second || total > 5*time.Second {
+		t.Errorf("expected about 4s of container time, got %v", total)
+	}
+	newContainerTimer(context.Background(), "go", start).removed()
+}
+
+func TestObserveLabelsUnknownLanguages(t *testing.T) {
+	before := testutil.ToFloat64(verdicts.WithLabelValues("execute", UNKNOWN_LANGUAGE, string(Fail)))
+	observe("execute", &Payload{Language: "made-up-language"}, &Response{Status: Fail}, time.Now())
+	if after := testutil.ToFloat64(verdicts.WithLabelValues("execute", UNKNOWN_LANGUAGE, string(Fail))); after != before+1 {
+		t.Errorf("expected the verdict to be counted as %s, got %v -> %v", UNKNOWN_LANGUAGE, before, after)
+	}
+}
+
+func TestRejudgesAreObservedApart(t *testing.T) {
+	judged := testutil.ToFloat64(verdicts.WithLabelValues("judge", UNKNOWN_LANGUAGE, string(Fail)))
+	rejudged := testutil.ToFloat64(verdicts.WithLabelValues("rejudge", UNKNOWN_LANGUAGE, string(Fail)))
+	RejudgeContext(context.Background(), &Agent{}, &Payload{Language: "made-up-language"})
+	if after := testutil.ToFloat64(verdicts.WithLabelValues("rejudge", UNKNOWN_LANGUAGE, string(Fail))); after != rejudged+1 {
+		t.Errorf("expected the rejudge to be counted, got %v -> %v", rejudged, after)
+	}
+	if after := testutil.ToFloat64(verdicts.WithLabelValues("judge", UNKNOWN_LANGUAGE, string(Fail))); after != judged {
+		t.Errorf("the rejudge was counted as a judgement")
+	}
+}
+
+// phaseSeconds returns how many times a container phase was observed and
+// their sum.
+func phaseSeconds(t *testing.T, language, phase string) (uint64, float64) {
+	m := &dto.Metric{}
+	if err := containerSeconds.WithLabelValues(language, phase).(prometheus.Histogram).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestContainerTimerSplitsCompileFromRun(t *testing.T) {
+	timer := newContainerTimer(context.Background(), "split", time.Now().Add(-3*time.Second))
+	timer.compiled(2 * time.Second)
+	timer.exit()
+	timer.removed()
+	if n, sum := phaseSeconds(t, "split", PhaseCompile); n != 1 || sum != 2 {
+		t.Errorf("compile observed %d times for %vs, expected once for 2s", n, sum)
+	}
+	if n, sum := phaseSeconds(t, "split", PhaseRun); n != 1 || sum < 1 || sum > 1.5 {
+		t.Errorf("run observed %d times for %vs, expected once for about 1s", n, sum)
+	}
+
+	// Without a report, or with one longer than the container ran,
+	// everything is run.
+	for _, compile := range []time.Duration{0, time.Minute} {
+		timer := newContainerTimer(context.Background(), "unsplit", time.Now().Add(-time.Second))
+		timer.compiled(compile)
+		timer.exit()
+		timer.removed()
+	}
+	if n, _ := phaseSeconds(t, "unsplit", PhaseCompile); n != 0 {
+		t.Errorf("compile observed %d times, expected none", n)
+	}
+	if n, sum := phaseSeconds(t, "unsplit", PhaseRun); n != 2 || sum < 2 || sum > 3 {
+		t.Errorf("run observed %d times for %vs, expected twice for about 2s", n, sum)
+	}
+}
@@ -120,7 +120,7 @@ func TestRelocateEnvFile(t *testing.T) {
 	t.Logf("%v", envmap)
 	cli, err := NewEnvMapClient(envmap)
 	dir.Add(cli, err, RemoteEnv, "myremotedocker")
-	t.Logf(ListMachines())
+	t.Log(ListMachines())
 }
 
 func TestReadEnvFile(t *testing.T) {
@@ -382,6 +382,16 @@ func GetMachine() *client.Client {
 	return nil
 }
 
+// Machine returns the entry holding cli, e.g. the one GetMachine picked.
+func Machine(cli *client.Client) *Entry {
+	for i := range dir.Entries {
+		if dir.Entries[i].Client == cli {
+			return &dir.Entries[i]
+		}
+	}
+	return nil
+}
+
 func NewClientWithOpts(options []string) *client.Client {
 	if err := InitMachines(options); err != nil {
 		io.Copy(os.Stderr, strings.NewReader(err.Error()))
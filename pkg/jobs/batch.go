@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"github.com/maddyonline/umpire"
+	"time"
+)
+
+// Batch is a group of jobs submitted together. Jobs lists their ids in
+// submission order.
+type Batch struct {
+	Id      string    `json:"id"`
+	Uid     string    `json:"uid"`
+	Jobs    []string  `json:"jobs"`
+	Created time.Time `json:"created"`
+}
+
+// SubmitBatch stores a job for every payload and queues them all, or none
+// when the queue has no room for the whole batch. Batch jobs run in the
+// background, like rejudges. As with Submit, every payload's submission id
+// is replaced by its job's id.
+func (q *Queue) SubmitBatch(uid string, payloads []*umpire.Payload) (*Batch, error) {
+	return q.submitBatch(uid, payloads, false)
+}
+
+// SubmitRejudge is SubmitBatch for judging stored submissions again.
+// Every payload must carry the id of the submission it judges again; its
+// job records it in Rejudges.
+func (q *Queue) SubmitRejudge(uid string, payloads []*umpire.Payload) (*Batch, error) {
+	return q.submitBatch(uid, payloads, true)
+}
+
+func (q *Queue) submitBatch(uid string, payloads []*umpire.Payload, rejudge bool) (*Batch, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+	// Batches wait in the background so they never crowd out single
+	// judgements. Jobs are only queued while holding q.mu, so the room
+	// checked here is still there when the jobs are queued below.
+	if cap(q.background)-len(q.background) < len(payloads) {
+		return nil, ErrQueueFull
+	}
+	now := time.Now().UTC()
+	batch := &Batch{Id: umpire.RandStringRunes(16), Uid: uid, Jobs: []string{}, Created: now}
+	jobs := []*Job{}
+	for _, payload := range payloads {
+		job := &Job{
+			Uid:     uid,
+			State:   Queued,
+			Payload: payload,
+			Batch:   batch.Id,
+			Created: now,
+		}
+		if rejudge {
+			job.Rejudges = payload.SubmissionId
+		}
+		payload.SubmissionId = umpire.RandStringRunes(16)
+		job.Id = payload.SubmissionId
+		jobs = append(jobs, job)
+		batch.Jobs = append(batch.Jobs, job.Id)
+	}
+	if err := q.store.PutJobs(batch, jobs); err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		q.background <- job.Id
+	}
+	return batch, nil
+}
+
+func (q *Queue) Batch(id string) (*Batch, error) {
+	return q.store.GetBatch(id)
+}
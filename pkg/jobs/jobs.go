@@ -0,0 +1,306 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/umpire"
+	"sort"
+	"sync"
+	"time"
+)
+
+type State string
+
+const (
+	Queued    State = "queued"
+	Running   State = "running"
+	Done      State = "done"
+	Cancelled State = "cancelled"
+)
+
+const QUEUE_SIZE = 1024
+
+var ErrQueueFull = fmt.Errorf("Judge queue is full")
+var ErrQueueClosed = fmt.Errorf("Judge queue is shutting down")
+
+// Callback is where the result of a job is POSTed once it is done. The
+// delivery is signed with Secret when one is given.
+type Callback struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// Job is one judgement submitted through the queue. Its Id doubles as the
+// payload's submission id.
+type Job struct {
+	Id       string           `json:"id"`
+	Uid      string           `json:"uid"`
+	State    State            `json:"state"`
+	Payload  *umpire.Payload  `json:"payload"`
+	Result   *umpire.Response `json:"result,omitempty"`
+	Callback *Callback        `json:"callback,omitempty"`
+	// Batch is the id of the batch the job was submitted in, if any.
+	// Batch jobs run in the background: workers take them only when no
+	// single job is waiting.
+	Batch string `json:"batch,omitempty"`
+	// Rejudges is the id of the submission the job judges again, if any.
+	Rejudges string    `json:"rejudges,omitempty"`
+	Created  time.Time `json:"created"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// Ended reports whether the job reached a final state.
+func (j *Job) Ended() bool {
+	return j.State == Done || j.State == Cancelled
+}
+
+// Runner judges a job. It must stop and return promptly when ctx is done.
+type Runner func(ctx context.Context, job *Job) *umpire.Response
+
+// Queue runs jobs on a fixed number of workers and records every state
+// change in a Store. Jobs that were queued or running when the process
+// stopped are queued again by NewQueue.
+type Queue struct {
+	store      Store
+	run        Runner
+	pending    chan string
+	background chan string
+
+	mu        sync.Mutex
+	running   map[string]context.CancelFunc
+	cancelled map[string]bool
+	closed    bool
+
+	quit    chan struct{}
+	ctx     context.Context
+	abort   context.CancelFunc
+	workers sync.WaitGroup
+}
+
+func NewQueue(store Store, run Runner, workers int) (*Queue, error) {
+	all, err := store.Unfinished()
+	if err != nil {
+		return nil, err
+	}
+	unfinished := byCreated(all)
+	background := 0
+	for _, job := range unfinished {
+		if inBackground(job) {
+			background++
+		}
+	}
+	sort.Sort(unfinished)
+	ctx, abort := context.WithCancel(context.Background())
+	q := &Queue{
+		store:      store,
+		run:        run,
+		pending:    make(chan string, QUEUE_SIZE+len(unfinished)-background),
+		background: make(chan string, QUEUE_SIZE+background),
+		running:    map[string]context.CancelFunc{},
+		cancelled:  map[string]bool{},
+		quit:       make(chan struct{}),
+		ctx:        ctx,
+		abort:      abort,
+	}
+	for _, job := range unfinished {
+		log.Infof("Resuming job %s (was %s)", job.Id, job.State)
+		job.State = Queued
+		if err := store.Put(job); err != nil {
+			return nil, err
+		}
+		q.lane(job) <- job.Id
+	}
+	for i := 0; i < workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+	return q, nil
+}
+
+type byCreated []*Job
+
+func (a byCreated) Len() int           { return len(a) }
+func (a byCreated) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byCreated) Less(i, j int) bool { return a[i].Created.Before(a[j].Created) }
+
+// Submit stores a new job for payload and queues it. The payload's
+// submission id is replaced by the new job's id. callback may be nil.
+func (q *Queue) Submit(uid string, payload *umpire.Payload, callback *Callback) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+	// As in submitBatch, holding q.mu keeps this room until the job is
+	// queued, so a full queue stores nothing.
+	if len(q.pending) == cap(q.pending) {
+		return nil, ErrQueueFull
+	}
+	payload.SubmissionId = umpire.RandStringRunes(16)
+	job := &Job{
+		Id:       payload.SubmissionId,
+		Uid:      uid,
+		State:    Queued,
+		Payload:  payload,
+		Callback: callback,
+		Created:  time.Now().UTC(),
+	}
+	if err := q.store.Put(job); err != nil {
+		return nil, err
+	}
+	q.pending <- job.Id
+	return job, nil
+}
+
+// lane is the channel job waits in for a worker.
+func (q *Queue) lane(job *Job) chan string {
+	if inBackground(job) {
+		return q.background
+	}
+	return q.pending
+}
+
+// inBackground reports whether job waits behind single jobs: batch jobs,
+// rejudges among them, do.
+func inBackground(job *Job) bool {
+	return job.Batch != "" || job.Rejudges != ""
+}
+
+// Pending returns the number of single jobs waiting for a worker, cancelled
+// ones included until a worker skips them. Batch jobs are not counted.
+func (q *Queue) Pending() int {
+	return len(q.pending)
+}
+
+// Background returns the number of batch jobs, rejudges included, waiting
+// for a worker.
+func (q *Queue) Background() int {
+	return len(q.background)
+}
+
+// Prune deletes the jobs that ended more than retention ago, results
+// included, and the batches all of whose jobs did.
+func (q *Queue) Prune(retention time.Duration) (int, error) {
+	return q.store.Prune(time.Now().UTC().Add(-retention))
+}
+
+func (q *Queue) Get(id string) (*Job, error) {
+	return q.store.Get(id)
+}
+
+// Cancel stops a queued or running job. Cancelling a finished job is a no-op.
+func (q *Queue) Cancel(id string) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, err := q.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Ended() {
+		return job, nil
+	}
+	if cancel, ok := q.running[id]; ok {
+		q.cancelled[id] = true
+		cancel()
+		return job, nil
+	}
+	job.State = Cancelled
+	job.Finished = time.Now().UTC()
+	return job, q.store.Put(job)
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+	for {
+		select {
+		case <-q.quit:
+			return
+		case id := <-q.pending:
+			q.runJob(id)
+			continue
+		default:
+		}
+		select {
+		case <-q.quit:
+			return
+		case id := <-q.pending:
+			q.runJob(id)
+		case id := <-q.background:
+			q.runJob(id)
+		}
+	}
+}
+
+func (q *Queue) runJob(id string) {
+	q.mu.Lock()
+	job, err := q.store.Get(id)
+	if q.closed || err != nil || job.State != Queued {
+		q.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(q.ctx)
+	defer cancel()
+	q.running[id] = cancel
+	job.State = Running
+	job.Started = time.Now().UTC()
+	if err := q.store.Put(job); err != nil {
+		log.Warnf("Failed to store job %s: %v", id, err)
+	}
+	q.mu.Unlock()
+
+	result := q.run(ctx, job)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.running, id)
+	switch {
+	case q.cancelled[id]:
+		delete(q.cancelled, id)
+		job.State = Cancelled
+	case q.ctx.Err() != nil:
+		// Interrupted by shutdown: leave it queued so it runs after restart.
+		job.State = Queued
+		job.Started = time.Time{}
+		if err := q.store.Put(job); err != nil {
+			log.Warnf("Failed to store job %s: %v", id, err)
+		}
+		return
+	default:
+		job.State = Done
+		job.Result = result
+	}
+	job.Finished = time.Now().UTC()
+	if err := q.store.Put(job); err != nil {
+		log.Warnf("Failed to store job %s: %v", id, err)
+	}
+}
+
+// Shutdown stops accepting jobs and waits for running ones until ctx is
+// done. Jobs still running then are interrupted and stay queued in the
+// store, as do jobs that never started.
+func (q *Queue) Shutdown(ctx context.Context) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.quit)
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warnf("Interrupting running jobs, they will resume after restart")
+		q.abort()
+		<-done
+	}
+	q.abort()
+}
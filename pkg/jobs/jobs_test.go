@@ -0,0 +1,390 @@
+package jobs
+
+import (
+	"context"
+	"github.com/maddyonline/umpire"
+	bolt "go.etcd.io/bbolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func waitForState(t *testing.T, q *Queue, id string, state State) *Job {
+	for i := 0; i < 200; i++ {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.State == state {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s never reached state %s", id, state)
+	return nil
+}
+
+func passRunner(ctx context.Context, job *Job) *umpire.Response {
+	return &umpire.Response{Status: umpire.Pass}
+}
+
+func blockingRunner(ctx context.Context, job *Job) *umpire.Response {
+	<-ctx.Done()
+	return &umpire.Response{Status: umpire.Fail, Details: "Context cancelled"}
+}
+
+func TestQueueRunsJob(t *testing.T) {
+	q, err := NewQueue(NewMemoryStore(), passRunner, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Shutdown(context.Background())
+	job, err := q.Submit("anon", &umpire.Payload{Language: "cpp"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Payload.SubmissionId != job.Id {
+		t.Errorf("submission id %q does not match job id %q", job.Payload.SubmissionId, job.Id)
+	}
+	done := waitForState(t, q, job.Id, Done)
+	if done.Result == nil || done.Result.Status != umpire.Pass {
+		t.Errorf("unexpected result: %#v", done.Result)
+	}
+}
+
+func TestQueueCancelRunningJob(t *testing.T) {
+	q, err := NewQueue(NewMemoryStore(), blockingRunner, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Shutdown(context.Background())
+	job, err := q.Submit("anon", &umpire.Payload{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, q, job.Id, Running)
+	if _, err := q.Cancel(job.Id); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, q, job.Id, Cancelled)
+	if _, err := q.Cancel("missing"); err != ErrNotFound {
+		t.Errorf("Cancel: got %v, expected ErrNotFound", err)
+	}
+}
+
+func TestQueueResumesAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewBoltStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(store, blockingRunner, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	running, _ := q.Submit("anon", &umpire.Payload{}, nil)
+	waiting, _ := q.Submit("anon", &umpire.Payload{}, nil)
+	waitForState(t, q, running.Id, Running)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	q.Shutdown(ctx)
+	store.Close()
+
+	store, err = NewBoltStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	q, err = NewQueue(store, passRunner, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Shutdown(context.Background())
+	waitForState(t, q, running.Id, Done)
+	waitForState(t, q, waiting.Id, Done)
+}
+
+func TestSubmitBatch(t *testing.T) {
+	q, err := NewQueue(NewMemoryStore(), passRunner, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Shutdown(context.Background())
+	batch, err := q.SubmitBatch("anon", []*umpire.Payload{{}, {}, {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Jobs) != 3 {
+		t.Fatalf("expected 3 jobs, got %d", len(batch.Jobs))
+	}
+	for _, id := range batch.Jobs {
+		if job := waitForState(t, q, id, Done); job.Batch != batch.Id {
+			t.Errorf("job %s: batch %q, expected %q", id, job.Batch, batch.Id)
+		}
+	}
+	if stored, err := q.Batch(batch.Id); err != nil || len(stored.Jobs) != 3 {
+		t.Errorf("Batch: got %+v, %v", stored, err)
+	}
+	if _, err := q.Batch("missing"); err != ErrBatchNotFound {
+		t.Errorf("Batch: got %v, expected ErrBatchNotFound", err)
+	}
+}
+
+func TestSubmitBatchIsAllOrNothing(t *testing.T) {
+	q, err := NewQueue(NewMemoryStore(), blockingRunner, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Shutdown(context.Background())
+	payloads := make([]*umpire.Payload, QUEUE_SIZE)
+	for i := range payloads {
+		payloads[i] = &umpire.Payload{}
+	}
+	if _, err := q.SubmitBatch("anon", payloads[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.SubmitBatch("anon", payloads); err != ErrQueueFull {
+		t.Fatalf("SubmitBatch: got %v, expected ErrQueueFull", err)
+	}
+	if n := q.Background(); n != 1 {
+		t.Errorf("expected 1 batch job waiting, got %d", n)
+	}
+}
+
+func TestSubmitToFullQueueStoresNothing(t *testing.T) {
+	store := NewMemoryStore()
+	q, err := NewQueue(store, blockingRunner, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Shutdown(context.Background())
+	for i := 0; i < QUEUE_SIZE; i++ {
+		if _, err := q.Submit("anon", &umpire.Payload{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := q.Submit("anon", &umpire.Payload{}, nil); err != ErrQueueFull {
+		t.Fatalf("Submit: got %v, expected ErrQueueFull", err)
+	}
+	if all, _ := store.List(); len(all) != QUEUE_SIZE {
+		t.Errorf("expected %d stored jobs, got %d", QUEUE_SIZE, len(all))
+	}
+}
+
+func TestBatchesLeaveRoomForSingleJobs(t *testing.T) {
+	store := NewMemoryStore()
+	q, err := NewQueue(store, blockingRunner, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Shutdown(context.Background())
+	payloads := make([]*umpire.Payload, QUEUE_SIZE)
+	for i := range payloads {
+		payloads[i] = &umpire.Payload{}
+	}
+	batch, err := q.SubmitBatch("anon", payloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Submit("anon", &umpire.Payload{}, nil); err != nil {
+		t.Fatalf("Submit after a full batch: %v", err)
+	}
+	if n, m := q.Pending(), q.Background(); n != 1 || m != QUEUE_SIZE {
+		t.Errorf("expected 1 single and %d batch jobs waiting, got %d and %d", QUEUE_SIZE, n, m)
+	}
+	all, err := store.List()
+	if err != nil || len(all) != QUEUE_SIZE+1 {
+		t.Fatalf("expected %d stored jobs, got %d, %v", QUEUE_SIZE+1, len(all), err)
+	}
+	if stored, err := store.GetBatch(batch.Id); err != nil || len(stored.Jobs) != QUEUE_SIZE {
+		t.Errorf("GetBatch: got %+v, %v", stored, err)
+	}
+}
+
+func TestBoltStorePutJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewBoltStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	batch := &Batch{Id: "b", Jobs: []string{"j1", "j2"}}
+	err = store.PutJobs(batch, []*Job{{Id: "j1", Batch: "b"}, {Id: "j2", Batch: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := store.GetBatch("b"); err != nil || len(stored.Jobs) != 2 {
+		t.Errorf("GetBatch: got %+v, %v", stored, err)
+	}
+	for _, id := range batch.Jobs {
+		if job, err := store.Get(id); err != nil || job.Batch != "b" {
+			t.Errorf("Get(%s): got %+v, %v", id, job, err)
+		}
+	}
+}
+
+func TestRejudgesRunInTheBackground(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now().UTC()
+	store.Put(&Job{Id: "rejudge", Rejudges: "old", State: Queued, Payload: &umpire.Payload{}, Created: now})
+	store.Put(&Job{Id: "judge", State: Queued, Payload: &umpire.Payload{}, Created: now.Add(time.Second)})
+	var mu sync.Mutex
+	order := []string{}
+	q, err := NewQueue(store, func(ctx context.Context, job *Job) *umpire.Response {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, job.Id)
+		return &umpire.Response{Status: umpire.Pass}
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Shutdown(context.Background())
+	waitForState(t, q, "rejudge", Done)
+	waitForState(t, q, "judge", Done)
+	mu.Lock()
+	if len(order) != 2 || order[0] != "judge" {
+		t.Errorf("expected the rejudge to run last, ran %v", order)
+	}
+	mu.Unlock()
+
+	batch, err := q.SubmitRejudge("setter", []*umpire.Payload{{SubmissionId: "first"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := waitForState(t, q, batch.Jobs[0], Done)
+	if job.Rejudges != "first" || job.Id == "first" || job.Payload.SubmissionId != job.Id {
+		t.Errorf("unexpected rejudge job %+v", job)
+	}
+}
+
+func TestCancelQueuedJobForgetsIt(t *testing.T) {
+	q, err := NewQueue(NewMemoryStore(), passRunner, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Shutdown(context.Background())
+	job, err := q.Submit("anon", &umpire.Payload{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, err = q.Cancel(job.Id); err != nil || job.State != Cancelled {
+		t.Fatalf("Cancel: got %+v, %v", job, err)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.cancelled) != 0 {
+		t.Errorf("cancelled queued job is still tracked: %v", q.cancelled)
+	}
+}
+
+func testPrune(t *testing.T, store Store) {
+	now := time.Now().UTC()
+	old := &Job{Id: "old", Batch: "b1", State: Done, Finished: now.Add(-2 * time.Hour)}
+	recent := &Job{Id: "recent", Batch: "b2", State: Done, Finished: now.Add(-time.Minute)}
+	// Jobs of a batch go together, so this one stays with queued.
+	older := &Job{Id: "older", Batch: "b2", State: Done, Finished: now.Add(-3 * time.Hour)}
+	queued := &Job{Id: "queued", Batch: "b2", State: Queued}
+	single := &Job{Id: "single", State: Cancelled, Finished: now.Add(-2 * time.Hour)}
+	if err := store.PutJobs(&Batch{Id: "b1", Jobs: []string{"old"}}, []*Job{old}); err != nil {
+		t.Fatal(err)
+	}
+	batch := &Batch{Id: "b2", Jobs: []string{"recent", "older", "queued"}}
+	if err := store.PutJobs(batch, []*Job{recent, older, queued}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(single); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := store.Prune(now.Add(-time.Hour)); err != nil || n != 2 {
+		t.Fatalf("Prune: got %d, %v, expected 2 jobs pruned", n, err)
+	}
+	for _, id := range []string{"old", "single"} {
+		if _, err := store.Get(id); err != ErrNotFound {
+			t.Errorf("Get(%s): got %v, expected ErrNotFound", id, err)
+		}
+	}
+	if _, err := store.GetBatch("b1"); err != ErrBatchNotFound {
+		t.Errorf("GetBatch(b1): got %v, expected ErrBatchNotFound", err)
+	}
+	for _, id := range []string{"recent", "older", "queued"} {
+		if _, err := store.Get(id); err != nil {
+			t.Errorf("Get(%s): %v", id, err)
+		}
+	}
+	if _, err := store.GetBatch("b2"); err != nil {
+		t.Errorf("GetBatch(b2): %v", err)
+	}
+	unfinished, err := store.Unfinished()
+	if err != nil || len(unfinished) != 1 || unfinished[0].Id != "queued" {
+		t.Errorf("Unfinished: got %+v, %v", unfinished, err)
+	}
+}
+
+func TestMemoryStorePrune(t *testing.T) {
+	testPrune(t, NewMemoryStore())
+}
+
+func TestBoltStorePrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewBoltStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	testPrune(t, store)
+}
+
+func TestBoltStoreIndexesUnfinishedJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jobs.db")
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range []*Job{{Id: "a", State: Queued}, {Id: "b", State: Running}, {Id: "c", State: Done}} {
+		if err := store.Put(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Put(&Job{Id: "b", State: Cancelled}); err != nil {
+		t.Fatal(err)
+	}
+	// Drop the index, as in files written before it existed.
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(unfinishedBucket)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	unfinished, err := store.Unfinished()
+	if err != nil || len(unfinished) != 1 || unfinished[0].Id != "a" {
+		t.Errorf("Unfinished: got %+v, %v, expected only a", unfinished, err)
+	}
+}
@@ -0,0 +1,415 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"sync"
+	"time"
+)
+
+// Store persists jobs. Implementations must be safe for concurrent use.
+type Store interface {
+	Put(job *Job) error
+	Get(id string) (*Job, error)
+	List() ([]*Job, error)
+	// Unfinished lists the jobs that have not ended.
+	Unfinished() ([]*Job, error)
+	// Prune deletes the jobs that ended before the given time. The jobs
+	// of a batch are deleted together with it, once all of them can be.
+	// It returns how many jobs it deleted.
+	Prune(before time.Time) (int, error)
+	PutBatch(batch *Batch) error
+	// PutJobs stores batch and its jobs together: either all are stored
+	// or none are.
+	PutJobs(batch *Batch, jobs []*Job) error
+	GetBatch(id string) (*Batch, error)
+}
+
+var ErrNotFound = fmt.Errorf("Job not found")
+var ErrBatchNotFound = fmt.Errorf("Batch not found")
+
+// MemoryStore keeps jobs in memory; they are lost when the process exits.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	jobs    map[string][]byte
+	batches map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: map[string][]byte{}, batches: map[string][]byte{}}
+}
+
+// Jobs are stored encoded so callers never share a *Job with the store.
+func (s *MemoryStore) Put(job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.Id] = data
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*Job, error) {
+	s.mu.RLock()
+	data, ok := s.jobs[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	job := &Job{}
+	return job, json.Unmarshal(data, job)
+}
+
+func (s *MemoryStore) List() ([]*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jobs := []*Job{}
+	for _, data := range s.jobs {
+		job := &Job{}
+		if err := json.Unmarshal(data, job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (s *MemoryStore) Unfinished() ([]*Job, error) {
+	all, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	jobs := []*Job{}
+	for _, job := range all {
+		if !job.Ended() {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (s *MemoryStore) Prune(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := map[string]bool{}
+	for id, data := range s.jobs {
+		job := &Job{}
+		if err := json.Unmarshal(data, job); err != nil {
+			return 0, err
+		}
+		old[id] = job.Ended() && job.Finished.Before(before)
+	}
+	for id, data := range s.batches {
+		batch := &Batch{}
+		if err := json.Unmarshal(data, batch); err != nil {
+			return 0, err
+		}
+		if !keepBatch(batch, old) {
+			delete(s.batches, id)
+		}
+	}
+	pruned := 0
+	for id, prune := range old {
+		if prune {
+			delete(s.jobs, id)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// keepBatch reports whether batch has a job Prune keeps, in which case
+// none of its jobs are pruned so the batch can still be summarized.
+func keepBatch(batch *Batch, old map[string]bool) bool {
+	for _, id := range batch.Jobs {
+		if prune, ok := old[id]; ok && !prune {
+			for _, id := range batch.Jobs {
+				if _, ok := old[id]; ok {
+					old[id] = false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) PutBatch(batch *Batch) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches[batch.Id] = data
+	return nil
+}
+
+func (s *MemoryStore) PutJobs(batch *Batch, jobs []*Job) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	encoded := [][]byte{}
+	for _, job := range jobs {
+		job, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		encoded = append(encoded, job)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches[batch.Id] = data
+	for i, job := range jobs {
+		s.jobs[job.Id] = encoded[i]
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetBatch(id string) (*Batch, error) {
+	s.mu.RLock()
+	data, ok := s.batches[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrBatchNotFound
+	}
+	batch := &Batch{}
+	return batch, json.Unmarshal(data, batch)
+}
+
+var (
+	jobsBucket    = []byte("jobs")
+	batchesBucket = []byte("batches")
+	// unfinishedBucket maps the ids of the jobs that have not ended to
+	// their state, so a restart does not read every job ever run.
+	unfinishedBucket = []byte("unfinished")
+)
+
+// BoltStore keeps jobs in a bolt database file so they survive restarts.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{jobsBucket, batchesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(unfinishedBucket) != nil {
+			return nil
+		}
+		// Files written before the index existed get it built once.
+		index, err := tx.CreateBucket(unfinishedBucket)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			job := &Job{}
+			if err := json.Unmarshal(v, job); err != nil {
+				return err
+			}
+			if job.Ended() {
+				return nil
+			}
+			return index.Put(k, []byte(job.State))
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db}, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) Put(job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJob(tx, job, data)
+	})
+}
+
+// putJob stores job, encoded as data, and keeps the unfinished index.
+func putJob(tx *bolt.Tx, job *Job, data []byte) error {
+	if err := tx.Bucket(jobsBucket).Put([]byte(job.Id), data); err != nil {
+		return err
+	}
+	index := tx.Bucket(unfinishedBucket)
+	if job.Ended() {
+		return index.Delete([]byte(job.Id))
+	}
+	return index.Put([]byte(job.Id), []byte(job.State))
+}
+
+func (s *BoltStore) Get(id string) (*Job, error) {
+	job := &Job{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *BoltStore) List() ([]*Job, error) {
+	jobs := []*Job{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			job := &Job{}
+			if err := json.Unmarshal(v, job); err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (s *BoltStore) Unfinished() ([]*Job, error) {
+	jobs := []*Job{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		all := tx.Bucket(jobsBucket)
+		return tx.Bucket(unfinishedBucket).ForEach(func(k, v []byte) error {
+			data := all.Get(k)
+			if data == nil {
+				return nil
+			}
+			job := &Job{}
+			if err := json.Unmarshal(data, job); err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (s *BoltStore) Prune(before time.Time) (int, error) {
+	pruned := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		all, index, batches := tx.Bucket(jobsBucket), tx.Bucket(unfinishedBucket), tx.Bucket(batchesBucket)
+		old := map[string]bool{}
+		err := all.ForEach(func(k, v []byte) error {
+			if index.Get(k) != nil {
+				old[string(k)] = false
+				return nil
+			}
+			job := &Job{}
+			if err := json.Unmarshal(v, job); err != nil {
+				return err
+			}
+			old[string(k)] = job.Ended() && job.Finished.Before(before)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// Buckets must not change while ForEach walks them.
+		empty := []string{}
+		err = batches.ForEach(func(k, v []byte) error {
+			batch := &Batch{}
+			if err := json.Unmarshal(v, batch); err != nil {
+				return err
+			}
+			if !keepBatch(batch, old) {
+				empty = append(empty, string(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range empty {
+			if err := batches.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		for id, prune := range old {
+			if !prune {
+				continue
+			}
+			if err := all.Delete([]byte(id)); err != nil {
+				return err
+			}
+			pruned++
+		}
+		return nil
+	})
+	return pruned, err
+}
+
+func (s *BoltStore) PutBatch(batch *Batch) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(batchesBucket).Put([]byte(batch.Id), data)
+	})
+}
+
+func (s *BoltStore) PutJobs(batch *Batch, jobs []*Job) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(batchesBucket).Put([]byte(batch.Id), data); err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			data, err := json.Marshal(job)
+			if err != nil {
+				return err
+			}
+			if err := putJob(tx, job, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) GetBatch(id string) (*Batch, error) {
+	batch := &Batch{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(batchesBucket).Get([]byte(id))
+		if data == nil {
+			return ErrBatchNotFound
+		}
+		return json.Unmarshal(data, batch)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
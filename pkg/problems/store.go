@@ -0,0 +1,159 @@
+package problems
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/maddyonline/umpire"
+	bolt "go.etcd.io/bbolt"
+	"sync"
+	"time"
+)
+
+// Store persists problems published through the API. Implementations must
+// be safe for concurrent use.
+type Store interface {
+	Put(id string, jd *umpire.JudgeData) error
+	Get(id string) (*umpire.JudgeData, error)
+	Delete(id string) error
+	List() (map[string]*umpire.JudgeData, error)
+}
+
+var ErrNotFound = fmt.Errorf("Problem not found")
+
+// MemoryStore keeps problems in memory; they are lost when the process exits.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	problems map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{problems: map[string][]byte{}}
+}
+
+// Problems are stored encoded so callers never share a *JudgeData with the
+// store.
+func (s *MemoryStore) Put(id string, jd *umpire.JudgeData) error {
+	data, err := json.Marshal(jd)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.problems[id] = data
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*umpire.JudgeData, error) {
+	s.mu.RLock()
+	data, ok := s.problems[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	jd := &umpire.JudgeData{}
+	return jd, json.Unmarshal(data, jd)
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.problems[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.problems, id)
+	return nil
+}
+
+func (s *MemoryStore) List() (map[string]*umpire.JudgeData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	problems := map[string]*umpire.JudgeData{}
+	for id, data := range s.problems {
+		jd := &umpire.JudgeData{}
+		if err := json.Unmarshal(data, jd); err != nil {
+			return nil, err
+		}
+		problems[id] = jd
+	}
+	return problems, nil
+}
+
+var problemsBucket = []byte("problems")
+
+// BoltStore keeps problems in a bolt database file so they survive restarts.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(problemsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db}, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) Put(id string, jd *umpire.JudgeData) error {
+	data, err := json.Marshal(jd)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(problemsBucket).Put([]byte(id), data)
+	})
+}
+
+func (s *BoltStore) Get(id string) (*umpire.JudgeData, error) {
+	jd := &umpire.JudgeData{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(problemsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, jd)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jd, nil
+}
+
+func (s *BoltStore) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(problemsBucket)
+		if b.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		return b.Delete([]byte(id))
+	})
+}
+
+func (s *BoltStore) List() (map[string]*umpire.JudgeData, error) {
+	problems := map[string]*umpire.JudgeData{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(problemsBucket).ForEach(func(k, v []byte) error {
+			jd := &umpire.JudgeData{}
+			if err := json.Unmarshal(v, jd); err != nil {
+				return err
+			}
+			problems[string(k)] = jd
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return problems, nil
+}
@@ -0,0 +1,54 @@
+package problems
+
+import (
+	"github.com/maddyonline/umpire"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testStore(t *testing.T, s Store) {
+	jd := &umpire.JudgeData{
+		Solution: &umpire.Payload{Language: "cpp"},
+		IO:       []*umpire.InputOutput{{Input: "1 2\n", Output: "3\n"}},
+	}
+	if err := s.Put("sum", jd); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get("sum")
+	if err != nil || got.Solution.Language != "cpp" || len(got.IO) != 1 || got.IO[0].Output != "3\n" {
+		t.Errorf("Get: got %+v, %v", got, err)
+	}
+	all, err := s.List()
+	if err != nil || len(all) != 1 || all["sum"] == nil {
+		t.Errorf("List: got %v, %v", all, err)
+	}
+	if err := s.Delete("sum"); err != nil {
+		t.Errorf("Delete: %v", err)
+	}
+	if _, err := s.Get("sum"); err != ErrNotFound {
+		t.Errorf("Get after Delete: expected ErrNotFound, got %v", err)
+	}
+	if err := s.Delete("sum"); err != ErrNotFound {
+		t.Errorf("Delete twice: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "umpire_problems_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewBoltStore(filepath.Join(dir, "problems.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testStore(t, s)
+}
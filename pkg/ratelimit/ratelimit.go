@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Store keeps fixed-window counters. A counter starts at zero at the
+// beginning of every window; windows are aligned to multiples of their
+// length since the unix epoch so that all servers sharing a store agree on
+// them.
+type Store interface {
+	// Add adds n to the counter for key in the window containing now and
+	// returns the new count and when the window ends.
+	Add(key string, n int64, window time.Duration, now time.Time) (int64, time.Time, error)
+	// Get is Add without changing the counter.
+	Get(key string, window time.Duration, now time.Time) (int64, time.Time, error)
+}
+
+type counter struct {
+	count int64
+	reset time.Time
+}
+
+// MemoryStore is a Store local to this process.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+	pruned   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: map[string]*counter{}}
+}
+
+func windowEnd(window time.Duration, now time.Time) time.Time {
+	return now.Truncate(window).Add(window)
+}
+
+func (s *MemoryStore) counter(key string, window time.Duration, now time.Time) *counter {
+	if now.Sub(s.pruned) > time.Minute {
+		for k, c := range s.counters {
+			if !now.Before(c.reset) {
+				delete(s.counters, k)
+			}
+		}
+		s.pruned = now
+	}
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.reset) {
+		c = &counter{reset: windowEnd(window, now)}
+		s.counters[key] = c
+	}
+	return c
+}
+
+func (s *MemoryStore) Add(key string, n int64, window time.Duration, now time.Time) (int64, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.counter(key, window, now)
+	c.count += n
+	return c.count, c.reset, nil
+}
+
+func (s *MemoryStore) Get(key string, window time.Duration, now time.Time) (int64, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.counter(key, window, now)
+	return c.count, c.reset, nil
+}
@@ -0,0 +1,29 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreWindows(t *testing.T) {
+	s := NewMemoryStore()
+	start := time.Unix(600, 0)
+	for i := int64(1); i <= 3; i++ {
+		count, reset, err := s.Add("k", 1, time.Minute, start.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != i || !reset.Equal(start.Add(time.Minute)) {
+			t.Errorf("Add: got count %d reset %v", count, reset)
+		}
+	}
+	if count, _, _ := s.Get("k", time.Minute, start.Add(30*time.Second)); count != 3 {
+		t.Errorf("Get: expected 3, got %d", count)
+	}
+	if count, _, _ := s.Get("k", time.Minute, start.Add(time.Minute)); count != 0 {
+		t.Errorf("Get: counter should restart with the next window, got %d", count)
+	}
+	if count, _, _ := s.Add("other", 5, time.Minute, start); count != 5 {
+		t.Errorf("Add: keys should be independent, got %d", count)
+	}
+}
@@ -0,0 +1,40 @@
+package submissions
+
+import (
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/umpire/pkg/webhooks"
+)
+
+// Request turns a submission into the URL and body of the POST sending it.
+type Request func(sub *Submission) (url string, body []byte, err error)
+
+// HTTPSink POSTs submissions to an HTTP consumer the server is configured
+// with, as deliveries to an internal target of a webhooks.Dispatcher. They
+// share its store and its log with callbacks, so with a durable store
+// nothing is lost while the consumer is down or the server restarts, and
+// they are sent in order.
+type HTTPSink struct {
+	Name string
+
+	request Request
+	hooks   *webhooks.Dispatcher
+}
+
+func NewHTTPSink(name string, request Request, hooks *webhooks.Dispatcher) *HTTPSink {
+	return &HTTPSink{Name: name, request: request, hooks: hooks}
+}
+
+func (s *HTTPSink) Record(sub *Submission) error {
+	url, body, err := s.request(sub)
+	if err != nil {
+		log.Warnf("%s: dropping submission %s: %v", s.Name, sub.Id, err)
+		return nil
+	}
+	return s.hooks.Deliver(&webhooks.Target{Name: s.Name, URL: url, Internal: true}, sub.Id, body)
+}
+
+// Close does nothing: what is left to send belongs to the dispatcher,
+// which its owner closes.
+func (s *HTTPSink) Close() error {
+	return nil
+}
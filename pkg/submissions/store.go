@@ -0,0 +1,276 @@
+package submissions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/maddyonline/umpire"
+	bolt "go.etcd.io/bbolt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Submission is a judged submission as kept by sinks.
+type Submission struct {
+	Id        string           `json:"id"`
+	Uid       string           `json:"uid"`
+	ProblemId string           `json:"problem_id"`
+	Language  string           `json:"language"`
+	Payload   *umpire.Payload  `json:"payload"`
+	Result    *umpire.Response `json:"result"`
+	Submitted time.Time        `json:"submitted"`
+	Judged    time.Time        `json:"judged"`
+	// Rejudges lists the later judgements of the submission, oldest first;
+	// Result stays the original one.
+	Rejudges []*Rejudge `json:"rejudges,omitempty"`
+}
+
+// Rejudge is a judgement of a stored submission made again, typically
+// after its problem's testcases changed. Previous is the verdict it
+// replaced, so Status != Previous marks a changed verdict.
+type Rejudge struct {
+	Batch          string          `json:"batch"`
+	Judged         time.Time       `json:"judged"`
+	ProblemVersion uint64          `json:"problem_version,omitempty"`
+	Previous       umpire.Decision `json:"previous"`
+	Status         umpire.Decision `json:"status"`
+	Details        string          `json:"details,omitempty"`
+}
+
+// Verdict is the status of the latest judgement of the submission.
+func (sub *Submission) Verdict() umpire.Decision {
+	if n := len(sub.Rejudges); n > 0 {
+		return sub.Rejudges[n-1].Status
+	}
+	if sub.Result == nil {
+		return ""
+	}
+	return sub.Result.Status
+}
+
+// Sink receives every judged submission. Record must not block on slow
+// consumers; implementations must be safe for concurrent use.
+type Sink interface {
+	Record(sub *Submission) error
+	Close() error
+}
+
+// Query selects submissions. Empty fields match every submission; Limit of
+// zero means no limit. Status matches the latest verdict, and Since and
+// Until bound the time a submission was made, Until excluded.
+type Query struct {
+	Uid       string
+	ProblemId string
+	Status    umpire.Decision
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+func (q *Query) matches(sub *Submission) bool {
+	return (q.Uid == "" || q.Uid == sub.Uid) && (q.ProblemId == "" || q.ProblemId == sub.ProblemId) &&
+		(q.Status == "" || q.Status == sub.Verdict()) &&
+		(q.Since.IsZero() || !sub.Submitted.Before(q.Since)) &&
+		(q.Until.IsZero() || sub.Submitted.Before(q.Until))
+}
+
+// Store is a Sink that keeps submissions to be looked up later.
+type Store interface {
+	Sink
+	Get(id string) (*Submission, error)
+	// Find returns the submissions matching q, most recently judged first.
+	Find(q *Query) ([]*Submission, error)
+}
+
+var ErrNotFound = fmt.Errorf("Submission not found")
+
+type byJudged []*Submission
+
+func (a byJudged) Len() int           { return len(a) }
+func (a byJudged) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byJudged) Less(i, j int) bool { return a[i].Judged.After(a[j].Judged) }
+
+func limit(subs []*Submission, n int) []*Submission {
+	if n > 0 && len(subs) > n {
+		return subs[:n]
+	}
+	return subs
+}
+
+// MemoryStore keeps submissions in memory; they are lost when the process
+// exits.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	submissions map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{submissions: map[string][]byte{}}
+}
+
+// Submissions are stored encoded so callers never share one with the store.
+func (s *MemoryStore) Record(sub *Submission) error {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.submissions[sub.Id] = data
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*Submission, error) {
+	s.mu.RLock()
+	data, ok := s.submissions[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	sub := &Submission{}
+	return sub, json.Unmarshal(data, sub)
+}
+
+func (s *MemoryStore) Find(q *Query) ([]*Submission, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	subs := byJudged{}
+	for _, data := range s.submissions {
+		sub := &Submission{}
+		if err := json.Unmarshal(data, sub); err != nil {
+			return nil, err
+		}
+		if q.matches(sub) {
+			subs = append(subs, sub)
+		}
+	}
+	sort.Sort(subs)
+	return limit(subs, q.Limit), nil
+}
+
+var (
+	submissionsBucket = []byte("submissions")
+	byUidBucket       = []byte("by_uid")
+	byProblemBucket   = []byte("by_problem")
+)
+
+// BoltStore keeps submissions in a bolt database file, indexed by user and
+// by problem.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{submissionsBucket, byUidBucket, byProblemBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db}, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// indexKey sorts the submissions of one user or problem by judging time.
+func indexKey(value string, sub *Submission) []byte {
+	return []byte(value + "\x00" + sub.Judged.UTC().Format("20060102T150405.000000000") + "\x00" + sub.Id)
+}
+
+func (s *BoltStore) Record(sub *Submission) error {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(submissionsBucket)
+		if old := b.Get([]byte(sub.Id)); old != nil {
+			prev := &Submission{}
+			if err := json.Unmarshal(old, prev); err != nil {
+				return err
+			}
+			tx.Bucket(byUidBucket).Delete(indexKey(prev.Uid, prev))
+			tx.Bucket(byProblemBucket).Delete(indexKey(prev.ProblemId, prev))
+		}
+		if err := tx.Bucket(byUidBucket).Put(indexKey(sub.Uid, sub), []byte(sub.Id)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(byProblemBucket).Put(indexKey(sub.ProblemId, sub), []byte(sub.Id)); err != nil {
+			return err
+		}
+		return b.Put([]byte(sub.Id), data)
+	})
+}
+
+func (s *BoltStore) Get(id string) (*Submission, error) {
+	sub := &Submission{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(submissionsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, sub)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (s *BoltStore) Find(q *Query) ([]*Submission, error) {
+	subs := byJudged{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		all := tx.Bucket(submissionsBucket)
+		add := func(data []byte) error {
+			sub := &Submission{}
+			if err := json.Unmarshal(data, sub); err != nil {
+				return err
+			}
+			if q.matches(sub) {
+				subs = append(subs, sub)
+			}
+			return nil
+		}
+		index, value := byUidBucket, q.Uid
+		if value == "" {
+			index, value = byProblemBucket, q.ProblemId
+		}
+		if value == "" {
+			return all.ForEach(func(k, v []byte) error {
+				return add(v)
+			})
+		}
+		prefix := []byte(value + "\x00")
+		c := tx.Bucket(index).Cursor()
+		for k, id := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, id = c.Next() {
+			if data := all.Get(id); data != nil {
+				if err := add(data); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(subs)
+	return limit(subs, q.Limit), nil
+}
@@ -0,0 +1,187 @@
+package submissions
+
+import (
+	"fmt"
+	"github.com/maddyonline/umpire"
+	"github.com/maddyonline/umpire/pkg/webhooks"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func submission(id, uid, problem string, judged time.Time) *Submission {
+	return &Submission{
+		Id:        id,
+		Uid:       uid,
+		ProblemId: problem,
+		Payload:   &umpire.Payload{Language: "cpp", Problem: &umpire.Problem{Id: problem}},
+		Result:    &umpire.Response{Status: umpire.Pass},
+		Submitted: judged,
+		Judged:    judged,
+	}
+}
+
+func ids(subs []*Submission) []string {
+	out := []string{}
+	for _, sub := range subs {
+		out = append(out, sub.Id)
+	}
+	return out
+}
+
+func testStore(t *testing.T, s Store) {
+	now := time.Now().UTC()
+	for i, sub := range []*Submission{
+		submission("a", "alice", "sum", now),
+		submission("b", "bob", "sum", now.Add(time.Second)),
+		submission("c", "alice", "max", now.Add(2*time.Second)),
+	} {
+		if err := s.Record(sub); err != nil {
+			t.Fatalf("Record %d: %v", i, err)
+		}
+	}
+	if sub, err := s.Get("b"); err != nil || sub.Uid != "bob" || sub.Result.Status != umpire.Pass {
+		t.Errorf("Get: got %+v, %v", sub, err)
+	}
+	if _, err := s.Get("nope"); err != ErrNotFound {
+		t.Errorf("Get: expected ErrNotFound, got %v", err)
+	}
+	tests := []struct {
+		q    *Query
+		want string
+	}{
+		{&Query{}, "[c b a]"},
+		{&Query{Uid: "alice"}, "[c a]"},
+		{&Query{ProblemId: "sum"}, "[b a]"},
+		{&Query{Uid: "alice", ProblemId: "sum"}, "[a]"},
+		{&Query{Limit: 1}, "[c]"},
+		{&Query{Since: now.Add(time.Second)}, "[c b]"},
+		{&Query{Since: now, Until: now.Add(2 * time.Second)}, "[b a]"},
+		{&Query{Status: umpire.Fail}, "[]"},
+	}
+	for _, test := range tests {
+		subs, err := s.Find(test.q)
+		if err != nil {
+			t.Errorf("Find(%+v): %v", test.q, err)
+		}
+		if got := fmt.Sprint(ids(subs)); got != test.want {
+			t.Errorf("Find(%+v): expected %s, got %s", test.q, test.want, got)
+		}
+	}
+	// Recording a submission again replaces it.
+	if err := s.Record(submission("a", "alice", "max", now.Add(3*time.Second))); err != nil {
+		t.Fatal(err)
+	}
+	if subs, _ := s.Find(&Query{ProblemId: "sum"}); fmt.Sprint(ids(subs)) != "[b]" {
+		t.Errorf("Find after update: expected [b], got %s", fmt.Sprint(ids(subs)))
+	}
+	// Status matches the verdict of the latest rejudge.
+	sub, _ := s.Get("b")
+	sub.Rejudges = append(sub.Rejudges, &Rejudge{Batch: "r", Previous: umpire.Pass, Status: umpire.Fail})
+	if err := s.Record(sub); err != nil {
+		t.Fatal(err)
+	}
+	if subs, _ := s.Find(&Query{Status: umpire.Fail}); fmt.Sprint(ids(subs)) != "[b]" {
+		t.Errorf("Find by status after rejudge: expected [b], got %s", fmt.Sprint(ids(subs)))
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func openBolt(t *testing.T, dir string) *BoltStore {
+	s, err := NewBoltStore(filepath.Join(dir, "submissions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "umpire_submissions_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := openBolt(t, dir)
+	defer s.Close()
+	testStore(t, s)
+}
+
+func TestHTTPSinkSendsInOrderAcrossRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "umpire_submissions_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var up int32
+	received := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&up) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received <- r.URL.Path
+	}))
+	defer ts.Close()
+	request := func(sub *Submission) (string, []byte, error) {
+		return ts.URL + "/users/" + sub.Uid, []byte("{}"), nil
+	}
+	start := func() (*webhooks.BoltStore, *webhooks.Dispatcher) {
+		store, err := webhooks.NewBoltStore(filepath.Join(dir, "deliveries.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Loopback is fine for internal targets; callbacks would be refused.
+		hooks, err := webhooks.NewDispatcher(store, webhooks.NewClient(), 1, time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store, hooks
+	}
+
+	// The consumer is down: the submissions stay pending, across a
+	// restart, however often the first is tried.
+	store, hooks := start()
+	sink := NewHTTPSink("test", request, hooks)
+	for _, uid := range []string{"alice", "bob"} {
+		if err := sink.Record(submission(uid+"-sub", uid, "sum", time.Now())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	hooks.Close(0)
+	if pending, err := store.Pending(); err != nil || len(pending) != 2 {
+		t.Fatalf("pending after restart: expected 2 deliveries, got %d, %v", len(pending), err)
+	}
+	if log, _ := hooks.Deliveries("bob-sub"); len(log) != 0 {
+		t.Errorf("bob's submission was tried before alice's was sent: %+v", log)
+	}
+	store.Close()
+
+	atomic.StoreInt32(&up, 1)
+	store, hooks = start()
+	defer store.Close()
+	defer hooks.Close(0)
+	for _, expected := range []string{"/users/alice", "/users/bob"} {
+		select {
+		case path := <-received:
+			if path != expected {
+				t.Errorf("got %s, expected %s", path, expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s was not sent after restart", expected)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if log, _ := hooks.Deliveries("alice-sub"); len(log) < 2 || log[0].Target != "test" || !log[len(log)-1].Delivered {
+		t.Errorf("unexpected delivery log: %+v", log)
+	}
+}
@@ -0,0 +1,159 @@
+package umpirepb
+
+import (
+	"github.com/maddyonline/umpire"
+)
+
+// FromPayload converts an umpire payload to its protobuf message.
+func FromPayload(p *umpire.Payload) *Payload {
+	if p == nil {
+		return nil
+	}
+	out := &Payload{
+		Language:     p.Language,
+		Variant:      p.Variant,
+		Stdin:        p.Stdin,
+		SubmissionId: p.SubmissionId,
+	}
+	for _, f := range p.Files {
+		out.Files = append(out.Files, &File{Name: f.Name, Content: f.Content})
+	}
+	if p.Problem != nil {
+		out.ProblemId = p.Problem.Id
+	}
+	return out
+}
+
+// ToPayload converts a protobuf payload to an umpire payload.
+func ToPayload(p *Payload) *umpire.Payload {
+	if p == nil {
+		return nil
+	}
+	out := &umpire.Payload{
+		Language:     p.Language,
+		Variant:      p.Variant,
+		Stdin:        p.Stdin,
+		SubmissionId: p.SubmissionId,
+	}
+	for _, f := range p.Files {
+		out.Files = append(out.Files, &umpire.InMemoryFile{Name: f.Name, Content: f.Content})
+	}
+	if p.ProblemId != "" {
+		out.Problem = &umpire.Problem{Id: p.ProblemId}
+	}
+	return out
+}
+
+// FromDecision converts a verdict; anything but pass and fail is unspecified.
+func FromDecision(d umpire.Decision) Status {
+	switch d {
+	case umpire.Pass:
+		return Status_PASS
+	case umpire.Fail:
+		return Status_FAIL
+	}
+	return Status_STATUS_UNSPECIFIED
+}
+
+func ToDecision(s Status) umpire.Decision {
+	switch s {
+	case Status_PASS:
+		return umpire.Pass
+	case Status_FAIL:
+		return umpire.Fail
+	}
+	return ""
+}
+
+func FromResponse(r *umpire.Response) *Response {
+	if r == nil {
+		return nil
+	}
+	out := &Response{
+		Status:         FromDecision(r.Status),
+		Details:        r.Details,
+		Variant:        r.Variant,
+		Image:          r.Image,
+		Stdout:         r.Stdout,
+		Stderr:         r.Stderr,
+		ProblemVersion: r.ProblemVersion,
+		Expected:       r.Expected,
+		Truncated:      r.Truncated,
+	}
+	for _, row := range r.Diff {
+		out.Diff = append(out.Diff, &DiffRow{
+			Op:           string(row.Op),
+			GotLine:      int32(row.GotLine),
+			Got:          row.Got,
+			ExpectedLine: int32(row.ExpectedLine),
+			Expected:     row.Expected,
+		})
+	}
+	return out
+}
+
+func ToResponse(r *Response) *umpire.Response {
+	if r == nil {
+		return nil
+	}
+	out := &umpire.Response{
+		Status:         ToDecision(r.Status),
+		Details:        r.Details,
+		Variant:        r.Variant,
+		Image:          r.Image,
+		Stdout:         r.Stdout,
+		Stderr:         r.Stderr,
+		ProblemVersion: r.ProblemVersion,
+		Expected:       r.Expected,
+		Truncated:      r.Truncated,
+	}
+	for _, row := range r.Diff {
+		out.Diff = append(out.Diff, &umpire.DiffRow{
+			Op:           umpire.DiffOp(row.Op),
+			GotLine:      int(row.GotLine),
+			Got:          row.Got,
+			ExpectedLine: int(row.ExpectedLine),
+			Expected:     row.Expected,
+		})
+	}
+	return out
+}
+
+func FromJudgeData(jd *umpire.JudgeData) *JudgeData {
+	if jd == nil {
+		return nil
+	}
+	out := &JudgeData{Solution: FromPayload(jd.Solution)}
+	for _, io := range jd.IO {
+		out.Io = append(out.Io, &InputOutput{Input: io.Input, Output: io.Output})
+	}
+	return out
+}
+
+func ToJudgeData(jd *JudgeData) *umpire.JudgeData {
+	if jd == nil {
+		return nil
+	}
+	out := &umpire.JudgeData{Solution: ToPayload(jd.Solution)}
+	for _, io := range jd.Io {
+		out.IO = append(out.IO, &umpire.InputOutput{Input: io.Input, Output: io.Output})
+	}
+	return out
+}
+
+func FromEvent(ev *umpire.Event) *Event {
+	if ev == nil {
+		return nil
+	}
+	return &Event{
+		SubmissionId: ev.SubmissionId,
+		Type:         string(ev.Type),
+		Testcase:     int32(ev.Testcase),
+		Testcases:    int32(ev.Testcases),
+		Verdict:      FromDecision(ev.Verdict),
+		Details:      ev.Details,
+		TimeMs:       ev.TimeMs,
+		Result:       FromResponse(ev.Result),
+		TimeUnixNano: ev.Time.UnixNano(),
+	}
+}
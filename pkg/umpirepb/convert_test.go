@@ -0,0 +1,36 @@
+package umpirepb
+
+import (
+	"github.com/maddyonline/umpire"
+	"reflect"
+	"testing"
+)
+
+func TestPayloadRoundTrip(t *testing.T) {
+	in := &umpire.Payload{
+		Language: "cpp",
+		Variant:  "c++17",
+		Files:    []*umpire.InMemoryFile{{Name: "main.cpp", Content: "int main() {}"}},
+		Problem:  &umpire.Problem{Id: "sum"},
+		Stdin:    "1 2",
+	}
+	out := ToPayload(FromPayload(in))
+	if out.Language != in.Language || out.Variant != in.Variant || out.Stdin != in.Stdin ||
+		out.Problem == nil || out.Problem.Id != "sum" || len(out.Files) != 1 || *out.Files[0] != *in.Files[0] {
+		t.Errorf("expected %+v, got %+v", in, out)
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	in := &umpire.Response{
+		Status:   umpire.Fail,
+		Details:  "Mismatch Error: got 4, expected 3",
+		Stdout:   "4\n",
+		Expected: "3\n",
+		Diff:     umpire.Diff("4\n", "3\n"),
+	}
+	out := ToResponse(FromResponse(in))
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("expected %+v, got %+v", in, out)
+	}
+}
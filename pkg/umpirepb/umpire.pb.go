@@ -0,0 +1,762 @@
+// The gRPC API of umpire-server. It mirrors the HTTP API: Judge, Run,
+// Execute and Validate take the same payloads as /judge, /run, /execute and
+// /validate. Judge waits for the queued judgement to finish; JudgeProgress
+// streams its events as they happen, ending with the result.
+//
+// Regenerate the Go code after changing this file with
+//   protoc --go_out=paths=source_relative:. --go-grpc_out=paths=source_relative:. umpire.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v3.21.12
+// source: umpire.proto
+
+package umpirepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Status int32
+
+const (
+	Status_STATUS_UNSPECIFIED Status = 0
+	Status_PASS               Status = 1
+	Status_FAIL               Status = 2
+)
+
+// Enum value maps for Status.
+var (
+	Status_name = map[int32]string{
+		0: "STATUS_UNSPECIFIED",
+		1: "PASS",
+		2: "FAIL",
+	}
+	Status_value = map[string]int32{
+		"STATUS_UNSPECIFIED": 0,
+		"PASS":               1,
+		"FAIL":               2,
+	}
+)
+
+func (x Status) Enum() *Status {
+	p := new(Status)
+	*p = x
+	return p
+}
+
+func (x Status) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Status) Descriptor() protoreflect.EnumDescriptor {
+	return file_umpire_proto_enumTypes[0].Descriptor()
+}
+
+func (Status) Type() protoreflect.EnumType {
+	return &file_umpire_proto_enumTypes[0]
+}
+
+func (x Status) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Status.Descriptor instead.
+func (Status) EnumDescriptor() ([]byte, []int) {
+	return file_umpire_proto_rawDescGZIP(), []int{0}
+}
+
+type File struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Content       string                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *File) Reset() {
+	*x = File{}
+	mi := &file_umpire_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *File) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*File) ProtoMessage() {}
+
+func (x *File) ProtoReflect() protoreflect.Message {
+	mi := &file_umpire_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use File.ProtoReflect.Descriptor instead.
+func (*File) Descriptor() ([]byte, []int) {
+	return file_umpire_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *File) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *File) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+type Payload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Language      string                 `protobuf:"bytes,1,opt,name=language,proto3" json:"language,omitempty"`
+	Variant       string                 `protobuf:"bytes,2,opt,name=variant,proto3" json:"variant,omitempty"`
+	Files         []*File                `protobuf:"bytes,3,rep,name=files,proto3" json:"files,omitempty"`
+	ProblemId     string                 `protobuf:"bytes,4,opt,name=problem_id,json=problemId,proto3" json:"problem_id,omitempty"`
+	Stdin         string                 `protobuf:"bytes,5,opt,name=stdin,proto3" json:"stdin,omitempty"`
+	SubmissionId  string                 `protobuf:"bytes,6,opt,name=submission_id,json=submissionId,proto3" json:"submission_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Payload) Reset() {
+	*x = Payload{}
+	mi := &file_umpire_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Payload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Payload) ProtoMessage() {}
+
+func (x *Payload) ProtoReflect() protoreflect.Message {
+	mi := &file_umpire_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Payload.ProtoReflect.Descriptor instead.
+func (*Payload) Descriptor() ([]byte, []int) {
+	return file_umpire_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Payload) GetLanguage() string {
+	if x != nil {
+		return x.Language
+	}
+	return ""
+}
+
+func (x *Payload) GetVariant() string {
+	if x != nil {
+		return x.Variant
+	}
+	return ""
+}
+
+func (x *Payload) GetFiles() []*File {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+func (x *Payload) GetProblemId() string {
+	if x != nil {
+		return x.ProblemId
+	}
+	return ""
+}
+
+func (x *Payload) GetStdin() string {
+	if x != nil {
+		return x.Stdin
+	}
+	return ""
+}
+
+func (x *Payload) GetSubmissionId() string {
+	if x != nil {
+		return x.SubmissionId
+	}
+	return ""
+}
+
+type Response struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Status         Status                 `protobuf:"varint,1,opt,name=status,proto3,enum=umpire.Status" json:"status,omitempty"`
+	Details        string                 `protobuf:"bytes,2,opt,name=details,proto3" json:"details,omitempty"`
+	Variant        string                 `protobuf:"bytes,3,opt,name=variant,proto3" json:"variant,omitempty"`
+	Image          string                 `protobuf:"bytes,4,opt,name=image,proto3" json:"image,omitempty"`
+	Stdout         string                 `protobuf:"bytes,5,opt,name=stdout,proto3" json:"stdout,omitempty"`
+	Stderr         string                 `protobuf:"bytes,6,opt,name=stderr,proto3" json:"stderr,omitempty"`
+	ProblemVersion uint64                 `protobuf:"varint,7,opt,name=problem_version,json=problemVersion,proto3" json:"problem_version,omitempty"`
+	// Run only: the reference output, a line diff of stdout against it and
+	// whether either output was cut off.
+	Expected      string     `protobuf:"bytes,8,opt,name=expected,proto3" json:"expected,omitempty"`
+	Diff          []*DiffRow `protobuf:"bytes,9,rep,name=diff,proto3" json:"diff,omitempty"`
+	Truncated     bool       `protobuf:"varint,10,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Response) Reset() {
+	*x = Response{}
+	mi := &file_umpire_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Response) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Response) ProtoMessage() {}
+
+func (x *Response) ProtoReflect() protoreflect.Message {
+	mi := &file_umpire_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Response.ProtoReflect.Descriptor instead.
+func (*Response) Descriptor() ([]byte, []int) {
+	return file_umpire_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Response) GetStatus() Status {
+	if x != nil {
+		return x.Status
+	}
+	return Status_STATUS_UNSPECIFIED
+}
+
+func (x *Response) GetDetails() string {
+	if x != nil {
+		return x.Details
+	}
+	return ""
+}
+
+func (x *Response) GetVariant() string {
+	if x != nil {
+		return x.Variant
+	}
+	return ""
+}
+
+func (x *Response) GetImage() string {
+	if x != nil {
+		return x.Image
+	}
+	return ""
+}
+
+func (x *Response) GetStdout() string {
+	if x != nil {
+		return x.Stdout
+	}
+	return ""
+}
+
+func (x *Response) GetStderr() string {
+	if x != nil {
+		return x.Stderr
+	}
+	return ""
+}
+
+func (x *Response) GetProblemVersion() uint64 {
+	if x != nil {
+		return x.ProblemVersion
+	}
+	return 0
+}
+
+func (x *Response) GetExpected() string {
+	if x != nil {
+		return x.Expected
+	}
+	return ""
+}
+
+func (x *Response) GetDiff() []*DiffRow {
+	if x != nil {
+		return x.Diff
+	}
+	return nil
+}
+
+func (x *Response) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+// DiffRow is one row of a side-by-side diff; op is equal, changed, extra or
+// missing.
+type DiffRow struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Op            string                 `protobuf:"bytes,1,opt,name=op,proto3" json:"op,omitempty"`
+	GotLine       int32                  `protobuf:"varint,2,opt,name=got_line,json=gotLine,proto3" json:"got_line,omitempty"`
+	Got           string                 `protobuf:"bytes,3,opt,name=got,proto3" json:"got,omitempty"`
+	ExpectedLine  int32                  `protobuf:"varint,4,opt,name=expected_line,json=expectedLine,proto3" json:"expected_line,omitempty"`
+	Expected      string                 `protobuf:"bytes,5,opt,name=expected,proto3" json:"expected,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DiffRow) Reset() {
+	*x = DiffRow{}
+	mi := &file_umpire_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DiffRow) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DiffRow) ProtoMessage() {}
+
+func (x *DiffRow) ProtoReflect() protoreflect.Message {
+	mi := &file_umpire_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DiffRow.ProtoReflect.Descriptor instead.
+func (*DiffRow) Descriptor() ([]byte, []int) {
+	return file_umpire_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DiffRow) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+func (x *DiffRow) GetGotLine() int32 {
+	if x != nil {
+		return x.GotLine
+	}
+	return 0
+}
+
+func (x *DiffRow) GetGot() string {
+	if x != nil {
+		return x.Got
+	}
+	return ""
+}
+
+func (x *DiffRow) GetExpectedLine() int32 {
+	if x != nil {
+		return x.ExpectedLine
+	}
+	return 0
+}
+
+func (x *DiffRow) GetExpected() string {
+	if x != nil {
+		return x.Expected
+	}
+	return ""
+}
+
+type InputOutput struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Input         string                 `protobuf:"bytes,1,opt,name=input,proto3" json:"input,omitempty"`
+	Output        string                 `protobuf:"bytes,2,opt,name=output,proto3" json:"output,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InputOutput) Reset() {
+	*x = InputOutput{}
+	mi := &file_umpire_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InputOutput) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InputOutput) ProtoMessage() {}
+
+func (x *InputOutput) ProtoReflect() protoreflect.Message {
+	mi := &file_umpire_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InputOutput.ProtoReflect.Descriptor instead.
+func (*InputOutput) Descriptor() ([]byte, []int) {
+	return file_umpire_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *InputOutput) GetInput() string {
+	if x != nil {
+		return x.Input
+	}
+	return ""
+}
+
+func (x *InputOutput) GetOutput() string {
+	if x != nil {
+		return x.Output
+	}
+	return ""
+}
+
+// JudgeData is a problem: its reference solution and testcases.
+type JudgeData struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Solution      *Payload               `protobuf:"bytes,1,opt,name=solution,proto3" json:"solution,omitempty"`
+	Io            []*InputOutput         `protobuf:"bytes,2,rep,name=io,proto3" json:"io,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JudgeData) Reset() {
+	*x = JudgeData{}
+	mi := &file_umpire_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JudgeData) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JudgeData) ProtoMessage() {}
+
+func (x *JudgeData) ProtoReflect() protoreflect.Message {
+	mi := &file_umpire_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JudgeData.ProtoReflect.Descriptor instead.
+func (*JudgeData) Descriptor() ([]byte, []int) {
+	return file_umpire_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *JudgeData) GetSolution() *Payload {
+	if x != nil {
+		return x.Solution
+	}
+	return nil
+}
+
+func (x *JudgeData) GetIo() []*InputOutput {
+	if x != nil {
+		return x.Io
+	}
+	return nil
+}
+
+// Event reports the progress of a judgement, see umpire.Event. Testcases are
+// numbered from 1; verdict and time_ms are only set when a testcase
+// finishes, result only on the last event, of type "result".
+type Event struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SubmissionId  string                 `protobuf:"bytes,1,opt,name=submission_id,json=submissionId,proto3" json:"submission_id,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Testcase      int32                  `protobuf:"varint,3,opt,name=testcase,proto3" json:"testcase,omitempty"`
+	Testcases     int32                  `protobuf:"varint,4,opt,name=testcases,proto3" json:"testcases,omitempty"`
+	Verdict       Status                 `protobuf:"varint,5,opt,name=verdict,proto3,enum=umpire.Status" json:"verdict,omitempty"`
+	Details       string                 `protobuf:"bytes,6,opt,name=details,proto3" json:"details,omitempty"`
+	TimeMs        int64                  `protobuf:"varint,7,opt,name=time_ms,json=timeMs,proto3" json:"time_ms,omitempty"`
+	Result        *Response              `protobuf:"bytes,8,opt,name=result,proto3" json:"result,omitempty"`
+	TimeUnixNano  int64                  `protobuf:"varint,9,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_umpire_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_umpire_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_umpire_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Event) GetSubmissionId() string {
+	if x != nil {
+		return x.SubmissionId
+	}
+	return ""
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetTestcase() int32 {
+	if x != nil {
+		return x.Testcase
+	}
+	return 0
+}
+
+func (x *Event) GetTestcases() int32 {
+	if x != nil {
+		return x.Testcases
+	}
+	return 0
+}
+
+func (x *Event) GetVerdict() Status {
+	if x != nil {
+		return x.Verdict
+	}
+	return Status_STATUS_UNSPECIFIED
+}
+
+func (x *Event) GetDetails() string {
+	if x != nil {
+		return x.Details
+	}
+	return ""
+}
+
+func (x *Event) GetTimeMs() int64 {
+	if x != nil {
+		return x.TimeMs
+	}
+	return 0
+}
+
+func (x *Event) GetResult() *Response {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *Event) GetTimeUnixNano() int64 {
+	if x != nil {
+		return x.TimeUnixNano
+	}
+	return 0
+}
+
+var File_umpire_proto protoreflect.FileDescriptor
+
+const file_umpire_proto_rawDesc = "" +
+	"\n" +
+	"\fumpire.proto\x12\x06umpire\"4\n" +
+	"\x04File\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x18\n" +
+	"\acontent\x18\x02 \x01(\tR\acontent\"\xbd\x01\n" +
+	"\aPayload\x12\x1a\n" +
+	"\blanguage\x18\x01 \x01(\tR\blanguage\x12\x18\n" +
+	"\avariant\x18\x02 \x01(\tR\avariant\x12\"\n" +
+	"\x05files\x18\x03 \x03(\v2\f.umpire.FileR\x05files\x12\x1d\n" +
+	"\n" +
+	"problem_id\x18\x04 \x01(\tR\tproblemId\x12\x14\n" +
+	"\x05stdin\x18\x05 \x01(\tR\x05stdin\x12#\n" +
+	"\rsubmission_id\x18\x06 \x01(\tR\fsubmissionId\"\xb4\x02\n" +
+	"\bResponse\x12&\n" +
+	"\x06status\x18\x01 \x01(\x0e2\x0e.umpire.StatusR\x06status\x12\x18\n" +
+	"\adetails\x18\x02 \x01(\tR\adetails\x12\x18\n" +
+	"\avariant\x18\x03 \x01(\tR\avariant\x12\x14\n" +
+	"\x05image\x18\x04 \x01(\tR\x05image\x12\x16\n" +
+	"\x06stdout\x18\x05 \x01(\tR\x06stdout\x12\x16\n" +
+	"\x06stderr\x18\x06 \x01(\tR\x06stderr\x12'\n" +
+	"\x0fproblem_version\x18\a \x01(\x04R\x0eproblemVersion\x12\x1a\n" +
+	"\bexpected\x18\b \x01(\tR\bexpected\x12#\n" +
+	"\x04diff\x18\t \x03(\v2\x0f.umpire.DiffRowR\x04diff\x12\x1c\n" +
+	"\ttruncated\x18\n" +
+	" \x01(\bR\ttruncated\"\x87\x01\n" +
+	"\aDiffRow\x12\x0e\n" +
+	"\x02op\x18\x01 \x01(\tR\x02op\x12\x19\n" +
+	"\bgot_line\x18\x02 \x01(\x05R\agotLine\x12\x10\n" +
+	"\x03got\x18\x03 \x01(\tR\x03got\x12#\n" +
+	"\rexpected_line\x18\x04 \x01(\x05R\fexpectedLine\x12\x1a\n" +
+	"\bexpected\x18\x05 \x01(\tR\bexpected\";\n" +
+	"\vInputOutput\x12\x14\n" +
+	"\x05input\x18\x01 \x01(\tR\x05input\x12\x16\n" +
+	"\x06output\x18\x02 \x01(\tR\x06output\"]\n" +
+	"\tJudgeData\x12+\n" +
+	"\bsolution\x18\x01 \x01(\v2\x0f.umpire.PayloadR\bsolution\x12#\n" +
+	"\x02io\x18\x02 \x03(\v2\x13.umpire.InputOutputR\x02io\"\xa7\x02\n" +
+	"\x05Event\x12#\n" +
+	"\rsubmission_id\x18\x01 \x01(\tR\fsubmissionId\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x1a\n" +
+	"\btestcase\x18\x03 \x01(\x05R\btestcase\x12\x1c\n" +
+	"\ttestcases\x18\x04 \x01(\x05R\ttestcases\x12(\n" +
+	"\averdict\x18\x05 \x01(\x0e2\x0e.umpire.StatusR\averdict\x12\x18\n" +
+	"\adetails\x18\x06 \x01(\tR\adetails\x12\x17\n" +
+	"\atime_ms\x18\a \x01(\x03R\x06timeMs\x12(\n" +
+	"\x06result\x18\b \x01(\v2\x10.umpire.ResponseR\x06result\x12$\n" +
+	"\x0etime_unix_nano\x18\t \x01(\x03R\ftimeUnixNano*4\n" +
+	"\x06Status\x12\x16\n" +
+	"\x12STATUS_UNSPECIFIED\x10\x00\x12\b\n" +
+	"\x04PASS\x10\x01\x12\b\n" +
+	"\x04FAIL\x10\x022\xf0\x01\n" +
+	"\x06Umpire\x12*\n" +
+	"\x05Judge\x12\x0f.umpire.Payload\x1a\x10.umpire.Response\x121\n" +
+	"\rJudgeProgress\x12\x0f.umpire.Payload\x1a\r.umpire.Event0\x01\x12(\n" +
+	"\x03Run\x12\x0f.umpire.Payload\x1a\x10.umpire.Response\x12,\n" +
+	"\aExecute\x12\x0f.umpire.Payload\x1a\x10.umpire.Response\x12/\n" +
+	"\bValidate\x12\x11.umpire.JudgeData\x1a\x10.umpire.ResponseB,Z*github.com/maddyonline/umpire/pkg/umpirepbb\x06proto3"
+
+var (
+	file_umpire_proto_rawDescOnce sync.Once
+	file_umpire_proto_rawDescData []byte
+)
+
+func file_umpire_proto_rawDescGZIP() []byte {
+	file_umpire_proto_rawDescOnce.Do(func() {
+		file_umpire_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_umpire_proto_rawDesc), len(file_umpire_proto_rawDesc)))
+	})
+	return file_umpire_proto_rawDescData
+}
+
+var file_umpire_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_umpire_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_umpire_proto_goTypes = []any{
+	(Status)(0),         // 0: umpire.Status
+	(*File)(nil),        // 1: umpire.File
+	(*Payload)(nil),     // 2: umpire.Payload
+	(*Response)(nil),    // 3: umpire.Response
+	(*DiffRow)(nil),     // 4: umpire.DiffRow
+	(*InputOutput)(nil), // 5: umpire.InputOutput
+	(*JudgeData)(nil),   // 6: umpire.JudgeData
+	(*Event)(nil),       // 7: umpire.Event
+}
+var file_umpire_proto_depIdxs = []int32{
+	1,  // 0: umpire.Payload.files:type_name -> umpire.File
+	0,  // 1: umpire.Response.status:type_name -> umpire.Status
+	4,  // 2: umpire.Response.diff:type_name -> umpire.DiffRow
+	2,  // 3: umpire.JudgeData.solution:type_name -> umpire.Payload
+	5,  // 4: umpire.JudgeData.io:type_name -> umpire.InputOutput
+	0,  // 5: umpire.Event.verdict:type_name -> umpire.Status
+	3,  // 6: umpire.Event.result:type_name -> umpire.Response
+	2,  // 7: umpire.Umpire.Judge:input_type -> umpire.Payload
+	2,  // 8: umpire.Umpire.JudgeProgress:input_type -> umpire.Payload
+	2,  // 9: umpire.Umpire.Run:input_type -> umpire.Payload
+	2,  // 10: umpire.Umpire.Execute:input_type -> umpire.Payload
+	6,  // 11: umpire.Umpire.Validate:input_type -> umpire.JudgeData
+	3,  // 12: umpire.Umpire.Judge:output_type -> umpire.Response
+	7,  // 13: umpire.Umpire.JudgeProgress:output_type -> umpire.Event
+	3,  // 14: umpire.Umpire.Run:output_type -> umpire.Response
+	3,  // 15: umpire.Umpire.Execute:output_type -> umpire.Response
+	3,  // 16: umpire.Umpire.Validate:output_type -> umpire.Response
+	12, // [12:17] is the sub-list for method output_type
+	7,  // [7:12] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_umpire_proto_init() }
+func file_umpire_proto_init() {
+	if File_umpire_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_umpire_proto_rawDesc), len(file_umpire_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_umpire_proto_goTypes,
+		DependencyIndexes: file_umpire_proto_depIdxs,
+		EnumInfos:         file_umpire_proto_enumTypes,
+		MessageInfos:      file_umpire_proto_msgTypes,
+	}.Build()
+	File_umpire_proto = out.File
+	file_umpire_proto_goTypes = nil
+	file_umpire_proto_depIdxs = nil
+}
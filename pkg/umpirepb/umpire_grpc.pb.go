@@ -0,0 +1,293 @@
+// The gRPC API of umpire-server. It mirrors the HTTP API: Judge, Run,
+// Execute and Validate take the same payloads as /judge, /run, /execute and
+// /validate. Judge waits for the queued judgement to finish; JudgeProgress
+// streams its events as they happen, ending with the result.
+//
+// Regenerate the Go code after changing this file with
+//   protoc --go_out=paths=source_relative:. --go-grpc_out=paths=source_relative:. umpire.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v3.21.12
+// source: umpire.proto
+
+package umpirepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Umpire_Judge_FullMethodName         = "/umpire.Umpire/Judge"
+	Umpire_JudgeProgress_FullMethodName = "/umpire.Umpire/JudgeProgress"
+	Umpire_Run_FullMethodName           = "/umpire.Umpire/Run"
+	Umpire_Execute_FullMethodName       = "/umpire.Umpire/Execute"
+	Umpire_Validate_FullMethodName      = "/umpire.Umpire/Validate"
+)
+
+// UmpireClient is the client API for Umpire service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type UmpireClient interface {
+	Judge(ctx context.Context, in *Payload, opts ...grpc.CallOption) (*Response, error)
+	JudgeProgress(ctx context.Context, in *Payload, opts ...grpc.CallOption) (Umpire_JudgeProgressClient, error)
+	Run(ctx context.Context, in *Payload, opts ...grpc.CallOption) (*Response, error)
+	Execute(ctx context.Context, in *Payload, opts ...grpc.CallOption) (*Response, error)
+	Validate(ctx context.Context, in *JudgeData, opts ...grpc.CallOption) (*Response, error)
+}
+
+type umpireClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUmpireClient(cc grpc.ClientConnInterface) UmpireClient {
+	return &umpireClient{cc}
+}
+
+func (c *umpireClient) Judge(ctx context.Context, in *Payload, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, Umpire_Judge_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *umpireClient) JudgeProgress(ctx context.Context, in *Payload, opts ...grpc.CallOption) (Umpire_JudgeProgressClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Umpire_ServiceDesc.Streams[0], Umpire_JudgeProgress_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &umpireJudgeProgressClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Umpire_JudgeProgressClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type umpireJudgeProgressClient struct {
+	grpc.ClientStream
+}
+
+func (x *umpireJudgeProgressClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *umpireClient) Run(ctx context.Context, in *Payload, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, Umpire_Run_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *umpireClient) Execute(ctx context.Context, in *Payload, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, Umpire_Execute_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *umpireClient) Validate(ctx context.Context, in *JudgeData, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, Umpire_Validate_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UmpireServer is the server API for Umpire service.
+// All implementations must embed UnimplementedUmpireServer
+// for forward compatibility
+type UmpireServer interface {
+	Judge(context.Context, *Payload) (*Response, error)
+	JudgeProgress(*Payload, Umpire_JudgeProgressServer) error
+	Run(context.Context, *Payload) (*Response, error)
+	Execute(context.Context, *Payload) (*Response, error)
+	Validate(context.Context, *JudgeData) (*Response, error)
+	mustEmbedUnimplementedUmpireServer()
+}
+
+// UnimplementedUmpireServer must be embedded to have forward compatible implementations.
+type UnimplementedUmpireServer struct {
+}
+
+func (UnimplementedUmpireServer) Judge(context.Context, *Payload) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Judge not implemented")
+}
+func (UnimplementedUmpireServer) JudgeProgress(*Payload, Umpire_JudgeProgressServer) error {
+	return status.Errorf(codes.Unimplemented, "method JudgeProgress not implemented")
+}
+func (UnimplementedUmpireServer) Run(context.Context, *Payload) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Run not implemented")
+}
+func (UnimplementedUmpireServer) Execute(context.Context, *Payload) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Execute not implemented")
+}
+func (UnimplementedUmpireServer) Validate(context.Context, *JudgeData) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Validate not implemented")
+}
+func (UnimplementedUmpireServer) mustEmbedUnimplementedUmpireServer() {}
+
+// UnsafeUmpireServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UmpireServer will
+// result in compilation errors.
+type UnsafeUmpireServer interface {
+	mustEmbedUnimplementedUmpireServer()
+}
+
+func RegisterUmpireServer(s grpc.ServiceRegistrar, srv UmpireServer) {
+	s.RegisterService(&Umpire_ServiceDesc, srv)
+}
+
+func _Umpire_Judge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Payload)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UmpireServer).Judge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Umpire_Judge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UmpireServer).Judge(ctx, req.(*Payload))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Umpire_JudgeProgress_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Payload)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UmpireServer).JudgeProgress(m, &umpireJudgeProgressServer{stream})
+}
+
+type Umpire_JudgeProgressServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type umpireJudgeProgressServer struct {
+	grpc.ServerStream
+}
+
+func (x *umpireJudgeProgressServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Umpire_Run_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Payload)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UmpireServer).Run(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Umpire_Run_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UmpireServer).Run(ctx, req.(*Payload))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Umpire_Execute_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Payload)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UmpireServer).Execute(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Umpire_Execute_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UmpireServer).Execute(ctx, req.(*Payload))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Umpire_Validate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JudgeData)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UmpireServer).Validate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Umpire_Validate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UmpireServer).Validate(ctx, req.(*JudgeData))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Umpire_ServiceDesc is the grpc.ServiceDesc for Umpire service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Umpire_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "umpire.Umpire",
+	HandlerType: (*UmpireServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Judge",
+			Handler:    _Umpire_Judge_Handler,
+		},
+		{
+			MethodName: "Run",
+			Handler:    _Umpire_Run_Handler,
+		},
+		{
+			MethodName: "Execute",
+			Handler:    _Umpire_Execute_Handler,
+		},
+		{
+			MethodName: "Validate",
+			Handler:    _Umpire_Validate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "JudgeProgress",
+			Handler:       _Umpire_JudgeProgress_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "umpire.proto",
+}
@@ -0,0 +1,264 @@
+package webhooks
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	bolt "go.etcd.io/bbolt"
+	"sync"
+	"time"
+)
+
+// Pending is a delivery that has not been made yet.
+type Pending struct {
+	// Seq orders deliveries; Push sets it.
+	Seq          uint64  `json:"seq"`
+	Id           string  `json:"id"`
+	SubmissionId string  `json:"submission_id"`
+	Target       *Target `json:"target"`
+	Body         []byte  `json:"body"`
+	// Attempts is how many attempts failed so far, Next when to try again.
+	Attempts int       `json:"attempts"`
+	Next     time.Time `json:"next"`
+}
+
+// Store keeps the deliveries not made yet and the log of attempts, so
+// neither is lost when the server restarts. Implementations must be safe
+// for concurrent use.
+type Store interface {
+	// Push stores a new pending delivery and sets its Seq.
+	Push(p *Pending) error
+	// Update stores the attempts of a pending delivery.
+	Update(p *Pending) error
+	Remove(seq uint64) error
+	// Pending lists the deliveries not made yet, in the order they were
+	// pushed.
+	Pending() ([]*Pending, error)
+	// Record logs an attempt; the log keeps the last LOG_SIZE.
+	Record(delivery *Delivery) error
+	// Deliveries returns the logged attempts for a submission, oldest
+	// first.
+	Deliveries(submissionId string) ([]*Delivery, error)
+	Close() error
+}
+
+// MemoryStore keeps deliveries in memory; they are lost when the process
+// exits.
+type MemoryStore struct {
+	mu      sync.Mutex
+	seq     uint64
+	pending []*Pending
+	log     []*Delivery
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Push(p *Pending) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	p.Seq = s.seq
+	stored := *p
+	s.pending = append(s.pending, &stored)
+	return nil
+}
+
+func (s *MemoryStore) Update(p *Pending) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, stored := range s.pending {
+		if stored.Seq == p.Seq {
+			updated := *p
+			s.pending[i] = &updated
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Remove(seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, stored := range s.pending {
+		if stored.Seq == seq {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Pending() ([]*Pending, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []*Pending{}
+	for _, stored := range s.pending {
+		p := *stored
+		out = append(out, &p)
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) Record(delivery *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = append(s.log, delivery)
+	if len(s.log) > LOG_SIZE {
+		s.log = s.log[len(s.log)-LOG_SIZE:]
+	}
+	return nil
+}
+
+func (s *MemoryStore) Deliveries(submissionId string) ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []*Delivery{}
+	for _, delivery := range s.log {
+		if delivery.SubmissionId == submissionId {
+			out = append(out, delivery)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+var (
+	pendingBucket = []byte("pending")
+	logBucket     = []byte("log")
+)
+
+// BoltStore keeps deliveries in a bolt database file so they survive
+// restarts.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{pendingBucket, logBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db}, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+func (s *BoltStore) Push(p *Pending) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(pendingBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		p.Seq = seq
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		return b.Put(seqKey(seq), data)
+	})
+}
+
+func (s *BoltStore) Update(p *Pending) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(pendingBucket)
+		if b.Get(seqKey(p.Seq)) == nil {
+			return nil
+		}
+		return b.Put(seqKey(p.Seq), data)
+	})
+}
+
+func (s *BoltStore) Remove(seq uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).Delete(seqKey(seq))
+	})
+}
+
+func (s *BoltStore) Pending() ([]*Pending, error) {
+	out := []*Pending{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).ForEach(func(k, v []byte) error {
+			p := &Pending{}
+			if err := json.Unmarshal(v, p); err != nil {
+				return err
+			}
+			out = append(out, p)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *BoltStore) Record(delivery *Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(logBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := b.Put(seqKey(seq), data); err != nil {
+			return err
+		}
+		// Sequences only grow, so dropping the one LOG_SIZE back keeps
+		// the log at LOG_SIZE attempts.
+		if seq > LOG_SIZE {
+			return b.Delete(seqKey(seq - LOG_SIZE))
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) Deliveries(submissionId string) ([]*Delivery, error) {
+	out := []*Delivery{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(logBucket).ForEach(func(k, v []byte) error {
+			delivery := &Delivery{}
+			if err := json.Unmarshal(v, delivery); err != nil {
+				return err
+			}
+			if delivery.SubmissionId == submissionId {
+				out = append(out, delivery)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
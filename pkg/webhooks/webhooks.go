@@ -0,0 +1,389 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/labstack/gommon/log"
+	"github.com/maddyonline/umpire"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Headers sent with every delivery. SIGNATURE_HEADER is only set when the
+// target has a secret and holds "sha256=" followed by the hex HMAC-SHA256 of
+// the request body keyed with that secret.
+const (
+	SIGNATURE_HEADER  = "X-Umpire-Signature"
+	DELIVERY_HEADER   = "X-Umpire-Delivery"
+	SUBMISSION_HEADER = "X-Umpire-Submission"
+)
+
+const LOG_SIZE = 1000
+
+// Target is one consumer of a judge result.
+type Target struct {
+	// Name says which consumer this is, e.g. "callback" or "serverdb".
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	// Internal targets are consumers the server is configured with, like
+	// serverdb, rather than URLs from callers. They are reached with
+	// InternalClient, get their deliveries one at a time in the order they
+	// were made, and have them retried until they succeed or are refused:
+	// a failing delivery holds back the later ones to the same Name.
+	Internal bool `json:"internal,omitempty"`
+}
+
+// Delivery records one attempt to POST a result to a target.
+type Delivery struct {
+	Id           string    `json:"id"`
+	SubmissionId string    `json:"submission_id"`
+	Target       string    `json:"target"`
+	URL          string    `json:"url"`
+	Attempt      int       `json:"attempt"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	Delivered    bool      `json:"delivered"`
+	Time         time.Time `json:"time"`
+}
+
+// Sign returns the value of SIGNATURE_HEADER for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a SIGNATURE_HEADER value against body, for receivers.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Dispatcher POSTs results to their targets in the background, retrying
+// failed deliveries with exponential backoff. Deliveries not made yet and
+// the log of the last LOG_SIZE attempts are kept in a Store, so with a
+// durable one a restart loses neither.
+type Dispatcher struct {
+	// Client reaches callers' URLs, InternalClient internal targets.
+	Client         *http.Client
+	InternalClient *http.Client
+	// MaxAttempts is how often a delivery to a caller's URL is tried
+	// before giving up.
+	MaxAttempts int
+	// Backoff is the wait after the first failed attempt. It doubles after
+	// every further failure, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	store   Store
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+
+	mu       sync.Mutex
+	pending  []*Pending
+	inflight map[uint64]bool
+	timer    *time.Timer
+	// changed is signalled whenever an attempt ends, for Close.
+	changed *sync.Cond
+	closed  bool
+}
+
+var ErrClosed = errors.New("webhooks: dispatcher closed")
+
+// ErrForbiddenAddress is returned for deliveries to an address that is not
+// publicly routable.
+var ErrForbiddenAddress = errors.New("webhooks: refusing to connect to a loopback, link-local or private address")
+
+// CheckIP returns ErrForbiddenAddress unless ip is publicly routable, so
+// callbacks cannot reach the server itself, cloud metadata endpoints such as
+// 169.254.169.254 or hosts on the internal network.
+func CheckIP(ip net.IP) error {
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() || ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// checkDial runs after the host has been resolved, right before connecting,
+// so a name that resolves to a public address when the callback is accepted
+// and to a private one later is still refused.
+func checkDial(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	return CheckIP(net.ParseIP(host))
+}
+
+// NewClient returns the HTTP client used for deliveries. It only connects to
+// publicly routable addresses, including after redirects, and ignores
+// HTTP_PROXY since a proxy would make the connection on its behalf.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: checkDial}
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// NewDispatcher starts making the deliveries pending in store, the ones
+// left over from an earlier run included, with client.
+func NewDispatcher(store Store, client *http.Client, maxAttempts int, backoff time.Duration) (*Dispatcher, error) {
+	pending, err := store.Pending()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		Client:         client,
+		InternalClient: &http.Client{Timeout: 30 * time.Second},
+		MaxAttempts:    maxAttempts,
+		Backoff:        backoff,
+		MaxBackoff:     10 * time.Minute,
+		store:          store,
+		ctx:            ctx,
+		cancel:         cancel,
+		pending:        pending,
+		inflight:       map[uint64]bool{},
+	}
+	d.changed = sync.NewCond(&d.mu)
+	if len(pending) > 0 {
+		log.Infof("Resuming %d result deliveries", len(pending))
+	}
+	d.mu.Lock()
+	d.dispatch()
+	d.mu.Unlock()
+	return d, nil
+}
+
+// Deliver stores a delivery of body to target and makes it in the
+// background.
+func (d *Dispatcher) Deliver(target *Target, submissionId string, body []byte) error {
+	p := &Pending{
+		Id:           umpire.RandStringRunes(16),
+		SubmissionId: submissionId,
+		Target:       target,
+		Body:         body,
+		Next:         time.Now().UTC(),
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	if err := d.store.Push(p); err != nil {
+		return err
+	}
+	d.pending = append(d.pending, p)
+	d.dispatch()
+	return nil
+}
+
+// dispatch starts the attempts that are due and sets the timer for the
+// next one. d.mu must be held.
+func (d *Dispatcher) dispatch() {
+	if d.closed {
+		return
+	}
+	now := time.Now()
+	var next time.Time
+	held := map[string]bool{}
+	for _, p := range d.pending {
+		if heldBack(p, held) || d.inflight[p.Seq] {
+			continue
+		}
+		if p.Next.After(now) {
+			if next.IsZero() || p.Next.Before(next) {
+				next = p.Next
+			}
+			continue
+		}
+		d.inflight[p.Seq] = true
+		d.running.Add(1)
+		go d.attempt(p)
+	}
+	if next.IsZero() {
+		return
+	}
+	if d.timer == nil {
+		d.timer = time.AfterFunc(next.Sub(now), func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.dispatch()
+		})
+	} else {
+		d.timer.Reset(next.Sub(now))
+	}
+}
+
+// heldBack reports whether p has to wait for an earlier delivery to the
+// same internal target, recording in held the targets that have one.
+func heldBack(p *Pending, held map[string]bool) bool {
+	if !p.Target.Internal {
+		return false
+	}
+	if held[p.Target.Name] {
+		return true
+	}
+	held[p.Target.Name] = true
+	return false
+}
+
+// attempt makes one attempt at p, then gives up on it, forgets it once
+// delivered or schedules the next attempt.
+func (d *Dispatcher) attempt(p *Pending) {
+	defer d.running.Done()
+	delivery := &Delivery{
+		Id:           p.Id,
+		SubmissionId: p.SubmissionId,
+		Target:       p.Target.Name,
+		URL:          p.Target.URL,
+		Attempt:      p.Attempts + 1,
+		Time:         time.Now().UTC(),
+	}
+	retry := d.post(p.Target, delivery, p.Body)
+	if err := d.store.Record(delivery); err != nil {
+		log.Warnf("Failed to log delivery of submission %s: %v", p.SubmissionId, err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.changed.Broadcast()
+	delete(d.inflight, p.Seq)
+	switch {
+	case delivery.Delivered:
+		log.Infof("Delivered submission %s to %s %s", p.SubmissionId, p.Target.Name, p.Target.URL)
+		d.remove(p)
+	case d.ctx.Err() != nil:
+		// Cut short by Close; the attempt is made again after restart.
+		log.Warnf("Delivery of submission %s to %s %s interrupted, it will resume after restart", p.SubmissionId, p.Target.Name, p.Target.URL)
+	case !retry || !p.Target.Internal && delivery.Attempt >= d.MaxAttempts:
+		log.Warnf("Delivery of submission %s to %s %s failed (attempt %d), giving up: %s", p.SubmissionId, p.Target.Name, p.Target.URL, delivery.Attempt, delivery.Error)
+		d.remove(p)
+	default:
+		log.Warnf("Delivery of submission %s to %s %s failed (attempt %d): %s", p.SubmissionId, p.Target.Name, p.Target.URL, delivery.Attempt, delivery.Error)
+		p.Attempts = delivery.Attempt
+		p.Next = time.Now().UTC().Add(d.backoff(p.Attempts))
+		if err := d.store.Update(p); err != nil {
+			log.Warnf("Failed to store delivery of submission %s: %v", p.SubmissionId, err)
+		}
+	}
+	d.dispatch()
+}
+
+// backoff is the wait after the given number of failed attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	backoff := d.Backoff
+	for i := 1; i < attempts && backoff < d.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > d.MaxBackoff {
+		backoff = d.MaxBackoff
+	}
+	return backoff
+}
+
+// remove forgets p. d.mu must be held.
+func (d *Dispatcher) remove(p *Pending) {
+	for i, pending := range d.pending {
+		if pending == p {
+			d.pending = append(d.pending[:i], d.pending[i+1:]...)
+			break
+		}
+	}
+	if err := d.store.Remove(p.Seq); err != nil {
+		log.Warnf("Failed to remove delivery of submission %s: %v", p.SubmissionId, err)
+	}
+}
+
+// post makes one attempt and reports whether a failure is worth retrying.
+func (d *Dispatcher) post(target *Target, delivery *Delivery, body []byte) bool {
+	req, err := http.NewRequest("POST", target.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return false
+	}
+	req.Header.Add("content-type", "application/json")
+	req.Header.Add(DELIVERY_HEADER, delivery.Id)
+	req.Header.Add(SUBMISSION_HEADER, delivery.SubmissionId)
+	if target.Secret != "" {
+		req.Header.Add(SIGNATURE_HEADER, Sign(target.Secret, body))
+	}
+	client := d.Client
+	if target.Internal {
+		client = d.InternalClient
+	}
+	res, err := client.Do(req.WithContext(d.ctx))
+	if err != nil {
+		delivery.Error = err.Error()
+		return true
+	}
+	res.Body.Close()
+	delivery.StatusCode = res.StatusCode
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		delivery.Delivered = true
+		return false
+	}
+	delivery.Error = fmt.Sprintf("unexpected status %s", res.Status)
+	return res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusRequestTimeout
+}
+
+// Deliveries returns the logged attempts for a submission, oldest first.
+func (d *Dispatcher) Deliveries(submissionId string) ([]*Delivery, error) {
+	return d.store.Deliveries(submissionId)
+}
+
+// busy reports whether an attempt is under way or due before deadline.
+// d.mu must be held.
+func (d *Dispatcher) busy(deadline time.Time) bool {
+	if len(d.inflight) > 0 {
+		return true
+	}
+	held := map[string]bool{}
+	for _, p := range d.pending {
+		if !heldBack(p, held) && p.Next.Before(deadline) {
+			return true
+		}
+	}
+	return false
+}
+
+// Close waits up to timeout for the attempts under way or due by then, and
+// cuts short the ones still running after it. Deliveries not made stay in
+// the store for the next start. It reports whether nothing was left due.
+func (d *Dispatcher) Close(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	wake := time.AfterFunc(timeout, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.changed.Broadcast()
+	})
+	defer wake.Stop()
+	d.mu.Lock()
+	for d.busy(deadline) && time.Now().Before(deadline) {
+		d.changed.Wait()
+	}
+	done := !d.busy(deadline)
+	d.closed = true
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.mu.Unlock()
+	d.cancel()
+	d.running.Wait()
+	return done
+}
@@ -0,0 +1,176 @@
+package webhooks
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"status":"pass"}`)
+	sig := Sign("s3cret", body)
+	if !Verify("s3cret", body, sig) {
+		t.Errorf("Verify rejected its own signature %s", sig)
+	}
+	if Verify("other", body, sig) || Verify("s3cret", []byte(`{}`), sig) {
+		t.Errorf("Verify accepted a wrong secret or body")
+	}
+}
+
+func TestDeliverRetriesUntilSuccess(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !Verify("key", body, r.Header.Get(SIGNATURE_HEADER)) {
+			t.Errorf("bad signature %q", r.Header.Get(SIGNATURE_HEADER))
+		}
+		if r.Header.Get(SUBMISSION_HEADER) != "sub1" {
+			t.Errorf("unexpected submission header %q", r.Header.Get(SUBMISSION_HEADER))
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+	// httptest listens on loopback, which NewClient refuses.
+	d, err := NewDispatcher(NewMemoryStore(), &http.Client{}, 5, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Deliver(&Target{Name: "callback", URL: ts.URL, Secret: "key"}, "sub1", []byte(`{"id":"sub1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Close(5 * time.Second) {
+		t.Fatalf("delivery did not finish")
+	}
+	log, err := d.Deliveries("sub1")
+	if err != nil || len(log) != 3 {
+		t.Fatalf("expected 3 logged attempts, got %d", len(log))
+	}
+	if log[0].StatusCode != http.StatusBadGateway || log[0].Delivered || !log[2].Delivered || log[2].Attempt != 3 {
+		t.Errorf("unexpected delivery log: %+v %+v %+v", log[0], log[1], log[2])
+	}
+}
+
+func TestDeliverGivesUpOnClientError(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	// httptest listens on loopback, which NewClient refuses.
+	d, err := NewDispatcher(NewMemoryStore(), &http.Client{}, 5, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Deliver(&Target{Name: "callback", URL: ts.URL}, "sub2", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	d.Close(5 * time.Second)
+	if calls != 1 {
+		t.Errorf("expected a single attempt, got %d", calls)
+	}
+	if log, err := d.Deliveries("sub2"); err != nil || len(log) != 1 || log[0].Error == "" {
+		t.Errorf("unexpected delivery log: %+v", log)
+	}
+}
+
+func TestDeliveriesSurviveRestart(t *testing.T) {
+	var up int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&up) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "webhooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewBoltStore(filepath.Join(dir, "deliveries.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDispatcher(store, &http.Client{}, 5, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Deliver(&Target{Name: "callback", URL: ts.URL}, "sub3", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	d.Close(5 * time.Second)
+	pending, err := store.Pending()
+	if err != nil || len(pending) != 1 || pending[0].Attempts != 1 {
+		t.Fatalf("Pending: got %+v, %v, expected the failed delivery", pending, err)
+	}
+	// Rather than wait the hour, make the retry due now.
+	pending[0].Next = time.Now()
+	if err := store.Update(pending[0]); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	atomic.StoreInt32(&up, 1)
+	store, err = NewBoltStore(filepath.Join(dir, "deliveries.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	d, err = NewDispatcher(store, &http.Client{}, 5, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Close(5 * time.Second) {
+		t.Fatalf("delivery did not finish")
+	}
+	log, err := d.Deliveries("sub3")
+	if err != nil || len(log) != 2 || log[0].Delivered || !log[1].Delivered || log[1].Attempt != 2 {
+		t.Errorf("unexpected delivery log: %+v, %v", log, err)
+	}
+	if pending, err := store.Pending(); err != nil || len(pending) != 0 {
+		t.Errorf("Pending: got %+v, %v, expected nothing left", pending, err)
+	}
+}
+
+func TestCheckIP(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "::1", "169.254.169.254", "10.1.2.3", "172.16.0.1", "192.168.1.1", "fd00::1", "fe80::1", "0.0.0.0", "::ffff:127.0.0.1"} {
+		if CheckIP(net.ParseIP(addr)) != ErrForbiddenAddress {
+			t.Errorf("expected %s to be refused", addr)
+		}
+	}
+	for _, addr := range []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"} {
+		if err := CheckIP(net.ParseIP(addr)); err != nil {
+			t.Errorf("expected %s to be allowed, got %v", addr, err)
+		}
+	}
+}
+
+func TestDeliverRefusesLoopback(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer ts.Close()
+	d, err := NewDispatcher(NewMemoryStore(), NewClient(), 1, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Deliver(&Target{Name: "callback", URL: ts.URL}, "sub4", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	d.Close(5 * time.Second)
+	if calls != 0 {
+		t.Errorf("expected no request to reach the loopback server, got %d", calls)
+	}
+	if log, err := d.Deliveries("sub4"); err != nil || len(log) != 1 || log[0].Delivered || log[0].Error == "" {
+		t.Errorf("unexpected delivery log: %+v", log)
+	}
+}
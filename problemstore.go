@@ -0,0 +1,125 @@
+package umpire
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ProblemSnapshot is one version of the problems an Agent judges against.
+// Snapshots are never modified once published, so they can be read without
+// locking while newer versions are installed.
+type ProblemSnapshot struct {
+	Version  uint64
+	problems map[string]*JudgeData
+}
+
+// Get returns the problem with id, or nil.
+func (s *ProblemSnapshot) Get(id string) *JudgeData {
+	return s.problems[id]
+}
+
+func (s *ProblemSnapshot) Len() int {
+	return len(s.problems)
+}
+
+// VersionOf is the snapshot's version if it holds the problem with id, and
+// zero otherwise: problems read from an agent's ProblemsDir when judging
+// are not versioned, as their files can change at any time.
+func (s *ProblemSnapshot) VersionOf(id string) uint64 {
+	if s.problems[id] == nil {
+		return 0
+	}
+	return s.Version
+}
+
+// Problems returns a copy of the snapshot's problem map.
+func (s *ProblemSnapshot) Problems() map[string]*JudgeData {
+	m := make(map[string]*JudgeData, len(s.problems))
+	for k, v := range s.problems {
+		m[k] = v
+	}
+	return m
+}
+
+// with returns an unpublished snapshot that also holds jd as id.
+func (s *ProblemSnapshot) with(id string, jd *JudgeData) *ProblemSnapshot {
+	m := s.Problems()
+	m[id] = jd
+	return &ProblemSnapshot{Version: s.Version, problems: m}
+}
+
+// ProblemStore holds the problems of an Agent. Every change publishes a new
+// snapshot with a higher version; readers take a snapshot and keep using it
+// for as long as they need a consistent view. Implementations must be safe
+// for concurrent use.
+type ProblemStore interface {
+	Snapshot() *ProblemSnapshot
+	// Replace installs problems as the new set and returns its version.
+	Replace(problems map[string]*JudgeData) uint64
+	Put(id string, jd *JudgeData) uint64
+	Delete(id string) uint64
+}
+
+// MemoryProblemStore is a copy-on-write ProblemStore.
+type MemoryProblemStore struct {
+	mu      sync.Mutex // serializes writers
+	current atomic.Value
+}
+
+// NewProblemStore returns a store holding a copy of problems as version 1.
+func NewProblemStore(problems map[string]*JudgeData) *MemoryProblemStore {
+	s := &MemoryProblemStore{}
+	m := make(map[string]*JudgeData, len(problems))
+	for k, v := range problems {
+		m[k] = v
+	}
+	s.current.Store(&ProblemSnapshot{Version: 1, problems: m})
+	return s
+}
+
+func (s *MemoryProblemStore) Snapshot() *ProblemSnapshot {
+	return s.current.Load().(*ProblemSnapshot)
+}
+
+func (s *MemoryProblemStore) publish(problems map[string]*JudgeData) uint64 {
+	version := s.Snapshot().Version + 1
+	s.current.Store(&ProblemSnapshot{Version: version, problems: problems})
+	return version
+}
+
+func (s *MemoryProblemStore) Replace(problems map[string]*JudgeData) uint64 {
+	m := make(map[string]*JudgeData, len(problems))
+	for k, v := range problems {
+		m[k] = v
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.publish(m)
+}
+
+func (s *MemoryProblemStore) Put(id string, jd *JudgeData) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.Snapshot().Problems()
+	m[id] = jd
+	return s.publish(m)
+}
+
+func (s *MemoryProblemStore) Delete(id string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.Snapshot().Problems()
+	delete(m, id)
+	return s.publish(m)
+}
+
+var emptySnapshot = &ProblemSnapshot{problems: map[string]*JudgeData{}}
+
+// snapshot is the agent's current set of problems; an agent without a store
+// has none.
+func (u *Agent) snapshot() *ProblemSnapshot {
+	if u.Problems == nil {
+		return emptySnapshot
+	}
+	return u.Problems.Snapshot()
+}
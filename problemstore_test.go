@@ -0,0 +1,73 @@
+package umpire
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestProblemStoreVersions(t *testing.T) {
+	store := NewProblemStore(map[string]*JudgeData{"sum": &JudgeData{}})
+	first := store.Snapshot()
+	if first.Version != 1 || first.Get("sum") == nil {
+		t.Fatalf("unexpected first snapshot %+v", first)
+	}
+	if v := store.Put("max", &JudgeData{}); v != 2 {
+		t.Errorf("Put: expected version 2, got %d", v)
+	}
+	if v := store.Delete("sum"); v != 3 {
+		t.Errorf("Delete: expected version 3, got %d", v)
+	}
+	// Older snapshots are unaffected by later changes.
+	if first.Get("sum") == nil || first.Get("max") != nil || first.Len() != 1 {
+		t.Errorf("snapshot changed after being published: %+v", first.Problems())
+	}
+	if v := store.Replace(map[string]*JudgeData{"a": &JudgeData{}, "b": &JudgeData{}}); v != 4 {
+		t.Errorf("Replace: expected version 4, got %d", v)
+	}
+	if last := store.Snapshot(); last.Len() != 2 || last.Get("max") != nil {
+		t.Errorf("unexpected snapshot after Replace: %+v", last.Problems())
+	}
+}
+
+func TestProblemStoreConcurrentUse(t *testing.T) {
+	store := NewProblemStore(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				store.Put(fmt.Sprintf("p%d-%d", i, j), &JudgeData{})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				snap := store.Snapshot()
+				for id := range snap.Problems() {
+					snap.Get(id)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if snap := store.Snapshot(); snap.Len() != 800 || snap.Version != 801 {
+		t.Errorf("expected 800 problems at version 801, got %d at %d", snap.Len(), snap.Version)
+	}
+}
+
+func TestWithDoesNotPublish(t *testing.T) {
+	u := &Agent{Problems: NewProblemStore(nil)}
+	snap := u.snapshot().with("tmp", &JudgeData{})
+	if snap.Get("tmp") == nil || u.Problems.Snapshot().Get("tmp") != nil {
+		t.Errorf("private snapshot leaked into the store")
+	}
+}
+
+func TestVersionOfOnlyCoversStoredProblems(t *testing.T) {
+	snap := NewProblemStore(map[string]*JudgeData{"sum": &JudgeData{}}).Snapshot()
+	if snap.VersionOf("sum") != snap.Version || snap.VersionOf("from-problems-dir") != 0 {
+		t.Errorf("unexpected versions %d and %d", snap.VersionOf("sum"), snap.VersionOf("from-problems-dir"))
+	}
+}
@@ -0,0 +1,42 @@
+package umpire
+
+import (
+	"time"
+)
+
+type EventType string
+
+const (
+	EventQueued           EventType = "queued"
+	EventCompiling        EventType = "compiling"
+	EventTestcaseStarted  EventType = "testcase_started"
+	EventTestcaseFinished EventType = "testcase_finished"
+	EventResult           EventType = "result"
+)
+
+// Event reports the progress of one submission. Testcases are numbered
+// from 1; Verdict and TimeMs are only set when a testcase finishes.
+type Event struct {
+	SubmissionId string    `json:"submission_id"`
+	Type         EventType `json:"type"`
+	Testcase     int       `json:"testcase,omitempty"`
+	Testcases    int       `json:"testcases,omitempty"`
+	Verdict      Decision  `json:"verdict,omitempty"`
+	Details      string    `json:"details,omitempty"`
+	TimeMs       int64     `json:"time_ms,omitempty"`
+	Result       *Response `json:"result,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// ProgressFunc receives the events of every submission an Agent judges.
+// It is called from the judging goroutines and must not block.
+type ProgressFunc func(*Event)
+
+func (u *Agent) emit(payload *Payload, ev *Event) {
+	if u.Progress == nil {
+		return
+	}
+	ev.SubmissionId = payload.SubmissionId
+	ev.Time = time.Now().UTC()
+	u.Progress(ev)
+}
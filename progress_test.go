@@ -0,0 +1,15 @@
+package umpire
+
+import (
+	"testing"
+)
+
+func TestEmitStampsSubmission(t *testing.T) {
+	var got []*Event
+	u := &Agent{Progress: func(ev *Event) { got = append(got, ev) }}
+	u.emit(&Payload{SubmissionId: "abc"}, &Event{Type: EventCompiling})
+	if len(got) != 1 || got[0].SubmissionId != "abc" || got[0].Time.IsZero() {
+		t.Errorf("unexpected events: %#v", got)
+	}
+	(&Agent{}).emit(&Payload{}, &Event{Type: EventCompiling})
+}
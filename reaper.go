@@ -0,0 +1,171 @@
+package umpire
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/labstack/gommon/log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Labels set on every container umpire creates. The reaper only ever looks
+// at containers carrying LABEL_OWNER.
+const (
+	LABEL_OWNER      = "umpire.owner"
+	LABEL_SUBMISSION = "umpire.submission"
+	LABEL_CREATED    = "umpire.created"
+)
+
+// Owner identifies this process as hostname/pid in container labels.
+var Owner = ownerId()
+
+func ownerId() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
+}
+
+func containerLabels(payload *Payload) map[string]string {
+	labels := map[string]string{
+		LABEL_OWNER:   Owner,
+		LABEL_CREATED: strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	if payload != nil && payload.SubmissionId != "" {
+		labels[LABEL_SUBMISSION] = payload.SubmissionId
+	}
+	return labels
+}
+
+// ownerAlive reports whether the process that created a container may still
+// be running. Owners on other hosts are assumed to be alive.
+func ownerAlive(owner string) bool {
+	if owner == Owner {
+		return true
+	}
+	i := strings.LastIndex(owner, "/")
+	if i < 0 {
+		return false
+	}
+	hostname, _ := os.Hostname()
+	if owner[:i] != hostname {
+		return true
+	}
+	pid, err := strconv.Atoi(owner[i+1:])
+	if err != nil {
+		return false
+	}
+	err = syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// Reaper removes containers leaked by umpire processes: those whose owner
+// process on this host has exited and those older than MaxAge.
+type Reaper struct {
+	Client *client.Client
+	MaxAge time.Duration
+	// All removes every labeled container, whoever owns it.
+	All bool
+	// Owner, when set, limits the reaper to containers created by that
+	// owner, e.g. umpire.Owner for this process.
+	Owner  string
+	DryRun bool
+}
+
+func (r *Reaper) stale(c types.Container, now time.Time) (bool, string) {
+	owner, ok := c.Labels[LABEL_OWNER]
+	if !ok || r.Owner != "" && owner != r.Owner {
+		return false, ""
+	}
+	if r.All {
+		return true, "all labeled containers requested"
+	}
+	if !ownerAlive(owner) {
+		return true, fmt.Sprintf("owner %s is gone", owner)
+	}
+	created, err := strconv.ParseInt(c.Labels[LABEL_CREATED], 10, 64)
+	if err != nil {
+		created = c.Created
+	}
+	if age := now.Sub(time.Unix(created, 0)); r.MaxAge > 0 && age > r.MaxAge {
+		return true, fmt.Sprintf("age %v exceeds %v", age, r.MaxAge)
+	}
+	return false, ""
+}
+
+func ownerFilter(owner string) filters.Args {
+	args := filters.NewArgs()
+	if owner != "" {
+		args.Add("label", LABEL_OWNER+"="+owner)
+	} else {
+		args.Add("label", LABEL_OWNER)
+	}
+	return args
+}
+
+// LabeledContainers lists the containers created by owner, or by any umpire
+// process when owner is empty, stopped ones included.
+func LabeledContainers(ctx context.Context, cli *client.Client, owner string) ([]types.Container, error) {
+	return cli.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: ownerFilter(owner)})
+}
+
+// RunningContainers is LabeledContainers without the containers that are
+// not running.
+func RunningContainers(ctx context.Context, cli *client.Client, owner string) ([]types.Container, error) {
+	args := ownerFilter(owner)
+	args.Add("status", "running")
+	return cli.ContainerList(ctx, types.ContainerListOptions{Filters: args})
+}
+
+// Reap removes stale labeled containers and returns their ids.
+func (r *Reaper) Reap(ctx context.Context) ([]string, error) {
+	containers, err := LabeledContainers(ctx, r.Client, "")
+	if err != nil {
+		return nil, err
+	}
+	removed := []string{}
+	now := time.Now()
+	for _, c := range containers {
+		stale, reason := r.stale(c, now)
+		if !stale {
+			continue
+		}
+		log.Infof("Reaping container %s (submission %s): %s", c.ID, c.Labels[LABEL_SUBMISSION], reason)
+		if !r.DryRun {
+			if err := r.Client.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+				log.Warnf("Failed to remove container %s: %v", c.ID, err)
+				continue
+			}
+		}
+		removed = append(removed, c.ID)
+	}
+	return removed, nil
+}
+
+// Run reaps once straight away and then every interval until ctx is done.
+func (r *Reaper) Run(ctx context.Context, interval time.Duration) {
+	if _, err := r.Reap(ctx); err != nil {
+		log.Warnf("Reaper: %v", err)
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := r.Reap(ctx); err != nil {
+					log.Warnf("Reaper: %v", err)
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,55 @@
+package umpire
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestContainerLabels(t *testing.T) {
+	labels := containerLabels(&Payload{SubmissionId: "abc"})
+	if labels[LABEL_OWNER] != Owner {
+		t.Errorf("owner label: got %q, expected %q", labels[LABEL_OWNER], Owner)
+	}
+	if labels[LABEL_SUBMISSION] != "abc" {
+		t.Errorf("submission label: got %q", labels[LABEL_SUBMISSION])
+	}
+	if _, err := strconv.ParseInt(labels[LABEL_CREATED], 10, 64); err != nil {
+		t.Errorf("created label: %v", err)
+	}
+}
+
+func TestReaperStale(t *testing.T) {
+	hostname, _ := os.Hostname()
+	now := time.Now()
+	labeled := func(owner string, age time.Duration) types.Container {
+		return types.Container{Labels: map[string]string{
+			LABEL_OWNER:   owner,
+			LABEL_CREATED: strconv.FormatInt(now.Add(-age).Unix(), 10),
+		}}
+	}
+	r := &Reaper{MaxAge: 10 * time.Minute}
+	var tests = []struct {
+		name      string
+		container types.Container
+		stale     bool
+	}{
+		{"unlabeled", types.Container{Created: now.Add(-time.Hour).Unix()}, false},
+		{"ours and fresh", labeled(Owner, time.Minute), false},
+		{"ours and old", labeled(Owner, time.Hour), true},
+		{"dead owner", labeled(fmt.Sprintf("%s/%d", hostname, 1<<30), time.Minute), true},
+		{"other host", labeled("elsewhere/1", time.Minute), false},
+	}
+	for _, test := range tests {
+		if stale, reason := r.stale(test.container, now); stale != test.stale {
+			t.Errorf("%s: got stale=%v (%s), expected %v", test.name, stale, reason, test.stale)
+		}
+	}
+	all := &Reaper{All: true}
+	if stale, _ := all.stale(types.Container{}, now); stale {
+		t.Errorf("All must still skip unlabeled containers")
+	}
+}
@@ -0,0 +1,92 @@
+package umpire
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/client"
+	"io/ioutil"
+	"strings"
+)
+
+// Sandbox selects the container runtime (e.g. gVisor's runsc) and the
+// security options (seccomp and AppArmor profiles) judge containers run with.
+// It can be set for the whole deployment through DefaultSandbox, or per
+// language and variant in the language configuration.
+type Sandbox struct {
+	Runtime     string   `json:"runtime,omitempty"`
+	SecurityOpt []string `json:"security_opt,omitempty"`
+}
+
+var DefaultSandbox = &Sandbox{}
+
+// SetDefaultSandbox loads any profile files named by s and makes it the
+// deployment-wide sandbox.
+func SetDefaultSandbox(s *Sandbox) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	DefaultSandbox = s
+	return nil
+}
+
+// load replaces "seccomp=<file>" options with the file's content, which is
+// what the docker API expects.
+func (s *Sandbox) load() error {
+	if s == nil {
+		return nil
+	}
+	for i, opt := range s.SecurityOpt {
+		if !strings.HasPrefix(opt, "seccomp=") {
+			continue
+		}
+		value := strings.TrimPrefix(opt, "seccomp=")
+		if value == "unconfined" || strings.HasPrefix(strings.TrimSpace(value), "{") {
+			continue
+		}
+		profile, err := ioutil.ReadFile(value)
+		if err != nil {
+			return fmt.Errorf("Failed to read seccomp profile: %v", err)
+		}
+		s.SecurityOpt[i] = "seccomp=" + string(profile)
+	}
+	return nil
+}
+
+func configuredSandboxes() []*Sandbox {
+	sandboxes := []*Sandbox{DefaultSandbox}
+	for _, lc := range Languages {
+		if lc.Sandbox != nil {
+			sandboxes = append(sandboxes, lc.Sandbox)
+		}
+		for _, v := range lc.Variants {
+			if v.Sandbox != nil {
+				sandboxes = append(sandboxes, v.Sandbox)
+			}
+		}
+	}
+	return sandboxes
+}
+
+// CheckRuntimes makes sure every runtime the configuration asks for is
+// registered with the docker daemon.
+func CheckRuntimes(ctx context.Context, cli *client.Client) error {
+	info, err := cli.Info(ctx)
+	if err != nil {
+		return err
+	}
+	missing := []string{}
+	seen := map[string]bool{}
+	for _, s := range configuredSandboxes() {
+		if s == nil || s.Runtime == "" || seen[s.Runtime] {
+			continue
+		}
+		seen[s.Runtime] = true
+		if _, ok := info.Runtimes[s.Runtime]; !ok {
+			missing = append(missing, s.Runtime)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Docker host does not have runtime(s) %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package umpire
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSandboxLoadInlinesSeccompProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sandbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	profile := filepath.Join(dir, "profile.json")
+	if err := ioutil.WriteFile(profile, []byte(`{"defaultAction":"SCMP_ACT_ERRNO"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Sandbox{SecurityOpt: []string{"seccomp=" + profile, "apparmor=umpire", "seccomp=unconfined"}}
+	if err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{`seccomp={"defaultAction":"SCMP_ACT_ERRNO"}`, "apparmor=umpire", "seccomp=unconfined"}
+	for i := range expected {
+		if s.SecurityOpt[i] != expected[i] {
+			t.Errorf("SecurityOpt[%d]: got %q, expected %q", i, s.SecurityOpt[i], expected[i])
+		}
+	}
+	if err := (&Sandbox{SecurityOpt: []string{"seccomp=" + filepath.Join(dir, "missing.json")}}).load(); err == nil {
+		t.Errorf("expected error for missing profile")
+	}
+}
+
+func TestShippedSeccompProfileLoads(t *testing.T) {
+	s := &Sandbox{SecurityOpt: []string{"seccomp=setup/seccomp.json"}}
+	if err := s.load(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Judged code may start threads and processes but not new namespaces.
+func TestShippedSeccompProfileRestrictsClone(t *testing.T) {
+	data, err := ioutil.ReadFile("setup/seccomp.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := struct {
+		Syscalls []struct {
+			Names  []string
+			Action string
+			Args   []struct {
+				Index, Value uint64
+				Op           string
+			}
+		}
+	}{}
+	if err := json.Unmarshal(data, &profile); err != nil {
+		t.Fatal(err)
+	}
+	const CLONE_NEW_FLAGS = 0x7e020000
+	for _, rule := range profile.Syscalls {
+		for _, name := range rule.Names {
+			if name != "clone" && name != "clone3" || rule.Action != "SCMP_ACT_ALLOW" {
+				continue
+			}
+			if name == "clone3" || len(rule.Args) != 1 || rule.Args[0].Index != 0 || rule.Args[0].Value != CLONE_NEW_FLAGS || rule.Args[0].Op != "SCMP_CMP_MASKED_EQ" {
+				t.Errorf("%s is allowed without masking out the namespace flags: %+v", name, rule)
+			}
+		}
+	}
+}
+
+func TestResolveLanguageSandbox(t *testing.T) {
+	saved := Languages
+	defer func() { Languages = saved }()
+	Languages = map[string]*LanguageConfig{
+		"cpp": &LanguageConfig{
+			Image:   "phluent/clang",
+			Sandbox: &Sandbox{Runtime: "runsc"},
+			Variants: map[string]*Variant{
+				"plain": &Variant{},
+				"runc":  &Variant{Sandbox: &Sandbox{Runtime: "runc"}},
+			},
+		},
+		"python": &LanguageConfig{Image: "phluent/python"},
+	}
+	var tests = []struct {
+		language, variant, runtime string
+	}{
+		{"cpp", "plain", "runsc"},
+		{"cpp", "runc", "runc"},
+		{"python", "", DefaultSandbox.Runtime},
+	}
+	for _, test := range tests {
+		rc, err := resolveLanguage(test.language, test.variant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rc.hostConfig().Runtime; got != test.runtime {
+			t.Errorf("%s/%s: got runtime %q, expected %q", test.language, test.variant, got, test.runtime)
+		}
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/docker/docker/client"
 	"github.com/labstack/gommon/log"
@@ -19,6 +18,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 type TestCase struct {
@@ -40,7 +40,10 @@ type JudgeData struct {
 type Agent struct {
 	Client      *client.Client
 	ProblemsDir string
-	Data        map[string]*JudgeData
+	// Problems, when set, is consulted before ProblemsDir.
+	Problems ProblemStore
+	// Progress, when set, is told as JudgeAll compiles and runs testcases.
+	Progress ProgressFunc
 }
 
 type Decision string
@@ -53,8 +56,19 @@ const (
 type Response struct {
 	Status  Decision `json:"status"`
 	Details string   `json:"details"`
-	Stdout  string   `json:"stdout", omitempty`
-	Stderr  string   `json:"stderr", omitempty`
+	Variant string   `json:"variant,omitempty"`
+	Image   string   `json:"image,omitempty"`
+	Stdout  string   `json:"stdout,omitempty"`
+	Stderr  string   `json:"stderr,omitempty"`
+	// ProblemVersion is the version of the problem snapshot judged against;
+	// it is not set for problems read from the agent's ProblemsDir.
+	ProblemVersion uint64 `json:"problem_version,omitempty"`
+	// Expected is the reference solution's output and Diff compares it with
+	// Stdout; both are only set by Run. Truncated is set when an output was
+	// cut at RunOutputLimit.
+	Expected  string     `json:"expected,omitempty"`
+	Diff      []*DiffRow `json:"diff,omitempty"`
+	Truncated bool       `json:"truncated,omitempty"`
 }
 
 func createDirectoryWithFiles(files []*InMemoryFile) (*string, error) {
@@ -63,6 +77,10 @@ func createDirectoryWithFiles(files []*InMemoryFile) (*string, error) {
 		return nil, err
 	}
 	for _, file := range files {
+		if err := checkName(ErrCodeInvalidFileName, "name", file.Name); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
 		tmpfn := filepath.Join(dir, file.Name)
 		if err := ioutil.WriteFile(tmpfn, []byte(file.Content), 0666); err != nil {
 			return nil, err
@@ -72,10 +90,10 @@ func createDirectoryWithFiles(files []*InMemoryFile) (*string, error) {
 	return &dir, nil
 }
 
-func (u *Agent) loadTestCases(problemsDir string, payload *Payload) ([]*TestCase, error) {
-	if u.Data != nil && u.Data[payload.Problem.Id] != nil {
+func (u *Agent) loadTestCases(snap *ProblemSnapshot, problemsDir string, payload *Payload) ([]*TestCase, error) {
+	if jd := snap.Get(payload.Problem.Id); jd != nil {
 		testcases := []*TestCase{}
-		for _, io := range u.Data[payload.Problem.Id].IO {
+		for _, io := range jd.IO {
 			testcases = append(testcases, &TestCase{strings.NewReader(io.Input), strings.NewReader(io.Output), payload.Problem.Id})
 		}
 		return testcases, nil
@@ -125,40 +143,57 @@ func (u *Agent) JudgeTestcase(ctx context.Context, payload *Payload, stdout, std
 }
 
 func (u *Agent) UpdateProblemsCache(jd *JudgeData) (string, error) {
-	if u.Data == nil {
-		return "", fmt.Errorf("Agent's data map not initialized")
+	if u.Problems == nil {
+		return "", fmt.Errorf("Agent's problem store not initialized")
 	}
 	key := RandStringRunes(12)
-	u.Data[key] = jd
+	u.Problems.Put(key, jd)
 	return key, nil
 }
 
 func (u *Agent) RemoveFromProblemsCache(key string) {
-	if u.Data == nil {
+	if u.Problems == nil {
 		return
 	}
-	if _, ok := u.Data[key]; ok {
-		delete(u.Data, key)
+	if u.Problems.Snapshot().Get(key) != nil {
+		u.Problems.Delete(key)
 	}
 }
 
 func (u *Agent) JudgeAll(ctx context.Context, payload *Payload, stdout, stderr io.Writer) error {
+	return u.judgeAll(ctx, u.snapshot(), payload, stdout, stderr)
+}
+
+// judgeAll judges payload against the problems of snap only, so that a
+// judgement sees one version of its problem from start to end.
+func (u *Agent) judgeAll(ctx context.Context, snap *ProblemSnapshot, payload *Payload, stdout, stderr io.Writer) error {
 	var wg sync.WaitGroup
 	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	errors := make(chan error)
-	testcases, err := u.loadTestCases(u.ProblemsDir, payload)
+	if err := u.validatePayload(snap, payload, true); err != nil {
+		return err
+	}
+	testcases, err := u.loadTestCases(snap, u.ProblemsDir, payload)
 	if err != nil {
 		return err
 	}
+	u.emit(payload, &Event{Type: EventCompiling, Testcases: len(testcases)})
 	for i, testcase := range testcases {
 		wg.Add(1)
 		go func(ctx context.Context, i int, testcase *TestCase) {
 			defer wg.Done()
+			u.emit(payload, &Event{Type: EventTestcaseStarted, Testcase: i + 1, Testcases: len(testcases)})
+			start := time.Now()
 			err := u.JudgeTestcase(ctx, payload, ioutil.Discard, ioutil.Discard, testcase)
 			log.Printf("testcase %d: %v", i, err)
+			ev := &Event{Type: EventTestcaseFinished, Testcase: i + 1, Testcases: len(testcases), Verdict: Pass}
+			ev.TimeMs = int64(time.Since(start) / time.Millisecond)
 			if err != nil {
 				cancel()
+				ev.Verdict, ev.Details = Fail, err.Error()
 			}
+			u.emit(payload, ev)
 			errors <- err
 		}(ctx, i, testcase)
 	}
@@ -196,80 +231,180 @@ func readFiles(files map[string]io.Reader) ([]*InMemoryFile, error) {
 	return ans, nil
 }
 
+// RunAndJudge runs incoming and the reference solution of its problem on
+// incoming.Stdin, writes what incoming printed to stdout and stderr, and
+// returns why the outputs differ, if they do.
 func (u *Agent) RunAndJudge(ctx context.Context, incoming *Payload, stdout, stderr io.Writer) error {
-	ctx, cancelFunc := context.WithCancel(ctx)
-	if u.Data == nil {
-		return fmt.Errorf("Umpire agent's data not initialized: %v", u.Data)
+	out, err := u.runOutputs(ctx, u.snapshot(), incoming)
+	if err != nil {
+		return err
 	}
-	if u.Data[incoming.Problem.Id] == nil {
-		return fmt.Errorf("Problem Id '%s' not found", incoming.Problem.Id)
+	io.WriteString(stdout, out.got.String())
+	io.WriteString(stderr, out.gotErr.String())
+	return out.verdict()
+}
+
+// runOutputs holds what a run and its reference solution printed.
+type runOutputs struct {
+	got, gotErr, expected *outputCapture
+	rows                  []*DiffRow
+}
+
+// diff is Diff of the kept outputs, computed once.
+func (o *runOutputs) diff() []*DiffRow {
+	if o.rows == nil {
+		o.rows = Diff(o.got.String(), o.expected.String())
 	}
-	log.Info("Found correct solution for problem %s", incoming.Problem.Id)
-	solnPayload := u.Data[incoming.Problem.Id].Solution
+	return o.rows
+}
+
+// runOutputs runs incoming and the reference solution side by side, each to
+// completion: the reference output is compared afterwards, not used to stop
+// the run at the first difference.
+func (u *Agent) runOutputs(ctx context.Context, snap *ProblemSnapshot, incoming *Payload) (*runOutputs, error) {
+	if err := u.validatePayload(snap, incoming, true); err != nil {
+		return nil, err
+	}
+	jd := snap.Get(incoming.Problem.Id)
+	if jd == nil || jd.Solution == nil {
+		return nil, fmt.Errorf("Problem Id '%s' not found", incoming.Problem.Id)
+	}
+	log.Infof("Found correct solution for problem %s", incoming.Problem.Id)
+	// The snapshot is shared with other judgements; run a copy.
+	solnPayload := &Payload{}
+	*solnPayload = *jd.Solution
 	solnPayload.Stdin = incoming.Stdin
 
-	ch := make(chan error)
-	r, w := io.Pipe()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	out := &runOutputs{
+		got:      newOutputCapture(RunOutputLimit),
+		gotErr:   newOutputCapture(RunOutputLimit),
+		expected: newOutputCapture(RunOutputLimit),
+	}
+	solnErr := newOutputCapture(RunOutputLimit)
+	var userRunErr, solnRunErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		// Without the user's output there is nothing to compare.
+		if userRunErr = DockerRun(ctx, u.Client, incoming, out.got, out.gotErr); userRunErr != nil {
+			cancel()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if solnRunErr = DockerRun(ctx, u.Client, solnPayload, out.expected, solnErr); solnRunErr != nil {
+			cancel()
+		}
+	}()
+	wg.Wait()
+	for _, c := range []*outputCapture{out.got, out.gotErr, out.expected, solnErr} {
+		c.close()
+	}
+	log.Info("Done running user and reference solutions")
+	if userRunErr != nil {
+		return nil, userRunErr
+	}
+	if solnRunErr != nil {
+		return nil, fmt.Errorf("reference solution failed: %v", solnRunErr)
+	}
+	if solnErr.String() != "" {
+		return nil, fmt.Errorf("reference solution failed: %s", solnErr)
+	}
+	return out, nil
+}
 
-	testcase := &TestCase{
-		Input:    strings.NewReader(incoming.Stdin),
-		Expected: r,
+// verdict explains why the run fails, if it does: it printed to stderr, or
+// its output differs from the reference solution's.
+func (o *runOutputs) verdict() error {
+	if s := o.gotErr.String(); s != "" {
+		return fmt.Errorf("stderr error: %s", s)
 	}
-	go func(ctx context.Context, payload *Payload, ch chan error) {
-		defer w.Close()
-		var stderr bytes.Buffer
-		err := DockerRun(ctx, u.Client, payload, w, &stderr)
-		if err != nil {
-			ch <- err
-			return
-		}
-		if stderr.String() != "" {
-			ch <- errors.New(stderr.String())
-			return
+	if o.got.sameAs(o.expected) {
+		return nil
+	}
+	for _, row := range o.diff() {
+		got, expected := row.Got, row.Expected
+		switch row.Op {
+		case DiffEqual:
+			continue
+		case DiffMissing:
+			got = MISSING_LINE
+		case DiffExtra:
+			expected = MISSING_LINE
 		}
-		log.Info("Done solving correct solution")
-		ch <- nil
+		return fmt.Errorf("Mismatch Error: got %s, expected %s", got, expected)
+	}
+	return fmt.Errorf("Mismatch Error: outputs differ after their first %d bytes", RunOutputLimit)
+}
 
-	}(ctx, solnPayload, ch)
+// truncated reports whether any output was cut at RunOutputLimit.
+func (o *runOutputs) truncated() bool {
+	return o.got.truncated || o.gotErr.truncated || o.expected.truncated
+}
 
-	go func(ctx context.Context, payload *Payload, ch chan error) {
-		defer r.Close()
-		ch <- u.JudgeTestcase(ctx, payload, stdout, stderr, testcase)
-		log.Info("Done solving user solution")
-	}(ctx, incoming, ch)
+func JudgeDefault(u *Agent, payload *Payload) *Response {
+	return JudgeContext(context.Background(), u, payload)
+}
 
-	err := <-ch
-	if err != nil {
-		cancelFunc()
-		go func() {
-			err := <-ch
-			log.Infof("Btw, second err=%v", err)
-		}()
-		return err
-	}
-	return <-ch
+// JudgeContext is JudgeDefault with a context; cancelling ctx stops the
+// judgement and removes its containers.
+func JudgeContext(ctx context.Context, u *Agent, payload *Payload) *Response {
+	start := time.Now()
+	resp := judge(ctx, u, u.snapshot(), payload)
+	observe("judge", payload, resp, start)
+	return resp
 }
 
-func JudgeDefault(u *Agent, payload *Payload) *Response {
-	err := u.JudgeAll(context.Background(), payload, ioutil.Discard, ioutil.Discard)
+// RejudgeContext is JudgeContext for judging a stored submission again. Its
+// metrics are labelled "rejudge", apart from live judgements.
+func RejudgeContext(ctx context.Context, u *Agent, payload *Payload) *Response {
+	start := time.Now()
+	resp := judge(ctx, u, u.snapshot(), payload)
+	observe("rejudge", payload, resp, start)
+	return resp
+}
+
+func judge(ctx context.Context, u *Agent, snap *ProblemSnapshot, payload *Payload) *Response {
+	err := u.judgeAll(ctx, snap, payload, ioutil.Discard, ioutil.Discard)
+	version := uint64(0)
+	if payload != nil && payload.Problem != nil {
+		version = snap.VersionOf(payload.Problem.Id)
+	}
 	if err != nil {
 		return &Response{
-			Status:  Fail,
-			Details: err.Error(),
+			Status:         Fail,
+			Details:        err.Error(),
+			Variant:        VariantOf(payload),
+			Image:          ImageOf(payload),
+			ProblemVersion: version,
 		}
 	}
 	return &Response{
-		Status: Pass,
+		Status:         Pass,
+		Variant:        VariantOf(payload),
+		Image:          ImageOf(payload),
+		ProblemVersion: version,
 	}
 }
 
 func (u *Agent) Execute(ctx context.Context, incoming *Payload) (*PayloadResult, error) {
+	if err := u.ValidatePayload(incoming, false); err != nil {
+		return nil, err
+	}
 	return payloadRun(ctx, u.Client, incoming)
 }
 
 func ExecuteDefault(u *Agent, payload *Payload) *Response {
-	pr, err := u.Execute(context.Background(), payload)
-	resp := &Response{}
+	return ExecuteContext(context.Background(), u, payload)
+}
+
+func ExecuteContext(ctx context.Context, u *Agent, payload *Payload) *Response {
+	start := time.Now()
+	pr, err := u.Execute(ctx, payload)
+	resp := &Response{Variant: VariantOf(payload), Image: ImageOf(payload)}
 	if err != nil || pr != nil && pr.Stderr != "" {
 		resp.Status = Fail
 	} else {
@@ -282,31 +417,62 @@ func ExecuteDefault(u *Agent, payload *Payload) *Response {
 	if err != nil {
 		resp.Details = err.Error()
 	}
+	observe("execute", payload, resp, start)
 	return resp
 }
 
 func RunDefault(u *Agent, incoming *Payload) *Response {
-	var stdout, stderr bytes.Buffer
-	err := u.RunAndJudge(context.Background(), incoming, &stdout, &stderr)
+	return RunContext(context.Background(), u, incoming)
+}
+
+// RunContext runs incoming against its problem's reference solution on
+// incoming.Stdin. The response holds both outputs, cut at RunOutputLimit,
+// and their side-by-side diff.
+func RunContext(ctx context.Context, u *Agent, incoming *Payload) *Response {
+	start := time.Now()
+	snap := u.snapshot()
+	out, err := u.runOutputs(ctx, snap, incoming)
+	resp := &Response{Status: Pass, Details: "Output is as expected", Variant: VariantOf(incoming), Image: ImageOf(incoming)}
+	if incoming != nil && incoming.Problem != nil {
+		resp.ProblemVersion = snap.VersionOf(incoming.Problem.Id)
+	}
+	if out != nil {
+		resp.Stdout, resp.Stderr, resp.Expected = out.got.String(), out.gotErr.String(), out.expected.String()
+		resp.Diff = out.diff()
+		resp.Truncated = out.truncated()
+		err = out.verdict()
+	}
 	log.Printf("RunDefault: %#v", err)
 	if err != nil {
-		return &Response{Fail, err.Error(), stdout.String(), stderr.String()}
+		resp.Status, resp.Details = Fail, err.Error()
 	}
-	return &Response{Pass, "Output is as expected", stdout.String(), stderr.String()}
+	observe("run", incoming, resp, start)
+	return resp
 }
 
 func Validate(localAgent *Agent, jd *JudgeData) (error, *Response) {
-	key, err := localAgent.UpdateProblemsCache(jd)
-	if err != nil {
+	return ValidateContext(context.Background(), localAgent, jd)
+}
+
+func ValidateContext(ctx context.Context, localAgent *Agent, jd *JudgeData) (error, *Response) {
+	if err := localAgent.ValidateJudgeData(jd); err != nil {
 		return err, nil
 	}
-	defer localAgent.RemoveFromProblemsCache(key)
+	start := time.Now()
+	// The problem under validation is judged from a private snapshot so that
+	// it is never visible to other judgements.
+	key := RandStringRunes(12)
+	snap := localAgent.snapshot().with(key, jd)
 	payload := &Payload{
-		Problem:  &Problem{Id: key},
-		Language: jd.Solution.Language,
-		Files:    jd.Solution.Files,
+		Problem:      &Problem{Id: key},
+		SubmissionId: "validate-" + key,
+		Language:     jd.Solution.Language,
+		Variant:      jd.Solution.Variant,
+		Files:        jd.Solution.Files,
 	}
-	return nil, JudgeDefault(localAgent, payload)
+	resp := judge(ctx, localAgent, snap, payload)
+	observe("validate", payload, resp, start)
+	return nil, resp
 }
 
 var letterRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
@@ -359,7 +525,7 @@ func prepareAgent(agent *Agent, values map[string]string) error {
 		if err != nil {
 			return err
 		}
-		agent.Data = data
+		agent.Problems = NewProblemStore(data)
 	}
 	if problemsdir, ok := values["problemsdir"]; ok {
 		problemsDir, err := filepath.Abs(problemsdir)
@@ -514,8 +680,14 @@ func getCacheFilename() string {
 }
 
 func ReadCache() (map[string]*JudgeData, error) {
+	return ReadCacheFile(getCacheFilename())
+}
+
+// ReadCacheFile is ReadCache reading filename instead of the cache file in
+// the home directory.
+func ReadCacheFile(filename string) (map[string]*JudgeData, error) {
 	data := make(map[string]*JudgeData)
-	cacheFile, err := os.Open(getCacheFilename())
+	cacheFile, err := os.Open(filename)
 	if err != nil {
 		return data, err
 	}
@@ -534,10 +706,11 @@ func ReadOneProblem(data map[string]*JudgeData, problemId, solutionsDir string)
 	if err != nil {
 		return err
 	}
-	if solution != nil {
-		data[problemId] = &JudgeData{
-			Solution: solution,
-		}
+	if solution == nil {
+		return nil
+	}
+	data[problemId] = &JudgeData{
+		Solution: solution,
 	}
 	if io, err := ReadTestcases(solutionsDir); err == nil {
 		data[problemId].IO = io
@@ -547,27 +720,67 @@ func ReadOneProblem(data map[string]*JudgeData, problemId, solutionsDir string)
 	return nil
 }
 
-func ReadAllProblems(data map[string]*JudgeData, problemsDir string) error {
-	files, err := ioutil.ReadDir(problemsDir)
+// ReadProblem reads the problem in dir. Unlike ReadOneProblem it fails when
+// the testcases cannot be read. A directory without a solution directory
+// holds no problem: both results are nil.
+func ReadProblem(dir string) (*JudgeData, error) {
+	solution, err := ReadSolution(nil, dir, nil)
+	if err != nil || solution == nil {
+		return nil, err
+	}
+	io, err := ReadTestcases(dir)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	type args struct {
-		problemId    string
-		solutionsDir string
+	return &JudgeData{Solution: solution, IO: io}, nil
+}
+
+// ProblemDirs maps the id of every problem of problemsDir to its directory.
+// A problemsDir that is itself a problem holds that problem only.
+func ProblemDirs(problemsDir string) (map[string]string, error) {
+	files, err := ioutil.ReadDir(problemsDir)
+	if err != nil {
+		return nil, err
 	}
-	toRead := []args{}
+	dirs := map[string]string{}
 	for _, f := range files {
 		if f.IsDir() && f.Name() == SOLUTION_DIR {
-			toRead = []args{args{filepath.Base(problemsDir), problemsDir}}
-			break
+			return map[string]string{filepath.Base(problemsDir): problemsDir}, nil
 		}
 		if f.IsDir() {
-			toRead = append(toRead, args{f.Name(), filepath.Join(problemsDir, f.Name())})
+			dirs[f.Name()] = filepath.Join(problemsDir, f.Name())
+		}
+	}
+	return dirs, nil
+}
+
+// ReadProblems reads every problem of problemsDir into data. Problems that
+// cannot be read are left out and their errors returned by problem id; the
+// error is only set when problemsDir itself cannot be read.
+func ReadProblems(data map[string]*JudgeData, problemsDir string) (map[string]error, error) {
+	dirs, err := ProblemDirs(problemsDir)
+	if err != nil {
+		return nil, err
+	}
+	failed := map[string]error{}
+	for id, dir := range dirs {
+		jd, err := ReadProblem(dir)
+		if err != nil {
+			failed[id] = err
+		} else if jd != nil {
+			data[id] = jd
 		}
 	}
-	for _, r := range toRead {
-		if err := ReadOneProblem(data, r.problemId, r.solutionsDir); err != nil {
+	return failed, nil
+}
+
+func ReadAllProblems(data map[string]*JudgeData, problemsDir string) error {
+	dirs, err := ProblemDirs(problemsDir)
+	if err != nil {
+		return err
+	}
+	for id, dir := range dirs {
+		if err := ReadOneProblem(data, id, dir); err != nil {
 			return err
 		}
 	}
@@ -575,6 +788,12 @@ func ReadAllProblems(data map[string]*JudgeData, problemsDir string) error {
 }
 
 func UpdateCache(data map[string]*JudgeData) error {
+	return UpdateCacheFile(getCacheFilename(), data)
+}
+
+// UpdateCacheFile is UpdateCache writing filename instead of the cache file
+// in the home directory.
+func UpdateCacheFile(filename string, data map[string]*JudgeData) error {
 	if data == nil {
 		return nil
 	}
@@ -583,10 +802,10 @@ func UpdateCache(data map[string]*JudgeData) error {
 	if err != nil {
 		return err
 	}
-	cacheFile, err := os.Create(getCacheFilename())
+	cacheFile, err := os.Create(filename)
 	if err != nil {
 		log.Warnf("Failed to update cache file: %v", err)
-		log.Infof("Please udpate %s with following content: %s", getCacheFilename(), b.String())
+		log.Infof("Please udpate %s with following content: %s", filename, b.String())
 		return err
 	}
 	defer cacheFile.Close()
@@ -70,8 +70,8 @@ func TestRunDefault(t *testing.T) {
 		t.Error(err)
 	}
 	agent := &Agent{
-		Client: dockerutils.NewClient(),
-		Data:   data,
+		Client:   dockerutils.NewClient(),
+		Problems: NewProblemStore(data),
 	}
 	if agent.Client == nil {
 		t.Errorf("Failed to initialize docker client")
@@ -179,8 +179,8 @@ var rawpayload = `{"problem":{"id":"prob-2"},"language":"cpp","stdin":"here\nhel
 
 func TestNewAgentExecution(t *testing.T) {
 	agent := &Agent{
-		Client: dockerutils.NewClient(),
-		Data:   make(map[string]*JudgeData),
+		Client:   dockerutils.NewClient(),
+		Problems: NewProblemStore(nil),
 	}
 
 	incoming := &Payload{}
@@ -230,3 +230,19 @@ func TestReadCache(t *testing.T) {
 	}
 	fmt.Printf("data=%+v\n", data)
 }
+
+func TestUpdateCacheFileWritesGivenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "umpire-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.json")
+	if err := UpdateCacheFile(filename, map[string]*JudgeData{"sum": &JudgeData{}}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ReadCacheFile(filename)
+	if err != nil || data["sum"] == nil {
+		t.Errorf("expected sum in %s, got %v %v", filename, data, err)
+	}
+}
@@ -0,0 +1,175 @@
+package umpire
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Machine-readable codes of validation errors.
+const (
+	ErrCodeInvalidPayload   = "invalid_payload"
+	ErrCodeUnknownLanguage  = "unknown_language"
+	ErrCodeUnknownVariant   = "unknown_variant"
+	ErrCodeMissingProblem   = "missing_problem"
+	ErrCodeUnknownProblem   = "unknown_problem"
+	ErrCodeNoFiles          = "no_files"
+	ErrCodeTooManyFiles     = "too_many_files"
+	ErrCodeInvalidFileName  = "invalid_file_name"
+	ErrCodeInvalidProblemId = "invalid_problem_id"
+	ErrCodeDuplicateFile    = "duplicate_file_name"
+	ErrCodeSourceTooLarge   = "source_too_large"
+	ErrCodeStdinTooLarge    = "stdin_too_large"
+	ErrCodeOutputTooLarge   = "output_too_large"
+)
+
+// ValidationError explains why a payload was refused before anything ran.
+type ValidationError struct {
+	Code    string `json:"code"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func invalid(code, field, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Code: code, Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// PayloadLimits bounds what a payload may carry.
+type PayloadLimits struct {
+	Files       int
+	SourceBytes int
+	StdinBytes  int
+}
+
+var Limits = &PayloadLimits{
+	Files:       32,
+	SourceBytes: 256 << 10,
+	StdinBytes:  8 << 20,
+}
+
+var fileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.+-]{0,127}$`)
+
+// checkName makes sure name can be joined to a directory without leaving it.
+// code tells what kind of name was refused.
+func checkName(code, field, name string) *ValidationError {
+	if !fileNamePattern.MatchString(name) || name == "." || name == ".." {
+		return invalid(code, field, "Invalid name '%s': use letters, digits and . _ + - only", name)
+	}
+	return nil
+}
+
+// CheckProblemId makes sure id can name a problem directory.
+func CheckProblemId(field, id string) *ValidationError {
+	return checkName(ErrCodeInvalidProblemId, field, id)
+}
+
+// ValidatePayload checks everything about payload that can be checked
+// without running it. needProblem is set for judging, which needs a known
+// problem; plain execution does not. It returns a *ValidationError.
+func (u *Agent) ValidatePayload(payload *Payload, needProblem bool) error {
+	return u.validatePayload(u.snapshot(), payload, needProblem)
+}
+
+func (u *Agent) validatePayload(snap *ProblemSnapshot, payload *Payload, needProblem bool) error {
+	if payload == nil {
+		return invalid(ErrCodeInvalidPayload, "", "Missing payload")
+	}
+	if _, ok := Languages[payload.Language]; !ok {
+		return invalid(ErrCodeUnknownLanguage, "language", "Unsupported language '%s'", payload.Language)
+	}
+	if _, err := resolveLanguage(payload.Language, payload.Variant); err != nil {
+		return invalid(ErrCodeUnknownVariant, "variant", "%v", err)
+	}
+	if len(payload.Files) == 0 {
+		return invalid(ErrCodeNoFiles, "files", "No source files")
+	}
+	if len(payload.Files) > Limits.Files {
+		return invalid(ErrCodeTooManyFiles, "files", "%d files given, at most %d are allowed", len(payload.Files), Limits.Files)
+	}
+	seen := map[string]bool{}
+	size := 0
+	for i, file := range payload.Files {
+		field := fmt.Sprintf("files[%d].name", i)
+		if file == nil {
+			return invalid(ErrCodeInvalidFileName, field, "Missing file")
+		}
+		if err := checkName(ErrCodeInvalidFileName, field, file.Name); err != nil {
+			return err
+		}
+		if seen[file.Name] {
+			return invalid(ErrCodeDuplicateFile, field, "File '%s' given twice", file.Name)
+		}
+		seen[file.Name] = true
+		size += len(file.Content)
+	}
+	if size > Limits.SourceBytes {
+		return invalid(ErrCodeSourceTooLarge, "files", "Source is %d bytes, at most %d are allowed", size, Limits.SourceBytes)
+	}
+	if len(payload.Stdin) > Limits.StdinBytes {
+		return invalid(ErrCodeStdinTooLarge, "stdin", "Stdin is %d bytes, at most %d are allowed", len(payload.Stdin), Limits.StdinBytes)
+	}
+	if !needProblem {
+		return nil
+	}
+	if payload.Problem == nil || payload.Problem.Id == "" {
+		return invalid(ErrCodeMissingProblem, "problem.id", "Missing problem id")
+	}
+	if err := u.findProblem(snap, "problem.id", payload.Problem.Id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ValidateJudgeData checks a problem submitted for validation: its reference
+// solution and its testcases.
+func (u *Agent) ValidateJudgeData(jd *JudgeData) error {
+	if jd == nil || jd.Solution == nil {
+		return invalid(ErrCodeInvalidPayload, "solution", "Missing reference solution")
+	}
+	if err := u.ValidatePayload(jd.Solution, false); err != nil {
+		if verr, ok := err.(*ValidationError); ok && verr.Field != "" {
+			verr.Field = "solution." + verr.Field
+		}
+		return err
+	}
+	for i, io := range jd.IO {
+		field := fmt.Sprintf("io[%d]", i)
+		if io == nil {
+			return invalid(ErrCodeInvalidPayload, field, "Missing testcase")
+		}
+		if len(io.Input) > Limits.StdinBytes {
+			return invalid(ErrCodeStdinTooLarge, field+".input", "Testcase input is %d bytes, at most %d are allowed", len(io.Input), Limits.StdinBytes)
+		}
+		if len(io.Output) > Limits.StdinBytes {
+			return invalid(ErrCodeOutputTooLarge, field+".output", "Testcase output is %d bytes, at most %d are allowed", len(io.Output), Limits.StdinBytes)
+		}
+	}
+	return nil
+}
+
+// findProblem makes sure id names a problem, published, cached or else
+// in a directory under ProblemsDir. Ids are only checked as paths for
+// the last, where nested ids like "owner/problems/sum" stay allowed.
+func (u *Agent) findProblem(snap *ProblemSnapshot, field, id string) *ValidationError {
+	if snap.Get(id) != nil {
+		return nil
+	}
+	for _, part := range strings.Split(id, "/") {
+		if CheckProblemId(field, part) != nil {
+			return invalid(ErrCodeInvalidProblemId, field, "Invalid problem id '%s': use letters, digits and . _ + - only, with / between directories", id)
+		}
+	}
+	if u.ProblemsDir != "" {
+		info, err := os.Stat(filepath.Join(u.ProblemsDir, id, IO_DIR))
+		if err == nil && info.IsDir() {
+			return nil
+		}
+	}
+	return invalid(ErrCodeUnknownProblem, field, "Problem Id '%s' not found", id)
+}
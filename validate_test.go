@@ -0,0 +1,125 @@
+package umpire
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatePayload(t *testing.T) {
+	u := &Agent{Problems: NewProblemStore(map[string]*JudgeData{"sum": &JudgeData{}})}
+	valid := func() *Payload {
+		return &Payload{
+			Language: "cpp",
+			Files:    []*InMemoryFile{{Name: "main.cpp", Content: "int main() {}"}},
+			Problem:  &Problem{Id: "sum"},
+		}
+	}
+	if err := u.ValidatePayload(valid(), true); err != nil {
+		t.Fatalf("valid payload rejected: %v", err)
+	}
+	tests := []struct {
+		name   string
+		change func(p *Payload)
+		code   string
+	}{
+		{"unknown language", func(p *Payload) { p.Language = "cobol" }, ErrCodeUnknownLanguage},
+		{"unknown variant", func(p *Payload) { p.Variant = "c++98" }, ErrCodeUnknownVariant},
+		{"nil problem", func(p *Payload) { p.Problem = nil }, ErrCodeMissingProblem},
+		{"unknown problem", func(p *Payload) { p.Problem.Id = "nope" }, ErrCodeUnknownProblem},
+		{"problem traversal", func(p *Payload) { p.Problem.Id = "../etc" }, ErrCodeInvalidProblemId},
+		{"file traversal", func(p *Payload) { p.Files[0].Name = "../../etc/x" }, ErrCodeInvalidFileName},
+		{"hidden file", func(p *Payload) { p.Files[0].Name = ".bashrc" }, ErrCodeInvalidFileName},
+		{"no files", func(p *Payload) { p.Files = nil }, ErrCodeNoFiles},
+		{"duplicate file", func(p *Payload) { p.Files = append(p.Files, p.Files[0]) }, ErrCodeDuplicateFile},
+		{"too many files", func(p *Payload) {
+			for i := 0; i < Limits.Files; i++ {
+				p.Files = append(p.Files, &InMemoryFile{Name: "f" + strings.Repeat("x", i) + ".h"})
+			}
+		}, ErrCodeTooManyFiles},
+		{"source too large", func(p *Payload) { p.Files[0].Content = strings.Repeat("x", Limits.SourceBytes+1) }, ErrCodeSourceTooLarge},
+		{"stdin too large", func(p *Payload) { p.Stdin = strings.Repeat("x", Limits.StdinBytes+1) }, ErrCodeStdinTooLarge},
+	}
+	for _, test := range tests {
+		p := valid()
+		test.change(p)
+		err := u.ValidatePayload(p, true)
+		verr, ok := err.(*ValidationError)
+		if !ok || verr.Code != test.code {
+			t.Errorf("%s: expected code %s, got %v", test.name, test.code, err)
+		}
+	}
+	p := valid()
+	p.Problem = nil
+	if err := u.ValidatePayload(p, false); err != nil {
+		t.Errorf("execution does not need a problem: %v", err)
+	}
+}
+
+func TestJudgeAllRejectsNilProblem(t *testing.T) {
+	u := &Agent{}
+	err := u.JudgeAll(context.Background(), &Payload{Language: "cpp", Files: []*InMemoryFile{{Name: "main.cpp"}}}, nil, nil)
+	if verr, ok := err.(*ValidationError); !ok || verr.Code != ErrCodeMissingProblem {
+		t.Errorf("expected %s, got %v", ErrCodeMissingProblem, err)
+	}
+}
+
+func TestCreateDirectoryWithFilesRejectsTraversal(t *testing.T) {
+	if dir, err := createDirectoryWithFiles([]*InMemoryFile{{Name: "../escape.txt"}}); err == nil {
+		t.Errorf("expected an error, got directory %s", *dir)
+	}
+}
+
+func TestValidateJudgeDataBoundsTestcases(t *testing.T) {
+	u := &Agent{}
+	jd := &JudgeData{
+		Solution: &Payload{Language: "cpp", Files: []*InMemoryFile{{Name: "main.cpp", Content: "int main() {}"}}},
+		IO:       []*InputOutput{{Input: "1", Output: strings.Repeat("x", Limits.StdinBytes+1)}},
+	}
+	err := u.ValidateJudgeData(jd)
+	if verr, ok := err.(*ValidationError); !ok || verr.Code != ErrCodeOutputTooLarge || verr.Field != "io[0].output" {
+		t.Errorf("expected %s for io[0].output, got %v", ErrCodeOutputTooLarge, err)
+	}
+}
+
+func TestValidateProblemIds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "problems")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "owner", "sum", IO_DIR), 0755); err != nil {
+		t.Fatal(err)
+	}
+	u := &Agent{
+		Problems: NewProblemStore(map[string]*JudgeData{
+			"-leading-dash":                  &JudgeData{},
+			"maddyonline/problems/problem-1": &JudgeData{},
+		}),
+		ProblemsDir: dir,
+	}
+	for _, id := range []string{"-leading-dash", "maddyonline/problems/problem-1", "owner/sum"} {
+		p := &Payload{Language: "cpp", Files: []*InMemoryFile{{Name: "main.cpp"}}, Problem: &Problem{Id: id}}
+		if err := u.ValidatePayload(p, true); err != nil {
+			t.Errorf("problem %q rejected: %v", id, err)
+		}
+	}
+	for id, code := range map[string]string{"owner/../owner/sum": ErrCodeInvalidProblemId, "-x": ErrCodeInvalidProblemId, "owner/max": ErrCodeUnknownProblem} {
+		p := &Payload{Language: "cpp", Files: []*InMemoryFile{{Name: "main.cpp"}}, Problem: &Problem{Id: id}}
+		if verr, ok := u.ValidatePayload(p, true).(*ValidationError); !ok || verr.Code != code {
+			t.Errorf("problem %q: expected %s, got %v", id, code, verr)
+		}
+	}
+}
+
+func TestCheckProblemId(t *testing.T) {
+	if verr := CheckProblemId("id", "sum"); verr != nil {
+		t.Errorf("valid id rejected: %v", verr)
+	}
+	if verr := CheckProblemId("id", ".."); verr == nil || verr.Code != ErrCodeInvalidProblemId {
+		t.Errorf("expected %s, got %v", ErrCodeInvalidProblemId, verr)
+	}
+}